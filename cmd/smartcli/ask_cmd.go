@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/embedder"
+	"smart-cli/go-backend/git_history"
+	"smart-cli/go-backend/go_deps"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type askOptions struct {
+	question    string
+	model       string
+	historyTopK int
+	retrieval   retrievalOptions
+}
+
+func createAskCmd() *cobra.Command {
+	var opts askOptions
+
+	askCmd := &cobra.Command{
+		Use:   "ask <question>",
+		Short: "Ask a question about the codebase and its history",
+		Long: `Answer a question from the code index and, when it exists, the git history
+index built by 'smartcli index --history'. Answers cite the commits they rely on.`,
+		Example: `  smartcli ask "why does storeChunk use the basename"
+  smartcli ask "when did we add resumable indexing and why"`,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.question = strings.TrimSpace(strings.Join(args, " "))
+			if opts.question == "" {
+				fmt.Println("Error: Please provide a question")
+				fmt.Println("Example: smartcli ask \"why was this changed?\"")
+				return
+			}
+			if err := opts.retrieval.validate(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			askQuestion(opts)
+		},
+	}
+
+	askCmd.Flags().StringVarP(&opts.model, "model", "m", "", "Embedding model for the query (defaults to the model the index was built with)")
+	askCmd.Flags().IntVar(&opts.historyTopK, "history-top-k", 8, "Number of history chunks to retrieve")
+	addRetrievalFlags(askCmd, &opts.retrieval)
+
+	return askCmd
+}
+
+func askQuestion(opts askOptions) {
+	ctx := context.Background()
+
+	store, err := openStore(".")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer func() { _ = store.Close() }()
+
+	indexName, err := chunk_retriever.ResolveIndexName(store)
+	if err != nil {
+		fmt.Printf("Error: failed to get index name: %v\n", err)
+		return
+	}
+	historyIndex := git_history.IndexName(indexName)
+	if !store.Exists(ctx, historyIndex) {
+		fmt.Printf("Note: no history index %q; run `smartcli index --history` to include commits.\n", historyIndex)
+	}
+
+	// Refuse to query an index built with an incompatible model
+	meta, model, err := resolveQueryModel(ctx, store, indexName, opts.model)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	_, _, creds := mustGCP()
+	embedderClient, err := embedder.EmbedderClient(ctx, creds, redisOf(store), model)
+	if err != nil {
+		fmt.Printf("Error creating embedder: %v\n", err)
+		return
+	}
+	queryEmbedding := createEmbedding(opts.question, embedderClient)
+	if len(queryEmbedding) == 0 {
+		return
+	}
+	if meta != nil {
+		if err := meta.CheckQuery(indexName, embedderClient.Model, len(queryEmbedding)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+
+	gen, closeAgent, err := newAgent(ctx)
+	if err != nil {
+		fmt.Printf("warning: failed to create agent: %v\n", err)
+		return
+	}
+	defer func() { _ = closeAgent() }()
+	ret, err := opts.retrieval.retriever(store, embedderClient.Model, meta, gen)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	ret.expandQuery(ctx, embedderClient, opts.question)
+
+	// Code and history are ranked separately so commits are not crowded out
+	code := ret.retrieve(ctx, opts.retrieval.apply(chunk_retriever.PrepareQuery(opts.question, opts.retrieval.limits.TopK, indexName)),
+		queryEmbedding, go_deps.IndexName(indexName))
+	var history []chunk_retriever.Chunk
+	if store.Exists(ctx, historyIndex) {
+		if err := checkCompanionIndex(ctx, store, historyIndex, embedderClient.Model, len(queryEmbedding)); err != nil {
+			fmt.Printf("Warning: skipping index %q: %v\n", historyIndex, err)
+		} else {
+			history = ret.retrieve(ctx, opts.retrieval.apply(chunk_retriever.PrepareQuery(opts.question, opts.historyTopK, historyIndex)),
+				queryEmbedding)
+		}
+	}
+	retrievedChunks := append(code, history...)
+	printRetrieved(retrievedChunks)
+	if len(retrievedChunks) == 0 && ret.threshold.Enabled() {
+		printNoContext(opts.retrieval.limits)
+		return
+	}
+
+	instructions := fmt.Sprintf(
+		`Answer the following question about this codebase.
+
+Question: %s
+
+Instructions:
+- Use the provided code and commit history as your sources
+- Context blocks starting with [commit <sha> ...] come from git history; when a statement relies on one, cite its SHA shortened to 8 characters, e.g. (commit 1a2b3c4d)
+- Prefer the commit messages and diffs to explain why something was changed, and the code to explain how it works now
+- If the context does not answer the question, say so clearly instead of guessing`,
+		opts.question,
+	)
+
+	answer, err := gen.Answer(ctx, instructions, retrievedChunks)
+	if err != nil {
+		fmt.Printf("warning: failed to generate answer: %v\n", err)
+		return
+	}
+	fmt.Println("\n===== Answer =====")
+	fmt.Println(answer)
+
+	printCommits(history)
+}
+
+// printCommits lists the commits that were given to the model as context.
+func printCommits(history []chunk_retriever.Chunk) {
+	seen := map[string]struct{}{}
+	var lines []string
+	for _, ch := range history {
+		sha := ch.Metadata["commit"]
+		if sha == "" {
+			continue
+		}
+		if _, ok := seen[sha]; ok {
+			continue
+		}
+		seen[sha] = struct{}{}
+		if len(sha) > 8 {
+			sha = sha[:8]
+		}
+		lines = append(lines, fmt.Sprintf("  %s  %s (%s)", sha, ch.Metadata["subject"], ch.Metadata["author"]))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Println("\n===== Commits consulted =====")
+	fmt.Println(strings.Join(lines, "\n"))
+}
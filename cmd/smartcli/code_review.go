@@ -3,70 +3,111 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/config"
 	"smart-cli/go-backend/embedder"
-	"smart-cli/go-backend/generator"
+	"smart-cli/go-backend/file_resolver"
+	"smart-cli/go-backend/git_history"
+	"smart-cli/go-backend/go_deps"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/workspace"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+type reviewOptions struct {
+	filePath    string
+	detailLevel string
+	autoExplain bool
+	userQuery   string
+	model       string
+	modules     []string
+	related     float64
+	retrieval   retrievalOptions
+}
+
 func createCodeReviewCmd() *cobra.Command {
-	var filePath string
-	var detailLevel string
-	var autoExplain bool
-	var userQuery string
+	var opts reviewOptions
 
 	codeReviewCmd := &cobra.Command{
 		Use:   "review",
 		Short: "Review code for improvements",
-		Long:  `Analyze code for potential bugs, style improvements, and optimization opportunities.`,
+		Long: `Analyze code for potential bugs, style improvements, and optimization opportunities.
+Context comes mostly from the reviewed file; --related sets the share taken
+from the rest of the repository and its dependencies.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			// If no file path is provided but there are arguments, use the first argument
-			if filePath == "" && len(args) > 0 {
-				filePath = args[0]
+			if opts.filePath == "" && len(args) > 0 {
+				opts.filePath = args[0]
 			}
 
-			if filePath == "" {
+			if opts.filePath == "" {
 				fmt.Println("Error: Please provide a file to review")
 				return
 			}
 			// Require a user query
-			if userQuery == "" {
+			if opts.userQuery == "" {
 				fmt.Println("Error: Please provide a question with -q or --query")
 				fmt.Println("Example: smartcli review -f embedder.go -q \"what does this file do?\"")
 				return
 			}
 
+			if opts.related < 0 || opts.related > 1 {
+				fmt.Println("Error: --related must be between 0 and 1")
+				return
+			}
+			if err := opts.retrieval.validate(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+
 			// If still no query, use a sensible default
-			if strings.TrimSpace(userQuery) == "" {
-				userQuery = "Summarize this file, list key functions/methods and explain what they do. Highlight any potential issues."
+			if strings.TrimSpace(opts.userQuery) == "" {
+				opts.userQuery = "Summarize this file, list key functions/methods and explain what they do. Highlight any potential issues."
 			}
 
 			// Call the function that will handle the code review
-			performCodeReview(filePath, detailLevel, userQuery)
+			performCodeReview(opts)
 
 		},
 	}
 
 	// Add flags specific to code review
-	codeReviewCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to file for analysis (required)")
-	codeReviewCmd.Flags().StringVarP(&detailLevel, "detail", "d", "medium", "Level of detail (low, medium, high)")
-	codeReviewCmd.Flags().StringVarP(&userQuery, "query", "q", "", "Your question about the code")
-	codeReviewCmd.Flags().BoolVar(&autoExplain, "explain", false, "Automatically explain errors/issues in the file")
+	codeReviewCmd.Flags().StringVarP(&opts.filePath, "file", "f", "", "Path to file for analysis (required)")
+	codeReviewCmd.Flags().StringVarP(&opts.detailLevel, "detail", "d", "medium", "Level of detail (low, medium, high)")
+	codeReviewCmd.Flags().StringVarP(&opts.userQuery, "query", "q", "", "Your question about the code")
+	codeReviewCmd.Flags().BoolVar(&opts.autoExplain, "explain", false, "Automatically explain errors/issues in the file")
+	codeReviewCmd.Flags().StringVarP(&opts.model, "model", "m", "", "Embedding model for the query (defaults to the model the index was built with)")
+	codeReviewCmd.Flags().StringSliceVar(&opts.modules, "module", nil, "Only search these workspace modules (path, directory or name; repeatable)")
+	codeReviewCmd.Flags().Float64Var(&opts.related, "related", 0.3, "Share of retrieved chunks reserved for code outside the reviewed file (0-1)")
+	addRetrievalFlags(codeReviewCmd, &opts.retrieval)
 
 	return codeReviewCmd
 }
 
-func performCodeReview(filePath string, detailLevel string, userQuery string) {
+func performCodeReview(opts reviewOptions) {
+	filePath, detailLevel, userQuery, model := opts.filePath, opts.detailLevel, opts.userQuery, opts.model
 	fmt.Printf("Performing %s level code review for: %s\n", detailLevel, filePath)
 	ctx := context.Background()
 
-	// Connect to Redis and resolve index name
-	rdb := chunk_retriever.Connect()
-	defer func() { _ = rdb.Close() }()
+	modules, err := resolveModules(opts.modules)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	// Open the store and resolve index name
+	store, err := openStore(".")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	defer func() { _ = store.Close() }()
 
-	indexName, err := chunk_retriever.GetIndexName(rdb)
+	indexName, err := chunk_retriever.ResolveIndexName(store)
 	if err != nil {
 		fmt.Printf("Error: failed to get index name: %v\n", err)
 		return
@@ -78,29 +119,69 @@ func performCodeReview(filePath string, detailLevel string, userQuery string) {
 		userQuery = "Summarize this file."
 	}
 
+	// Refuse to query an index built with an incompatible model
+	meta, model, err := resolveQueryModel(ctx, store, indexName, model)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
 	// Create embedder client
 	_, _, creds := mustGCP()
-	embedderClient, err := embedder.EmbedderClient(ctx, creds, rdb, "")
+	embedderClient, err := embedder.EmbedderClient(ctx, creds, redisOf(store), model)
 	if err != nil {
 		fmt.Printf("Error creating embedder: %v\n", err)
 		return
 	}
 
 	queryEmbedding := createEmbedding(userQuery, embedderClient)
-	chunkQuery := chunk_retriever.PrepareQuery(userQuery, 10, indexName)
-
-	// Concurrent chunk retrieval
-	// Retrieve relevant chunks
-	retrievedChunks, err := chunk_retriever.ConcurrentChunkRetrieval(rdb,
-		[]chunk_retriever.ChunkQuery{chunkQuery},
-		[][]float32{queryEmbedding},
-		10)
+	if len(queryEmbedding) == 0 {
+		return
+	}
+	if meta != nil {
+		if err := meta.CheckQuery(indexName, embedderClient.Model, len(queryEmbedding)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	chunkQuery := opts.retrieval.apply(chunk_retriever.PrepareQuery(userQuery, opts.retrieval.limits.TopK, indexName))
+	chunkQuery.Modules = modules
+	if len(modules) > 0 && meta != nil && meta.Version < index_meta.VersionModuleTags {
+		fmt.Printf("Warning: index %q predates module tags; re-index with --workspace to filter by module.\n", indexName)
+	}
 
+	gen, closeAgent, err := newAgent(ctx)
+	if err != nil {
+		fmt.Printf("warning: failed to create agent: %v\n", err)
+		return
+	}
+	defer func() { _ = closeAgent() }()
+	ret, err := opts.retrieval.retriever(store, embedderClient.Model, meta, gen)
 	if err != nil {
-		fmt.Printf("Warning: retrieval error: %v\n", err)
+		fmt.Printf("Error: %v\n", err)
+		return
 	}
 
-	fmt.Printf("Retrieved %d context chunks\n", len(retrievedChunks))
+	ret.expandQuery(ctx, embedderClient, userQuery)
+
+	// Focus on the reviewed file; related code comes from the rest of the
+	// repository and the dependency index built by `smartcli index --deps`
+	var retrievedChunks []chunk_retriever.Chunk
+	target, err := reviewTarget(filePath, meta)
+	if err != nil {
+		fmt.Printf("Warning: could not look up %s: %v\n", filePath, err)
+	}
+	if target == "" {
+		fmt.Printf("Warning: %s was not found under the indexed root; searching the whole repository.\n", filePath)
+		retrievedChunks = ret.retrieve(ctx, chunkQuery, queryEmbedding, go_deps.IndexName(indexName))
+	} else {
+		retrievedChunks = ret.retrieveFile(ctx, chunkQuery, target, opts.related, queryEmbedding)
+	}
+	printRetrieved(retrievedChunks)
+	if len(retrievedChunks) == 0 && ret.threshold.Enabled() {
+		printNoContext(opts.retrieval.limits)
+		return
+	}
 
 	// Create a prompt that asks the LLM to answer the user's specific question
 	instructions := fmt.Sprintf(
@@ -120,12 +201,6 @@ Instructions:
 	)
 
 	// Generate answer/review
-	gen, err := generator.NewAgent(ctx, "gemini-2.5-flash")
-	if err != nil {
-		fmt.Printf("warning: failed to create agent: %v\n", err)
-		return
-	}
-
 	answer, err := gen.Answer(ctx, instructions, retrievedChunks)
 	if err != nil {
 		fmt.Printf("warning: failed to generate review: %v\n", err)
@@ -137,6 +212,151 @@ Instructions:
 
 // ===== Helpers =====
 
+// resolveQueryModel loads the index metadata and picks the embedding model for
+// a query: the requested one if it is compatible, otherwise the index's own.
+// Every shard of a sharded index must be compatible. Indexes without metadata
+// are queried as-is with a warning.
+func resolveQueryModel(ctx context.Context, store chunk_retriever.VectorStore, indexName, model string) (*index_meta.Metadata, string, error) {
+	var meta *index_meta.Metadata
+	rdb := redisOf(store)
+	names := []string{indexName}
+	if rdb != nil {
+		names = chunk_retriever.ShardsOf(rdb, indexName)
+	}
+	for _, name := range names {
+		physical, err := physicalIndex(store, name)
+		if err != nil {
+			return nil, model, fmt.Errorf("failed to resolve index %q: %w", name, err)
+		}
+		m, err := store.LoadMeta(ctx, physical)
+		if err != nil {
+			return nil, model, fmt.Errorf("failed to load metadata for %q: %w", name, err)
+		}
+		if m == nil {
+			fmt.Printf("Warning: index %q has no smartcli metadata, so model compatibility cannot be checked. Re-index to record it.\n", name)
+			continue
+		}
+		if meta == nil {
+			meta = m
+			if model == "" {
+				model = m.Model
+			}
+		}
+		if err := m.CheckQuery(name, model, 0); err != nil {
+			return meta, model, err
+		}
+	}
+	return meta, model, nil
+}
+
+// resolveModules maps --module references to the module names stored in the
+// index, using the workspace enclosing the current directory.
+func resolveModules(refs []string) ([]string, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	ws, err := workspace.Find(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("error reading workspace: %w", err)
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("--module needs a %s or workspace.modules config at or above %s", workspace.WorkFile, cwd)
+	}
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		m, err := ws.Lookup(ref)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// reviewTarget maps the -f argument to the path stored in the index's file
+// field: the file itself when it exists, otherwise the best match by name
+// under the indexed root. It returns "" when nothing matches.
+func reviewTarget(arg string, meta *index_meta.Metadata) (string, error) {
+	if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+		return filepath.Abs(arg)
+	}
+	root := "."
+	if meta != nil && meta.Root != "" {
+		root = meta.Root
+	}
+	// Only files the index could hold, under the same include/exclude policy
+	cfg, err := config.Load(root)
+	if err != nil {
+		return "", err
+	}
+	resolver, err := file_resolver.NewRoot(root, cfg.Policy())
+	if err != nil {
+		return "", err
+	}
+	matches := resolver.Resolve(arg)
+	if len(matches) == 0 {
+		return "", nil
+	}
+	if len(matches) > 1 {
+		fmt.Printf("Note: %q matches %d files; reviewing %s\n", arg, len(matches), matches[0])
+	}
+	return filepath.Abs(matches[0])
+}
+
+// printRetrieved reports how many chunks were retrieved and from where.
+func printRetrieved(chunks []chunk_retriever.Chunk) {
+	bySource := map[string]int{}
+	textOnly := 0
+	for _, ch := range chunks {
+		bySource[ch.Metadata["source"]]++
+		if ch.VectorRank == 0 && ch.TextRank > 0 {
+			textOnly++
+		}
+	}
+	var parts []string
+	if n := bySource[go_deps.Source]; n > 0 {
+		parts = append(parts, fmt.Sprintf("%d from dependencies", n))
+	}
+	if n := bySource[git_history.Source]; n > 0 {
+		parts = append(parts, fmt.Sprintf("%d from git history", n))
+	}
+	if textOnly > 0 {
+		parts = append(parts, fmt.Sprintf("%d found by full-text search only", textOnly))
+	}
+	if len(parts) > 0 {
+		fmt.Printf("Retrieved %d context chunks (%s)\n", len(chunks), strings.Join(parts, ", "))
+	} else {
+		fmt.Printf("Retrieved %d context chunks\n", len(chunks))
+	}
+}
+
+// checkCompanionIndex verifies a dependency or history index can be queried
+// with the project query's embedding.
+func checkCompanionIndex(ctx context.Context, store chunk_retriever.VectorStore, name, model string, dim int) error {
+	physical, err := physicalIndex(store, name)
+	if err != nil {
+		return err
+	}
+	meta, err := store.LoadMeta(ctx, physical)
+	if err != nil || meta == nil {
+		return err
+	}
+	return meta.CheckQuery(name, model, dim)
+}
+
+// physicalIndex returns the index holding name's metadata. In Redis that is
+// the live version an alias points at; local indexes are not versioned.
+func physicalIndex(store chunk_retriever.VectorStore, name string) (string, error) {
+	if rdb := redisOf(store); rdb != nil {
+		return chunk_retriever.ResolveIndex(rdb, name)
+	}
+	return name, nil
+}
+
 func createEmbedding(userQuery string, embedderClient *embedder.Embedder) []float32 {
 	queryEmbedding, err := embedderClient.EmbedQuery(userQuery)
 	if err != nil {
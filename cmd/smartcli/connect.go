@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/config"
+)
+
+// redisURL is the --redis-url flag; it overrides the configured server.
+var redisURL string
+
+// connectRedis connects to the Redis described by the project config found
+// from dir, then REDIS_URL, REDIS_ADDR and REDIS_PASSWORD, then --redis-url,
+// each overriding the one before.
+func connectRedis(dir string) (redis.UniversalClient, error) {
+	cfg, err := config.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	rc := cfg.RedisFromEnv()
+	if redisURL != "" {
+		rc.URL = redisURL
+		rc.Addrs = nil
+	}
+	return chunk_retriever.Connect(rc)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"smart-cli/go-backend/chunk_retriever"
-	"smart-cli/go-backend/generator"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -66,11 +65,12 @@ Please explain:
 
 Keep the explanation clear, practical, and focused on Go programming.`, errorText)
 
-	gen, err := generator.NewAgent(ctx, "gemini-2.5-flash")
+	gen, closeAgent, err := newAgent(ctx)
 	if err != nil {
 		fmt.Printf("Error creating AI agent: %v\n", err)
 		return ""
 	}
+	defer func() { _ = closeAgent() }()
 
 	answer, err := gen.Answer(ctx, prompt, retrievedChunks)
 	if err != nil {
@@ -2,21 +2,63 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/chunker"
+	"smart-cli/go-backend/concurrency"
+	"smart-cli/go-backend/config"
 	"smart-cli/go-backend/embedder"
+	"smart-cli/go-backend/git_history"
+	"smart-cli/go-backend/go_deps"
+	"smart-cli/go-backend/index_manager"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/local_store"
+	"smart-cli/go-backend/progress"
 	"smart-cli/go-backend/re_indexer"
+	"smart-cli/go-backend/redactor"
+	"smart-cli/go-backend/workspace"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
 )
 
+type indexOptions struct {
+	dir         string
+	indexName   string
+	force       bool
+	model       string
+	chunkSize   int
+	overlap     int
+	jsonOutput  bool
+	maxFailures int64
+	resume      bool
+	retryFailed bool
+	dryRun      bool
+	workspace   bool
+	deps        bool
+	history     bool
+	historyMax  int
+	pricing     re_indexer.Pricing
+	top         int
+	concurrency concurrency.Settings
+	shards      int
+	shardBy     string
+	shard       int
+}
+
+// Default Vertex AI text embedding price, USD per 1,000 input characters.
+const defaultPricePer1kChars = 0.000025
+
 func createIndexCmd() *cobra.Command {
-	var dir string
-	var indexName string
-	var force bool
-	var model string
-	var chunkSize int
-	var overlap int
+	var opts indexOptions
 
 	indexCmd := &cobra.Command{
 		Use:   "index",
@@ -24,85 +66,790 @@ func createIndexCmd() *cobra.Command {
 		Long:  `Scan and index your codebase to enable AI-powered code review and error explanation`,
 		Example: `  smartcli index                    # Index current directory
   smartcli index --dir ./my-project  # Index specific directory
-  smartcli index --force             # Re-index even if index exists`,
-		Run: func(cmd *cobra.Command, args []string) {
-			indexCodebase(dir, indexName, force, model, chunkSize, overlap)
+  smartcli index --force             # Re-index even if index exists
+  smartcli index --json              # Emit newline-delimited JSON progress events
+  smartcli index --resume            # Continue an interrupted run
+  smartcli index --retry-failed      # Only re-process chunks that failed
+  smartcli index --dry-run           # Estimate chunks, tokens and cost without indexing
+  smartcli index --workspace         # Index every module of the enclosing go.work
+  smartcli index --deps              # Index the exported API of go.mod dependencies
+  smartcli index --history           # Index git commits and diffs for smartcli ask
+  smartcli index --shards 4 --force  # Split the index into 4 shards by top-level directory
+  smartcli index --shard 2 --force   # Rebuild only shard 2 of a sharded index
+  smartcli index list                # Show all indexes
+  smartcli index info my_index       # Show index statistics`,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.dryRun {
+				return dryRunIndex(cmd, opts)
+			}
+			if opts.shards < 0 || opts.shards == 1 {
+				return fmt.Errorf("--shards must be at least 2")
+			}
+			if err := re_indexer.ValidShardBy(opts.shardBy); err != nil {
+				return err
+			}
+			return indexCodebase(opts)
 		},
 	}
 
-	indexCmd.Flags().StringVarP(&dir, "dir", "d", "", "Directory to index (defaults to current directory)")
-	indexCmd.Flags().StringVarP(&indexName, "name", "n", "", "Index name (auto-generated if not provided)")
-	indexCmd.Flags().BoolVarP(&force, "force", "f", false, "Force re-indexing even if index already exists")
-	indexCmd.Flags().StringVarP(&model, "model", "m", "text-embedding-005", "Embedding model to use")
-	indexCmd.Flags().IntVar(&chunkSize, "chunk-size", 800, "Size of text chunks")
-	indexCmd.Flags().IntVar(&overlap, "overlap", 50, "Overlap between chunks")
+	indexCmd.Flags().StringVarP(&opts.dir, "dir", "d", "", "Directory to index (defaults to current directory)")
+	indexCmd.Flags().StringVarP(&opts.indexName, "name", "n", "", "Index name (auto-generated if not provided)")
+	indexCmd.Flags().BoolVarP(&opts.force, "force", "f", false, "Force re-indexing even if index already exists")
+	indexCmd.Flags().StringVarP(&opts.model, "model", "m", "text-embedding-005", "Embedding model to use")
+	indexCmd.Flags().IntVar(&opts.chunkSize, "chunk-size", 800, "Size of text chunks")
+	indexCmd.Flags().IntVar(&opts.overlap, "overlap", 50, "Overlap between chunks")
+	indexCmd.Flags().BoolVar(&opts.jsonOutput, "json", false, "Write progress and the run summary as newline-delimited JSON")
+	indexCmd.Flags().Int64Var(&opts.maxFailures, "max-failures", -1, "Exit with an error, and keep the previous version live, when more than this many files/chunks fail (default: no limit)")
+	indexCmd.Flags().BoolVar(&opts.resume, "resume", false, "Continue an interrupted run, skipping files that were already indexed")
+	indexCmd.Flags().BoolVar(&opts.retryFailed, "retry-failed", false, "Only re-process chunks from the failed-chunk queue")
+	indexCmd.Flags().BoolVar(&opts.workspace, "workspace", false, "Index all modules of the enclosing go.work (or workspace.modules config) into one index")
+	indexCmd.Flags().BoolVar(&opts.deps, "deps", false, "Index the exported API of go.mod dependencies (from GOMODCACHE) into <name>_deps")
+	indexCmd.Flags().BoolVar(&opts.history, "history", false, "Index git log messages and per-file diffs into <name>_history")
+	indexCmd.Flags().IntVar(&opts.historyMax, "history-limit", 1000, "Maximum number of commits to index with --history (0 for all)")
+	indexCmd.MarkFlagsMutuallyExclusive("deps", "history")
+	indexCmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Walk and chunk without embedding; report file, chunk, token and cost estimates")
+	indexCmd.Flags().Float64Var(&opts.pricing.PerThousandChars, "price-per-1k-chars", defaultPricePer1kChars, "Embedding price in USD per 1,000 input characters (dry run)")
+	indexCmd.Flags().Float64Var(&opts.pricing.PerMillionTokens, "price-per-1m-tokens", 0, "Embedding price in USD per 1M input tokens (dry run)")
+	indexCmd.Flags().IntVar(&opts.top, "top", 10, "Number of largest files to list (dry run)")
+	indexCmd.Flags().IntVar(&opts.concurrency.FileWorkers, "file-workers", 0, "Concurrent file readers/chunkers (default 8)")
+	indexCmd.Flags().IntVar(&opts.concurrency.EmbedWorkers, "embed-workers", 0, "Concurrent embedding calls; the starting point with --adaptive-workers (default 10)")
+	indexCmd.Flags().BoolVar(&opts.concurrency.Adaptive, "adaptive-workers", false, "Grow or shrink embedding workers based on observed latency and error rate")
+	indexCmd.Flags().IntVar(&opts.concurrency.MinEmbedWorkers, "min-embed-workers", 0, "Lower bound for --adaptive-workers (default 1)")
+	indexCmd.Flags().IntVar(&opts.concurrency.MaxEmbedWorkers, "max-embed-workers", 0, "Upper bound for --adaptive-workers (default 32)")
+	indexCmd.Flags().IntVar(&opts.concurrency.BatchSize, "batch-size", 0, "Chunk writes per Redis round trip; 1 writes each chunk separately (default 64)")
+	indexCmd.Flags().StringVar(&opts.concurrency.WriteMode, "write-mode", "", "How batches are sent: pipeline or multi (MULTI/EXEC) (default pipeline)")
+	indexCmd.Flags().IntVar(&opts.shards, "shards", 0, "Split the index into N RediSearch indexes queried together (default: keep the existing layout)")
+	indexCmd.Flags().StringVar(&opts.shardBy, "shard-by", re_indexer.ShardByDir, "How files are assigned to shards: dir (top-level directory) or hash (file path)")
+	indexCmd.Flags().IntVar(&opts.shard, "shard", -1, "Only build this shard (0-based) of a sharded index")
+	indexCmd.MarkFlagsMutuallyExclusive("resume", "retry-failed", "force")
+	indexCmd.MarkFlagsMutuallyExclusive("dry-run", "resume", "retry-failed")
+
+	addIndexManagementCmds(indexCmd)
 
 	return indexCmd
 }
 
 // ===== Helpers =====
 
-func indexCodebase(dir, indexName string, force bool, model string, chunkSize, overlap int) {
+func indexCodebase(opts indexOptions) error {
+	// Human-readable messages go to stderr in JSON mode so stdout stays parseable
+	var info io.Writer = os.Stdout
+	if opts.jsonOutput {
+		info = os.Stderr
+	}
+
+	dir := opts.dir
 	if dir == "" {
 		dir = "."
 	}
 	absDir, err := filepath.Abs(dir)
 	if err != nil {
-		fmt.Printf("Error resolving directory: %v\n", err)
-		return
+		return fmt.Errorf("error resolving directory: %w", err)
+	}
+
+	cfg, err := config.Load(absDir)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Concurrency.Override(opts.concurrency).Validate(); err != nil {
+		return err
+	}
+	red, err := cfg.Redactor(absDir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = red.Close() }()
+	defer printRedactions(info, red)
+	ws, absDir, err := resolveWorkspace(absDir, opts.workspace)
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("Connecting to Redis...")
-	rdb := chunk_retriever.Connect()
-	if rdb == nil {
-		fmt.Println("Cannot connect to Redis.")
-		fmt.Println("Make sure Redis is running on localhost:6379 or set REDIS_ADDR environment variable.")
-		return
+	kind, err := storeKind(absDir)
+	if err != nil {
+		return err
+	}
+	if kind == chunk_retriever.StoreLocal {
+		// Shards, checkpoints and the retry queue live in Redis
+		switch {
+		case opts.shards > 0 || opts.shard >= 0:
+			return fmt.Errorf("--shards and --shard need the Redis store")
+		case opts.resume || opts.retryFailed:
+			return fmt.Errorf("--resume and --retry-failed need the Redis store; with the local store, run smartcli index --force again, which skips files whose chunks are unchanged")
+		}
+	} else {
+		fmt.Fprintln(info, "Connecting to Redis...")
+	}
+	store, err := openStore(absDir)
+	if err != nil {
+		if kind == chunk_retriever.StoreRedis {
+			fmt.Fprintln(info, "Make sure Redis is running, configure it with REDIS_URL, --redis-url or the redis section of .smartcli/config.json, or use --store local.")
+		}
+		return err
+	}
+	defer func() { _ = store.Close() }()
+	rdb := redisOf(store)
+	if rdb != nil {
+		fmt.Fprintln(info, "Redis connection OK")
 	}
-	defer func() { _ = rdb.Close() }()
-	fmt.Println("Redis connection OK")
 
 	// Ensure GCP credentials exist; mustGCP() will exit if missing.
 	_, _, creds := mustGCP()
 
-	ctx := context.Background()
-	emb, err := embedder.EmbedderClient(ctx, creds, rdb, model)
+	// Stop gracefully on Ctrl-C so the checkpoint and run state are recorded
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	emb, err := embedder.EmbedderClient(ctx, creds, rdb, opts.model)
 	if err != nil {
-		fmt.Printf("Error creating embedder: %v\n", err)
-		return
+		return fmt.Errorf("error creating embedder: %w", err)
 	}
 
 	// Build indexer (auto-derives index name from dir if not provided)
-	indexer := re_indexer.NewIndexer(rdb, emb, absDir, indexName)
+	indexer := re_indexer.NewIndexer(rdb, emb, absDir, opts.indexName)
+	indexer.Store = store
+	indexer.Policy = cfg.Policy()
+	indexer.Workspace = ws
+	indexer.Redactor = red
+	indexer.Concurrency = cfg.Concurrency.Override(opts.concurrency).Resolve()
+	emb.Policy = indexer.Policy
+	emb.Redactor = red
+	emb.Workers = indexer.Concurrency.EmbedWorkers
+	emb.BatchSize = indexer.Concurrency.BatchSize
+	if err := configureSource(ctx, info, indexer, ws, opts); err != nil {
+		return err
+	}
+	if local, ok := store.(*local_store.Store); ok {
+		if err := buildLocal(ctx, info, cfg, ws, indexer, local, opts); err != nil {
+			return err
+		}
+		fmt.Fprintln(info, "Indexing completed")
+		fmt.Fprintf(info, "You can now run:\n  smartcli review -f <file> -q \"what does this do?\"\n")
+		return nil
+	}
+	set, err := resolveShards(ctx, rdb, indexer.IndexName, opts)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		if err := buildIndex(ctx, info, cfg, ws, indexer, opts, ""); err != nil {
+			return err
+		}
+	} else if err := buildShards(ctx, info, cfg, ws, indexer, set, opts); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(info, "Indexing completed")
+	fmt.Fprintf(info, "You can now run:\n  smartcli review -f <file> -q \"what does this do?\"\n")
+	return nil
+}
+
+// resolveShards returns the shard layout to build name with, or nil for an
+// unsharded index. An existing layout is kept unless --shards changes it,
+// which needs --force because every shard is rebuilt.
+func resolveShards(ctx context.Context, rdb redis.UniversalClient, name string, opts indexOptions) (*index_meta.ShardSet, error) {
+	existing, err := index_meta.LoadShardSet(ctx, rdb, name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading shard set: %w", err)
+	}
+	set := existing
+	if opts.shards > 0 {
+		set = &index_meta.ShardSet{Name: name, Count: opts.shards, By: opts.shardBy}
+		changed := existing != nil && (existing.Count != set.Count || existing.By != set.By)
+		switch {
+		case changed && opts.shard >= 0:
+			return nil, fmt.Errorf("index %q is sharded %d ways by %s; a new layout must be built for all shards at once", name, existing.Count, existing.By)
+		case changed && !opts.force:
+			return nil, fmt.Errorf("index %q is sharded %d ways by %s; use --force to reshard it", name, existing.Count, existing.By)
+		case existing == nil && chunk_retriever.IndexExists(rdb, name) && !opts.force:
+			return nil, fmt.Errorf("index %q already exists unsharded; use --force to replace it with %d shards", name, set.Count)
+		}
+	}
+	if opts.shard >= 0 {
+		if set == nil {
+			return nil, fmt.Errorf("--shard needs a sharded index; create %q with --shards N", name)
+		}
+		if opts.shard >= set.Count {
+			return nil, fmt.Errorf("index %q has shards 0-%d, not %d", name, set.Count-1, opts.shard)
+		}
+	}
+	return set, nil
+}
+
+// buildShards builds every shard of set, or only --shard, each as its own
+// versioned index. Once a full build succeeds the layout is recorded and
+// whatever it replaces (an unsharded index, surplus shards) is dropped.
+func buildShards(ctx context.Context, info io.Writer, cfg *config.Config, ws *workspace.Workspace, indexer *re_indexer.Indexer, set *index_meta.ShardSet, opts indexOptions) error {
+	rdb := indexer.Redis
+	shards := make([]int, 0, set.Count)
+	if opts.shard >= 0 {
+		shards = append(shards, opts.shard)
+	} else {
+		for k := 0; k < set.Count; k++ {
+			shards = append(shards, k)
+		}
+	}
+	for _, k := range shards {
+		label := fmt.Sprintf("%d (of %d, by %s)", k, set.Count, set.By)
+		if err := buildIndex(ctx, info, cfg, ws, indexer.ForShard(set, k), opts, label); err != nil {
+			return fmt.Errorf("shard %d: %w", k, err)
+		}
+	}
+	if opts.shard >= 0 {
+		return nil
+	}
+
+	previous, err := index_meta.LoadShardSet(ctx, rdb, set.Name)
+	if err != nil {
+		return fmt.Errorf("error reading shard set: %w", err)
+	}
+	var stale []string
+	if previous == nil && chunk_retriever.IndexExists(rdb, set.Name) {
+		stale = append(stale, set.Name)
+	}
+	if previous != nil {
+		for k := set.Count; k < previous.Count; k++ {
+			if name := index_meta.ShardName(set.Name, k); chunk_retriever.IndexExists(rdb, name) {
+				stale = append(stale, name)
+			}
+		}
+	}
+	for _, name := range stale {
+		if _, err := index_manager.Drop(ctx, rdb, name); err != nil {
+			fmt.Fprintf(info, "Warning: could not remove %q, which the shards replace: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(info, "Removed %q, which the shards replace\n", name)
+	}
+	if err := index_meta.SaveShardSet(ctx, rdb, set); err != nil {
+		return fmt.Errorf("shards built but recording the layout failed: %w", err)
+	}
+	fmt.Fprintf(info, "Index %q is sharded %d ways by %s: %s\n", set.Name, set.Count, set.By, strings.Join(set.Shards(), ", "))
+	return nil
+}
+
+// buildIndex runs one build of indexer.IndexName: a fresh version, a resumed
+// run or a retry of failed chunks, activated when it succeeds. shard labels
+// the header when the index is one shard of a set.
+func buildIndex(ctx context.Context, info io.Writer, cfg *config.Config, ws *workspace.Workspace, indexer *re_indexer.Indexer, opts indexOptions, shard string) error {
+	alias := indexer.IndexName
+
+	state, err := re_indexer.LoadRunState(ctx, indexer.Redis, alias)
+	if err != nil {
+		return fmt.Errorf("error reading run state: %w", err)
+	}
+	live, _ := chunk_retriever.ResolveIndex(indexer.Redis, alias)
+
+	switch {
+	case opts.resume:
+		if state == nil {
+			return fmt.Errorf("no previous run found for index %q; run smartcli index first", alias)
+		}
+		switch state.Status {
+		case re_indexer.RunComplete:
+			fmt.Fprintf(info, "The last run of %q completed; nothing to resume.\n", alias)
+			return nil
+		case re_indexer.RunBuilt:
+			fmt.Fprintf(info, "Version %q is fully built but was not activated because of failures. Run `smartcli index --retry-failed`.\n", state.Target)
+			return nil
+		}
+		if state.Root != "" && state.Root != indexer.Root {
+			return fmt.Errorf("index %q was being built from %s, not %s; use --dir %s to resume", alias, state.Root, indexer.Root, state.Root)
+		}
+		// Chunk boundaries must match the interrupted run
+		if state.ChunkSize > 0 {
+			opts.chunkSize, opts.overlap = state.ChunkSize, state.Overlap
+		}
+		indexer.Target = state.Target
+		indexer.Resume = true
+
+	case opts.retryFailed:
+		// Retry into a built-but-inactive version if there is one, else into the live index
+		indexer.Target = live
+		if state != nil && state.Status == re_indexer.RunBuilt {
+			indexer.Target = state.Target
+		}
+		if indexer.Target == "" {
+			return fmt.Errorf("index %q does not exist; run smartcli index first", alias)
+		}
+
+	default:
+		// Detect an existing index with the same derived/default name and bail unless --force
+		if !opts.force && chunk_retriever.IndexExists(indexer.Redis, alias) {
+			fmt.Fprintf(info, "Index %q already exists. Use --force to re-index.\n", alias)
+			return nil
+		}
+		// A new run abandons any unfinished version from an earlier one
+		if state != nil && state.Target != "" && state.Target != live && chunk_retriever.IndexExists(indexer.Redis, state.Target) {
+			if _, err := index_manager.Drop(ctx, indexer.Redis, state.Target); err != nil {
+				fmt.Fprintf(info, "Warning: could not remove abandoned version %q: %v\n", state.Target, err)
+			}
+		}
+		// Build into a fresh version; queries keep using the live one meanwhile
+		indexer.Target = re_indexer.NewVersionName(alias)
+	}
+
+	printIndexHeader(info, cfg, ws, indexer, opts, shard)
+	if opts.jsonOutput {
+		indexer.Progress = progress.New(os.Stdout, progress.JSON)
+	} else {
+		indexer.Progress = progress.New(os.Stdout, progress.Text)
+	}
+
+	var summary progress.Summary
+	if opts.retryFailed {
+		queued, err := re_indexer.FailedCount(ctx, indexer.Redis, indexer.Target)
+		if err != nil {
+			return fmt.Errorf("error reading failed-chunk queue: %w", err)
+		}
+		if queued == 0 && indexer.Target == live {
+			fmt.Fprintf(info, "No failed chunks queued for %q.\n", alias)
+			return nil
+		}
+		summary, err = indexer.RetryFailed(ctx)
+	} else {
+		summary, err = indexer.ReIndexDirectory(ctx, indexer.Root, opts.chunkSize, opts.overlap)
+	}
+	if !opts.jsonOutput {
+		printSummary(summary)
+	}
+	if err != nil {
+		if ctx.Err() != nil && !opts.retryFailed {
+			fmt.Fprintln(info, "Indexing interrupted. Run `smartcli index --resume` to continue.")
+		}
+		return fmt.Errorf("indexing failed: %w", err)
+	}
+	if queued, err := re_indexer.FailedCount(ctx, indexer.Redis, indexer.Target); err == nil && queued > 0 {
+		fmt.Fprintf(info, "%d chunks are queued for retry. Run `smartcli index --retry-failed` to re-process them.\n", queued)
+	}
+	if opts.tooManyFailures(summary) {
+		// A first build has no previous version to fall back to
+		if live == "" {
+			if err := activateVersion(ctx, info, indexer); err != nil {
+				return err
+			}
+		} else if indexer.Target != live {
+			fmt.Fprintf(info, "Version %q was not activated; queries still use the previous index.\n", indexer.Target)
+		}
+		return fmt.Errorf("indexing finished with %d failures (max allowed %d)", summary.Failures(), opts.maxFailures)
+	}
+
+	if indexer.Target != live {
+		if err := activateVersion(ctx, info, indexer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printIndexHeader prints the settings of a build of indexer.IndexName.
+func printIndexHeader(info io.Writer, cfg *config.Config, ws *workspace.Workspace, indexer *re_indexer.Indexer, opts indexOptions, shard string) {
+	fmt.Fprintln(info, "-------------------------------------------------")
+	fmt.Fprintf(info, "Indexing directory: %s\n", indexer.Root)
+	fmt.Fprintf(info, "Index name:        %s\n", indexer.IndexName)
+	if shard != "" {
+		fmt.Fprintf(info, "Shard:             %s\n", shard)
+	}
+	if ws != nil {
+		fmt.Fprintf(info, "Workspace:         %s (%d modules)\n", ws.Source, len(ws.Modules))
+		for _, m := range ws.Modules {
+			fmt.Fprintf(info, "  - %s (%s)\n", m.Name, m.Rel)
+		}
+	}
+	if indexer.Target != "" {
+		fmt.Fprintf(info, "Index version:     %s\n", indexer.Target)
+	}
+	if opts.model != "" {
+		fmt.Fprintf(info, "Embedding model:   %s\n", opts.model)
+	} else {
+		fmt.Fprintf(info, "Embedding model:   (default)\n")
+	}
+	fmt.Fprintf(info, "Chunk size:        %d\n", opts.chunkSize)
+	fmt.Fprintf(info, "Overlap:           %d\n", opts.overlap)
+	workers := indexer.Concurrency
+	if workers.Adaptive {
+		fmt.Fprintf(info, "Workers:           %d file, %d embed (adaptive %d-%d)\n",
+			workers.FileWorkers, workers.EmbedWorkers, workers.MinEmbedWorkers, workers.MaxEmbedWorkers)
+	} else {
+		fmt.Fprintf(info, "Workers:           %d file, %d embed\n", workers.FileWorkers, workers.EmbedWorkers)
+	}
+	if indexer.Redis != nil {
+		fmt.Fprintf(info, "Redis writes:      %s, batches of %d\n", workers.WriteMode, workers.BatchSize)
+	} else if local, ok := indexer.Store.(*local_store.Store); ok {
+		fmt.Fprintf(info, "Local store:       %s\n", local.Dir())
+	}
+	if cfg.Path() != "" {
+		fmt.Fprintf(info, "Config:            %s\n", cfg.Path())
+	}
+	if indexer.Redactor == nil {
+		fmt.Fprintf(info, "Redaction:         disabled\n")
+	}
+	if opts.force {
+		fmt.Fprintf(info, "Force re-index:    %v\n", opts.force)
+	}
+	if opts.resume {
+		fmt.Fprintf(info, "Resuming:          %v\n", opts.resume)
+	}
+	if opts.retryFailed {
+		fmt.Fprintf(info, "Retry failed only: %v\n", opts.retryFailed)
+	}
+	fmt.Fprintln(info, "-------------------------------------------------")
+}
 
-	// Detect an existing index with the same derived/default name and bail unless --force
-	if !force {
-		if existing, err := chunk_retriever.GetIndexName(rdb); err == nil && existing == indexer.IndexName {
-			fmt.Printf("Index %q already exists. Use --force to re-index.\n", existing)
-			return
+// buildLocal builds indexer.IndexName in the local store. Runs are
+// incremental: files whose chunks are unchanged are skipped, changed files
+// have their chunks overwritten and files that are gone are pruned, so there
+// are no versions to activate.
+func buildLocal(ctx context.Context, info io.Writer, cfg *config.Config, ws *workspace.Workspace, indexer *re_indexer.Indexer, store *local_store.Store, opts indexOptions) error {
+	name := indexer.IndexName
+	if store.Exists(ctx, name) {
+		if !opts.force {
+			fmt.Fprintf(info, "Index %q already exists. Use --force to re-index.\n", name)
+			return nil
+		}
+		// Chunks of another model or chunking cannot share the index; start over
+		meta, err := store.LoadMeta(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to load index metadata: %w", err)
+		}
+		next := &index_meta.Metadata{Model: indexer.Embedder.Model, Chunker: chunker.Strategy, ChunkSize: opts.chunkSize, Overlap: opts.overlap}
+		if meta != nil && meta.CheckBuild(name, next) != nil {
+			if err := store.Drop(name); err != nil {
+				return fmt.Errorf("failed to drop index %q: %w", name, err)
+			}
 		}
 	}
 
-	fmt.Println("-------------------------------------------------")
-	fmt.Printf("Indexing directory: %s\n", absDir)
-	fmt.Printf("Index name:        %s\n", indexer.IndexName)
-	if model != "" {
-		fmt.Printf("Embedding model:   %s\n", model)
+	printIndexHeader(info, cfg, ws, indexer, opts, "")
+	if opts.jsonOutput {
+		indexer.Progress = progress.New(os.Stdout, progress.JSON)
 	} else {
-		fmt.Printf("Embedding model:   (default)\n")
+		indexer.Progress = progress.New(os.Stdout, progress.Text)
+	}
+
+	summary, err := indexer.ReIndexDirectory(ctx, indexer.Root, opts.chunkSize, opts.overlap)
+	if !opts.jsonOutput {
+		printSummary(summary)
+	}
+	// Chunks stored before a failure or Ctrl-C are kept for the next run
+	if ferr := store.Flush(); ferr != nil {
+		return fmt.Errorf("failed to write %s: %w", store.Dir(), ferr)
+	}
+	if err != nil {
+		return fmt.Errorf("indexing failed: %w", err)
+	}
+	if opts.tooManyFailures(summary) {
+		return fmt.Errorf("indexing finished with %d failures (max allowed %d)", summary.Failures(), opts.maxFailures)
+	}
+	fmt.Fprintf(info, "Index %q written to %s\n", name, store.Dir())
+	return nil
+}
+
+// tooManyFailures reports whether a run failed more files and chunks than
+// --max-failures allows; a negative limit allows any number.
+func (o indexOptions) tooManyFailures(s progress.Summary) bool {
+	return o.maxFailures >= 0 && s.Failures() > o.maxFailures
+}
+
+// resolveWorkspace returns the workspace to index and the directory to index
+// from. Workspace mode applies with --workspace, or when dir is itself the
+// root of a go.work workspace.
+func resolveWorkspace(dir string, requested bool) (*workspace.Workspace, string, error) {
+	ws, err := workspace.Find(dir)
+	if err != nil {
+		return nil, dir, fmt.Errorf("error reading workspace: %w", err)
+	}
+	if ws == nil {
+		if requested {
+			return nil, dir, fmt.Errorf("no %s or workspace.modules config found at or above %s", workspace.WorkFile, dir)
+		}
+		return nil, dir, nil
+	}
+	if !requested && ws.Root != dir {
+		return nil, dir, nil
+	}
+	return ws, ws.Root, nil
+}
+
+// configureSource points indexer at the dependency or history index when
+// --deps or --history is set.
+func configureSource(ctx context.Context, info io.Writer, indexer *re_indexer.Indexer, ws *workspace.Workspace, opts indexOptions) error {
+	switch {
+	case opts.deps:
+		return configureDeps(info, indexer, ws)
+	case opts.history:
+		return configureHistory(ctx, info, indexer, opts.historyMax)
+	}
+	return nil
+}
+
+// configureHistory points indexer at the history index: one document per
+// commit message and per changed file's diff, read from git log.
+func configureHistory(ctx context.Context, info io.Writer, indexer *re_indexer.Indexer, limit int) error {
+	commits, err := git_history.Log(ctx, indexer.Root, limit)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("no commits found in %s", indexer.Root)
+	}
+	// Only diffs of files the project would index are worth embedding
+	policy := indexer.Policy
+	docs := git_history.Documents(commits, policy.AllowFile)
+	byID := make(map[string]git_history.Document, len(docs))
+	for _, d := range docs {
+		byID[d.ID] = d
+	}
+	fmt.Fprintf(info, "Git history:       %d commits, %d documents\n", len(commits), len(docs))
+
+	indexer.IndexName = git_history.IndexName(indexer.IndexName)
+	indexer.Workspace = nil
+	indexer.Source = git_history.Source
+	indexer.Discover = func(ctx context.Context, emit func(string) error) error {
+		for _, d := range docs {
+			if err := emit(d.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	indexer.Extract = func(id string) (string, error) {
+		d, ok := byID[id]
+		if !ok {
+			return "", fmt.Errorf("commit document %s is no longer in the history", id)
+		}
+		return d.Text, nil
+	}
+	indexer.Fields = func(id string) map[string]string {
+		return byID[id].Fields
+	}
+	return nil
+}
+
+// configureDeps points indexer at the dependency index: the modules required
+// by the project's go.mod files (every workspace module's, or the nearest
+// one), read from the module cache and reduced to their exported API.
+func configureDeps(info io.Writer, indexer *re_indexer.Indexer, ws *workspace.Workspace) error {
+	var gomods []string
+	local := map[string]struct{}{}
+	if ws != nil {
+		for _, m := range ws.Modules {
+			gomods = append(gomods, filepath.Join(m.Dir, "go.mod"))
+			local[m.Name] = struct{}{}
+		}
+	} else if gomod := findGoMod(indexer.Root); gomod != "" {
+		gomods = append(gomods, gomod)
+	} else {
+		return fmt.Errorf("--deps needs a go.mod at or above %s", indexer.Root)
+	}
+
+	cache := go_deps.ModCache()
+	seen := map[string]struct{}{}
+	var mods []go_deps.Module
+	for _, gomod := range gomods {
+		found, missing, err := go_deps.Resolve(gomod, cache, false)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", gomod, err)
+		}
+		for _, m := range missing {
+			fmt.Fprintf(info, "Warning: %s is not in the module cache (run `go mod download`); skipping\n", m.ID())
+		}
+		for _, m := range found {
+			if _, ok := local[m.Path]; ok {
+				continue // workspace modules are indexed as project code
+			}
+			if _, ok := seen[m.ID()]; ok {
+				continue
+			}
+			seen[m.ID()] = struct{}{}
+			mods = append(mods, m)
+		}
+	}
+	if len(mods) == 0 {
+		return fmt.Errorf("no dependencies found in the module cache %s", cache)
+	}
+	fmt.Fprintf(info, "Dependencies:      %d modules from %s\n", len(mods), cache)
+
+	indexer.IndexName = go_deps.IndexName(indexer.IndexName)
+	indexer.Root = cache
+	indexer.Workspace = go_deps.Workspace(cache, mods)
+	indexer.Policy = go_deps.Policy()
+	indexer.Extract = go_deps.ExportedAPI
+	indexer.Source = go_deps.Source
+	return nil
+}
+
+// findGoMod returns the nearest go.mod at or above dir, or "".
+func findGoMod(dir string) string {
+	for curr := dir; ; {
+		p := filepath.Join(curr, "go.mod")
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		parent := filepath.Dir(curr)
+		if parent == curr {
+			return ""
+		}
+		curr = parent
+	}
+}
+
+// dryRunIndex walks and chunks the directory like a real run and prints size
+// and cost estimates. It needs neither Redis nor GCP credentials.
+func dryRunIndex(cmd *cobra.Command, opts indexOptions) error {
+	dir := opts.dir
+	if dir == "" {
+		dir = "."
 	}
-	fmt.Printf("Chunk size:        %d\n", chunkSize)
-	fmt.Printf("Overlap:           %d\n", overlap)
-	if force {
-		fmt.Printf("Force re-index:    %v\n", force)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("error resolving directory: %w", err)
+	}
+	cfg, err := config.Load(absDir)
+	if err != nil {
+		return err
+	}
+	ws, absDir, err := resolveWorkspace(absDir, opts.workspace)
+	if err != nil {
+		return err
 	}
-	fmt.Println("-------------------------------------------------")
 
-	if err := indexer.ReIndexDirectory(ctx, absDir, chunkSize, overlap); err != nil {
-		fmt.Printf("Indexing failed: %v\n", err)
-		return
+	// Config prices apply unless overridden on the command line
+	pricing := opts.pricing
+	if p := cfg.Pricing.PerThousandChars; p > 0 && !cmd.Flags().Changed("price-per-1k-chars") {
+		pricing.PerThousandChars = p
+	}
+	if p := cfg.Pricing.PerMillionTokens; p > 0 && !cmd.Flags().Changed("price-per-1m-tokens") {
+		pricing.PerMillionTokens = p
 	}
 
-	fmt.Println("Indexing completed")
-	fmt.Printf("You can now run:\n  smartcli review -f <file> -q \"what does this do?\"\n")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	indexer := re_indexer.NewIndexer(nil, nil, absDir, opts.indexName)
+	indexer.Policy = cfg.Policy()
+	indexer.Workspace = ws
+	// Count what would be redacted without writing the audit log
+	if !cfg.Redaction.Disabled {
+		if indexer.Redactor, err = redactor.New(cfg.Redaction, ""); err != nil {
+			return err
+		}
+	}
+	if err := configureSource(ctx, os.Stderr, indexer, ws, opts); err != nil {
+		return err
+	}
+	report, err := indexer.DryRun(ctx, indexer.Root, opts.chunkSize, opts.overlap, pricing, opts.top)
+	if err != nil {
+		return fmt.Errorf("dry run failed: %w", err)
+	}
+
+	if opts.jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printDryRun(report, indexer.IndexName, opts)
+	return nil
+}
+
+func printDryRun(r *re_indexer.DryRunReport, name string, opts indexOptions) {
+	fmt.Println("===== Dry run (nothing was embedded or stored) =====")
+	fmt.Printf("Directory:  %s\n", r.Root)
+	fmt.Printf("Index name: %s\n", name)
+	fmt.Printf("Chunking:   size %d, overlap %d\n", opts.chunkSize, opts.overlap)
+	fmt.Println()
+	fmt.Printf("%-12s %8s %10s %14s\n", "LANGUAGE", "FILES", "CHUNKS", "CHARS")
+	for _, l := range r.ByLanguage {
+		fmt.Printf("%-12s %8d %10d %14d\n", l.Language, l.Files, l.Chunks, l.Chars)
+	}
+	fmt.Printf("%-12s %8d %10d %14d\n", "TOTAL", r.Files, r.Chunks, r.Chars)
+	if r.FilesFailed > 0 {
+		fmt.Printf("Unreadable files: %d\n", r.FilesFailed)
+	}
+	fmt.Println()
+	fmt.Printf("Estimated input tokens: ~%d (about %d chars per token)\n", r.EstimatedTokens, re_indexer.CharsPerToken)
+	fmt.Printf("Estimated cost:         $%.4f", r.EstimatedCost)
+	fmt.Printf(" (at $%g per 1k chars", r.Pricing.PerThousandChars)
+	if r.Pricing.PerMillionTokens > 0 {
+		fmt.Printf(" + $%g per 1M tokens", r.Pricing.PerMillionTokens)
+	}
+	fmt.Println(")")
+	if len(r.Redactions) > 0 {
+		var kinds []string
+		for kind, n := range r.Redactions {
+			kinds = append(kinds, fmt.Sprintf("%s %d", kind, n))
+		}
+		sort.Strings(kinds)
+		fmt.Printf("Would redact:           %s\n", strings.Join(kinds, ", "))
+	}
+	if len(r.Largest) > 0 {
+		fmt.Println()
+		fmt.Println("Largest contributors:")
+		for _, f := range r.Largest {
+			share := 0.0
+			if r.Chars > 0 {
+				share = float64(f.Chars) / float64(r.Chars) * 100
+			}
+			rel, err := filepath.Rel(r.Root, f.Path)
+			if err != nil {
+				rel = f.Path
+			}
+			fmt.Printf("  %5.1f%%  %6d chunks  %s\n", share, f.Chunks, rel)
+		}
+	}
+}
+
+// activateVersion points the alias at the freshly built version and
+// garbage-collects the version it replaced.
+func activateVersion(ctx context.Context, info io.Writer, indexer *re_indexer.Indexer) error {
+	previous, err := indexer.Activate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to activate %q: %w", indexer.Target, err)
+	}
+	fmt.Fprintf(info, "Alias %q now points at %q\n", indexer.IndexName, indexer.Target)
+	if previous == "" {
+		return nil
+	}
+	if _, err := index_manager.Drop(ctx, indexer.Redis, previous); err != nil {
+		fmt.Fprintf(info, "Warning: could not remove previous version %q: %v\n", previous, err)
+		return nil
+	}
+	fmt.Fprintf(info, "Removed previous version %q\n", previous)
+	return nil
+}
+
+// printSummary prints the run summary for terminal output.
+func printSummary(s progress.Summary) {
+	fmt.Println("===== Index summary =====")
+	fmt.Printf("Files:   %d discovered, %d chunked, %d skipped, %d failed\n",
+		s.FilesDiscovered, s.FilesChunked, s.FilesSkipped, s.FilesFailed)
+	fmt.Printf("Chunks:  %d discovered, %d embedded, %d stored, %d failed\n",
+		s.ChunksDiscovered, s.ChunksEmbedded, s.ChunksStored, s.ChunksFailed)
+	fmt.Printf("Elapsed: %.1fs (%.1f chunks/s)\n", s.DurationSeconds, s.ChunksPerSecond)
+	if w := s.Workers; w != nil {
+		files := ""
+		if w.Files > 0 {
+			files = fmt.Sprintf("%d file, ", w.Files)
+		}
+		if w.Adaptive {
+			fmt.Printf("Workers: %s%d embed (adaptive: started at %d, ranged %d-%d, %d adjustments)\n",
+				files, w.Embed, w.EmbedInitial, w.EmbedLow, w.EmbedHigh, w.EmbedAdjustments)
+		} else {
+			fmt.Printf("Workers: %s%d embed\n", files, w.Embed)
+		}
+	}
+	if w := s.Writes; w != nil && w.Batches > 0 {
+		fmt.Printf("Writes:  %d chunks in %d %s batches of up to %d, %.2fs in Redis (%.0f chunks/s)",
+			w.Commands, w.Batches, w.Mode, w.BatchSize, w.Seconds, w.CommandsPerSecond)
+		if w.Failed > 0 {
+			fmt.Printf(", %d failed", w.Failed)
+		}
+		fmt.Println()
+	}
+	if s.ErrorsTruncated > 0 {
+		fmt.Printf("Errors:  %d shown above, %d more not shown\n", len(s.Errors), s.ErrorsTruncated)
+	}
 }
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/index_manager"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/re_indexer"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// addIndexManagementCmds registers list/info/drop/rename/export/import under
+// `smartcli index`.
+func addIndexManagementCmds(indexCmd *cobra.Command) {
+	indexCmd.AddCommand(createIndexListCmd())
+	indexCmd.AddCommand(createIndexInfoCmd())
+	indexCmd.AddCommand(createIndexDropCmd())
+	indexCmd.AddCommand(createIndexRenameCmd())
+	indexCmd.AddCommand(createIndexExportCmd())
+	indexCmd.AddCommand(createIndexImportCmd())
+}
+
+func createIndexListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "list",
+		Short:        "List all indexes",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rdb, err := requireRedis("index list")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = rdb.Close() }()
+
+			infos, err := index_manager.List(context.Background(), rdb)
+			if err != nil {
+				return fmt.Errorf("error listing indexes: %w", err)
+			}
+			if len(infos) == 0 {
+				fmt.Println("No indexes found. Run: smartcli index")
+				return nil
+			}
+			fmt.Printf("%-24s %-32s %10s %10s  %s\n", "NAME", "INDEX", "DOCS", "MEMORY", "ROOT")
+			for _, in := range infos {
+				name := "-"
+				if len(in.Aliases) > 0 {
+					name = strings.Join(in.Aliases, ",")
+				}
+				root := "-"
+				if in.Meta != nil && in.Meta.Root != "" {
+					root = in.Meta.Root
+				} else if in.Run != nil && in.Run.Root != "" {
+					root = in.Run.Root
+				}
+				fmt.Printf("%-24s %-32s %10d %8.2fMB  %s\n", name, in.IndexName, in.NumDocs, in.MemoryMB, root)
+			}
+			return nil
+		},
+	}
+}
+
+func createIndexInfoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "info <name>",
+		Short:        "Show statistics and smartcli metadata for an index",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rdb, err := requireRedis("index info")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = rdb.Close() }()
+
+			ctx := context.Background()
+
+			set, err := index_meta.LoadShardSet(ctx, rdb, args[0])
+			if err != nil {
+				return err
+			}
+			if set == nil {
+				in, err := index_manager.GetInfo(ctx, rdb, args[0])
+				if err != nil {
+					return err
+				}
+				printIndexInfo(in)
+				return nil
+			}
+
+			fmt.Printf("Sharded index %q: %d shards by %s\n", set.Name, set.Count, set.By)
+			for _, shard := range set.Shards() {
+				fmt.Println()
+				in, err := index_manager.GetInfo(ctx, rdb, shard)
+				if err != nil {
+					fmt.Printf("Name:            %s\n", shard)
+					fmt.Printf("Error:           %v\n", err)
+					continue
+				}
+				printIndexInfo(in)
+			}
+			return nil
+		},
+	}
+}
+
+func createIndexDropCmd() *cobra.Command {
+	var yes bool
+	dropCmd := &cobra.Command{
+		Use:          "drop <name>",
+		Short:        "Delete an index and all of its documents",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			rdb, err := requireRedis("index drop")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = rdb.Close() }()
+			ctx := context.Background()
+
+			set, err := index_meta.LoadShardSet(ctx, rdb, name)
+			if err != nil {
+				return err
+			}
+			var warning string
+			if set != nil {
+				warning = fmt.Sprintf("This deletes sharded index %q: %d shards (%s) and all of their documents.",
+					name, set.Count, strings.Join(set.Shards(), ", "))
+			} else {
+				in, err := index_manager.GetInfo(ctx, rdb, name)
+				if err != nil {
+					return err
+				}
+				warning = fmt.Sprintf("This deletes index %q and its %d documents (prefixes: %s).",
+					name, in.NumDocs, strings.Join(in.Prefixes, ", "))
+			}
+			if !yes {
+				fmt.Println(warning)
+				if !confirm(fmt.Sprintf("Type %q to confirm: ", name), name) {
+					fmt.Println("Aborted.")
+					return nil
+				}
+			}
+
+			deleted, err := index_manager.Drop(ctx, rdb, name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Dropped index %q (%d keys deleted)\n", name, deleted)
+			return nil
+		},
+	}
+	dropCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+	return dropCmd
+}
+
+func createIndexRenameCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "rename <old> <new>",
+		Short:        "Rename an index or alias, moving its keys to the new prefix",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rdb, err := requireRedis("index rename")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = rdb.Close() }()
+
+			moved, err := index_manager.Rename(context.Background(), rdb, args[0], args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Renamed %q to %q (%d keys moved)\n", args[0], args[1], moved)
+			return nil
+		},
+	}
+}
+
+func createIndexExportCmd() *cobra.Command {
+	var name, root string
+	exportCmd := &cobra.Command{
+		Use:          "export <file>",
+		Short:        "Write an index's chunks, vectors and metadata to a snapshot archive",
+		Example:      "  smartcli index export myrepo.smartcli.gz --name myrepo_index",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rdb, err := requireRedis("index export")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = rdb.Close() }()
+
+			if name == "" {
+				var err error
+				if name, err = chunk_retriever.GetIndexName(rdb); err != nil {
+					return err
+				}
+			}
+
+			if root != "" {
+				if root, err = filepath.Abs(root); err != nil {
+					return fmt.Errorf("error resolving root: %w", err)
+				}
+			}
+
+			f, err := os.Create(args[0])
+			if err != nil {
+				return fmt.Errorf("error creating snapshot: %w", err)
+			}
+			m, err := index_manager.Export(context.Background(), rdb, name, root, f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(args[0])
+				return fmt.Errorf("export failed: %w", err)
+			}
+			fmt.Printf("Exported %d chunks of %q (%s, %d dims) to %s\n", m.Chunks, name, m.Model, m.Dim, args[0])
+			return nil
+		},
+	}
+	exportCmd.Flags().StringVarP(&name, "name", "n", "", "Index to export (defaults to the current project's index)")
+	exportCmd.Flags().StringVar(&root, "root", "", "Checkout the index was built from (defaults to the root recorded in its metadata)")
+	return exportCmd
+}
+
+func createIndexImportCmd() *cobra.Command {
+	var name, root string
+	var force bool
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Recreate an index from a snapshot archive",
+		Long: `Recreate an index from a snapshot written by 'smartcli index export'.
+Stored paths are relative to the exported root and are remapped to --root.`,
+		Example:      "  smartcli index import myrepo.smartcli.gz --root ~/src/myrepo",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if root == "" {
+				root = "."
+			}
+			absRoot, err := filepath.Abs(root)
+			if err != nil {
+				return fmt.Errorf("error resolving root: %w", err)
+			}
+
+			rdb, err := requireRedis("index import")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = rdb.Close() }()
+			ctx := context.Background()
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("error opening snapshot: %w", err)
+			}
+			defer func() { _ = f.Close() }()
+
+			m, target, err := index_manager.Import(ctx, rdb, f, index_manager.ImportOptions{
+				Name:  name,
+				Root:  absRoot,
+				Force: force,
+			})
+			if err != nil {
+				return fmt.Errorf("import failed: %w", err)
+			}
+			if name == "" {
+				name = m.Index
+			}
+			fmt.Printf("Imported %d chunks (%s, %d dims) into %q\n", m.Chunks, m.Model, m.Dim, target)
+
+			indexer := re_indexer.NewIndexer(rdb, nil, absRoot, name)
+			indexer.Target = target
+			return activateVersion(ctx, os.Stdout, indexer)
+		},
+	}
+	importCmd.Flags().StringVarP(&name, "name", "n", "", "Index name to import into (defaults to the exported name)")
+	importCmd.Flags().StringVar(&root, "root", "", "Local checkout the snapshot's paths are relative to (defaults to current directory)")
+	importCmd.Flags().BoolVarP(&force, "force", "f", false, "Replace an existing index with the same name")
+	return importCmd
+}
+
+// ===== Helpers =====
+
+func printIndexInfo(in *index_manager.Info) {
+	fmt.Printf("Name:            %s\n", in.Name)
+	if in.IsAlias() {
+		fmt.Printf("Alias of:        %s\n", in.IndexName)
+	} else if len(in.Aliases) > 0 {
+		fmt.Printf("Aliases:         %s\n", strings.Join(in.Aliases, ", "))
+	}
+	fmt.Printf("Documents:       %d\n", in.NumDocs)
+	fmt.Printf("Memory:          %.2f MB\n", in.MemoryMB)
+	fmt.Printf("Vector dim:      %d\n", in.VectorDim)
+	fmt.Printf("Distance metric: %s\n", in.DistanceMetric)
+	fmt.Printf("Key prefixes:    %s\n", strings.Join(in.Prefixes, ", "))
+	if m := in.Meta; m != nil {
+		fmt.Printf("Embedding model: %s\n", m.Model)
+		fmt.Printf("Chunker:         %s (size %d, overlap %d)\n", m.Chunker, m.ChunkSize, m.Overlap)
+		fmt.Printf("Root:            %s\n", m.Root)
+		fmt.Printf("Created:         %s\n", m.CreatedAt)
+		fmt.Printf("Metadata hash:   %s (schema v%d)\n", m.Hash(), m.Version)
+	} else {
+		fmt.Println("Metadata:        none (built by an older smartcli; re-index to record it)")
+	}
+	if in.Run != nil {
+		fmt.Printf("Last run:        %s\n", in.Run.Status)
+	}
+	fmt.Printf("Failed chunks:   %d\n", in.FailedChunks)
+}
+
+// confirm prompts on stdin and reports whether the answer equals want.
+func confirm(prompt, want string) bool {
+	fmt.Print(prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(line) == want
+}
@@ -41,7 +41,7 @@ func checkCreds() {
 	}
 	if !allSet {
 		fmt.Println("\nMissing required environment variables!")
-		fmt.Println("Please set the following in your shell or .env file:\n")
+		fmt.Print("Please set the following in your shell or .env file:\n\n")
 
 		if vars["GCP_PROJECT_ID"] == "" {
 			fmt.Println(`export GCP_PROJECT_ID="your-gcp-project-id"`)
@@ -60,21 +60,33 @@ func checkCreds() {
 func setupSmartCLI() {
 	checkCreds()
 
-	// Check Redis connection
-	fmt.Println("\n🔧 Checking Redis connection...")
-	rdb := chunk_retriever.Connect()
-	if rdb == nil {
-		fmt.Println("Cannot connect to Redis")
+	kind, err := storeKind(".")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if kind == chunk_retriever.StoreRedis {
+		fmt.Println("\n🔧 Checking Redis connection...")
+	}
+	store, err := openStore(".")
+	if err != nil {
+		fmt.Printf("Cannot connect to Redis: %v\n", err)
 		fmt.Println("Make sure Redis is running on localhost:6379")
-		fmt.Println("Or set REDIS_ADDR environment variable")
+		fmt.Println("Or set REDIS_URL (or REDIS_ADDR and REDIS_PASSWORD), pass --redis-url,")
+		fmt.Println("or add a redis section to .smartcli/config.json")
+		fmt.Println("To run without Redis, pass --store local or set \"store\": \"local\" in the config")
 		return
 	}
-	defer func() { _ = rdb.Close() }()
-	fmt.Println("Redis connection successful")
+	defer func() { _ = store.Close() }()
+	if redisOf(store) != nil {
+		fmt.Println("Redis connection successful")
+	} else {
+		fmt.Println("\nUsing the local store; no Redis needed")
+	}
 
 	// Check if index exists
 	fmt.Println("\nChecking for existing index...")
-	indexName, err := chunk_retriever.GetIndexName(rdb)
+	indexName, err := chunk_retriever.ResolveIndexName(store)
 	if err != nil || indexName == "" {
 		fmt.Println("No index found - you'll need to create one")
 		fmt.Println("\n Next steps:")
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"smart-cli/go-backend/config"
+	"smart-cli/go-backend/generator"
+	"smart-cli/go-backend/redactor"
+)
+
+// loadRedactor returns the redactor configured for the project containing
+// dir, or nil when redaction is disabled. An unreadable config falls back to
+// the built-in detectors rather than sending content unredacted.
+func loadRedactor(dir string) (*redactor.Redactor, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(absDir)
+	if err != nil {
+		fmt.Printf("Warning: %v; using default redaction\n", err)
+		cfg = &config.Config{}
+	}
+	return cfg.Redactor(absDir)
+}
+
+// newAgent creates the answer generator with the project's redactor applied
+// to every prompt. The caller must call the returned func to close the
+// redactor's audit log once the generator is done.
+func newAgent(ctx context.Context) (*generator.Generator, func() error, error) {
+	red, err := loadRedactor(".")
+	if err != nil {
+		return nil, nil, err
+	}
+	gen, err := generator.NewAgent(ctx, "gemini-2.5-flash")
+	if err != nil {
+		_ = red.Close()
+		return nil, nil, err
+	}
+	gen.Redactor = red
+	return gen, red.Close, nil
+}
+
+// printRedactions reports how many secrets were redacted, by kind.
+func printRedactions(w io.Writer, red *redactor.Redactor) {
+	counts := red.Counts()
+	if len(counts) == 0 {
+		return
+	}
+	total := 0
+	var kinds []string
+	for kind, n := range counts {
+		total += n
+		kinds = append(kinds, fmt.Sprintf("%s %d", kind, n))
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(w, "Redacted %d secrets (%s)", total, strings.Join(kinds, ", "))
+	if p := red.AuditPath(); p != "" {
+		fmt.Fprintf(w, "; see %s", p)
+	}
+	fmt.Fprintln(w)
+}
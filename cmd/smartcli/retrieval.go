@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/concurrency"
+	"smart-cli/go-backend/config"
+	"smart-cli/go-backend/embedder"
+	"smart-cli/go-backend/generator"
+	"smart-cli/go-backend/go_deps"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/reranker"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// retrievalOptions are the flags shared by the commands that retrieve
+// context from the index.
+type retrievalOptions struct {
+	mode         string
+	vectorWeight float64
+	textWeight   float64
+	rerank       string
+	candidates   int
+	mmrLambda    float64
+	expand       int
+	neighbors    int
+	debug        bool
+	// workers is --retrieval-workers and limits are the --top-k,
+	// --max-distance and --adaptive-top-k flags, both merged with the config
+	// by validate
+	workers int
+	limits  config.Retrieval
+}
+
+func addRetrievalFlags(cmd *cobra.Command, opts *retrievalOptions) {
+	cmd.Flags().IntVar(&opts.limits.TopK, "top-k", 0, "Number of chunks to retrieve; 0 uses the retrieval.top_k config, else 10")
+	cmd.Flags().Float64Var(&opts.limits.MaxDistance, "max-distance", 0, "Drop chunks whose cosine distance to the question is larger, 0-2 (defaults to retrieval.max_distance config, else keeps all)")
+	cmd.Flags().BoolVar(&opts.limits.Adaptive, "adaptive-top-k", false, "Cut the chunks at the largest jump in distance, keeping only the clearly relevant ones")
+	cmd.Flags().StringVar(&opts.mode, "retrieval", chunk_retriever.ModeHybrid, "Retrieval mode: hybrid (full-text and vector, fused), vector or text")
+	cmd.Flags().Float64Var(&opts.vectorWeight, "vector-weight", 1, "Weight of the vector ranking in hybrid retrieval")
+	cmd.Flags().Float64Var(&opts.textWeight, "text-weight", 1, "Weight of the full-text (BM25) ranking in hybrid retrieval")
+	cmd.Flags().IntVar(&opts.workers, "retrieval-workers", 0, "Concurrent index queries (defaults to concurrency.retrieval_workers config, else 4)")
+	cmd.Flags().StringVar(&opts.rerank, "rerank", reranker.Lexical, "Rerank retrieved candidates: lexical (offline term and symbol overlap), llm or none")
+	cmd.Flags().IntVar(&opts.candidates, "candidates", 30, "Candidates retrieved for reranking before keeping the best")
+	cmd.Flags().Float64Var(&opts.mmrLambda, "mmr-lambda", chunk_retriever.DefaultMMRLambda, "Relevance vs. diversity of the chunks kept (MMR over stored vectors); 1 disables diversification")
+	cmd.Flags().IntVar(&opts.expand, "expand", 0, "Also search this many reformulations of the question written by the model, at the cost of one more model call (e.g. 3)")
+	cmd.Flags().IntVar(&opts.neighbors, "neighbors", 1, "Also include this many chunks before and after each hit, merged with it into one window")
+	cmd.Flags().BoolVar(&opts.debug, "debug", false, "Print the retrieval and rerank scores of the chunks used")
+}
+
+// validate checks the flags and fills the limits and workers the flags leave
+// unset from the config.
+func (o *retrievalOptions) validate() error {
+	// The config would hide a negative flag, as it only takes positive ones
+	if o.limits.TopK < 0 {
+		return fmt.Errorf("--top-k must not be negative (0 uses the retrieval.top_k config, else 10)")
+	}
+	cfg, err := config.Load(".")
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	o.limits = retrievalLimits(cfg, o.limits)
+	o.workers = retrievalWorkers(cfg, o.workers)
+	if o.limits.TopK < 0 {
+		return fmt.Errorf("retrieval.top_k in the config must not be negative")
+	}
+	if o.limits.MaxDistance < 0 || o.limits.MaxDistance > 2 {
+		return fmt.Errorf("--max-distance must be between 0 and 2")
+	}
+	if err := chunk_retriever.ValidMode(o.mode); err != nil {
+		return err
+	}
+	if o.vectorWeight < 0 || o.textWeight < 0 {
+		return fmt.Errorf("--vector-weight and --text-weight cannot be negative")
+	}
+	if o.mode == chunk_retriever.ModeHybrid && o.vectorWeight == 0 && o.textWeight == 0 {
+		return fmt.Errorf("hybrid retrieval needs a non-zero --vector-weight or --text-weight")
+	}
+	switch o.rerank {
+	case reranker.None, reranker.Lexical, reranker.LLM:
+	default:
+		return fmt.Errorf("unknown reranker %q (want %s, %s or %s)", o.rerank, reranker.Lexical, reranker.LLM, reranker.None)
+	}
+	if o.candidates < 1 {
+		return fmt.Errorf("--candidates must be at least 1")
+	}
+	if o.neighbors < 0 {
+		return fmt.Errorf("--neighbors cannot be negative")
+	}
+	if o.expand < 0 {
+		return fmt.Errorf("--expand cannot be negative")
+	}
+	if o.mmrLambda < 0 || o.mmrLambda > 1 {
+		return fmt.Errorf("--mmr-lambda must be between 0 and 1")
+	}
+	return nil
+}
+
+// retrievalWorkers returns the --retrieval-workers value, else cfg's, else
+// the default.
+func retrievalWorkers(cfg *config.Config, flag int) int {
+	s := cfg.Concurrency.Override(concurrency.Settings{RetrievalWorkers: flag})
+	return s.Resolve().RetrievalWorkers
+}
+
+// retrievalLimits applies flags over cfg's retrieval settings; top-K defaults
+// to 10.
+func retrievalLimits(cfg *config.Config, flags config.Retrieval) config.Retrieval {
+	limits := cfg.Retrieval.Override(flags)
+	if limits.TopK == 0 {
+		limits.TopK = 10
+	}
+	return limits
+}
+
+// printNoContext explains that nothing passed the relevance threshold, so
+// the model is not asked to answer from unrelated code.
+func printNoContext(limits config.Retrieval) {
+	fmt.Println("\nNo indexed code is relevant enough to answer from; not asking the model.")
+	if limits.MaxDistance > 0 {
+		fmt.Printf("Every chunk is farther than --max-distance %.2f from the question.\n", limits.MaxDistance)
+	}
+	fmt.Println("Rephrase the question with names from the code, or loosen --max-distance.")
+}
+
+// apply sets the retrieval mode and fusion weights of q.
+func (o retrievalOptions) apply(q chunk_retriever.ChunkQuery) chunk_retriever.ChunkQuery {
+	q.Mode = o.mode
+	q.VectorWeight = o.vectorWeight
+	q.TextWeight = o.textWeight
+	return q
+}
+
+// retriever creates the retriever configured by o for an index described by
+// meta, which may be nil. gen writes query expansions and scores chunks for
+// the llm reranker.
+func (o retrievalOptions) retriever(store chunk_retriever.VectorStore, model string, meta *index_meta.Metadata, gen *generator.Generator) (*retriever, error) {
+	rr, err := reranker.New(o.rerank, gen)
+	if err != nil {
+		return nil, err
+	}
+	overlap := 0
+	if meta != nil {
+		overlap = meta.Overlap
+	}
+	return &retriever{
+		store:      store,
+		model:      model,
+		workers:    o.workers,
+		reranker:   rr,
+		candidates: o.candidates,
+		mmrLambda:  o.mmrLambda,
+		debug:      o.debug,
+		expand:     o.expand,
+		neighbors:  o.neighbors,
+		threshold:  chunk_retriever.Threshold{MaxDistance: o.limits.MaxDistance, Adaptive: o.limits.Adaptive},
+		overlap:    overlap,
+		gen:        gen,
+	}, nil
+}
+
+// retriever finds the context for a question: a fused search over the index
+// and its companion indexes, a relevance threshold, an optional reranking of
+// the candidates, an MMR
+// selection that skips near-duplicates, and neighbor chunks merged into
+// contiguous windows.
+type retriever struct {
+	store      chunk_retriever.VectorStore
+	model      string
+	workers    int
+	reranker   reranker.Reranker
+	candidates int
+	mmrLambda  float64
+	debug      bool
+	expand     int
+	neighbors  int
+	threshold  chunk_retriever.Threshold
+	// overlap is the index's chunk overlap, which merged windows drop
+	overlap int
+	gen     *generator.Generator
+	// expansions are searched alongside every query once expand has run
+	expansions []expansion
+}
+
+// expansion is a reformulation of the question with its embedding.
+type expansion struct {
+	text      string
+	embedding []float32
+}
+
+// expandQuery asks the generator for reformulations of question, such as
+// identifier guesses, synonyms and sub-questions, and embeds them in one
+// batch. Later retrievals search them as extra variants. Failures only cost
+// the expansion.
+func (r *retriever) expandQuery(ctx context.Context, emb *embedder.Embedder, question string) {
+	if r.expand <= 0 {
+		return
+	}
+	texts, err := r.gen.Expand(ctx, question, r.expand)
+	if err == nil && len(texts) == 0 {
+		return
+	}
+	var vecs [][]float32
+	if err == nil {
+		vecs, err = emb.EmbedQueries(texts)
+	}
+	if err != nil {
+		fmt.Printf("Warning: query expansion failed, searching the question only: %v\n", err)
+		return
+	}
+	r.expansions = make([]expansion, len(texts))
+	for i, text := range texts {
+		r.expansions[i] = expansion{text: text, embedding: vecs[i]}
+	}
+	fmt.Printf("Searching %d reformulations of the question as well\n", len(texts))
+	if r.debug {
+		for i, text := range texts {
+			fmt.Printf("  %d. %s\n", i+1, text)
+		}
+	}
+}
+
+// retrieve returns the context for query: its hits (see search) with their
+// neighbor chunks, merged into contiguous windows per file.
+func (r *retriever) retrieve(ctx context.Context, query chunk_retriever.ChunkQuery, queryEmbedding []float32, companions ...string) []chunk_retriever.Chunk {
+	return r.windows(r.search(ctx, query, queryEmbedding, companions...))
+}
+
+// search runs query and its expansions against its index and every existing
+// companion index (dependencies, history) that is compatible with the query
+// embedding, and returns query.TopK hits picked from the fused, and possibly
+// reranked, candidates.
+func (r *retriever) search(ctx context.Context, query chunk_retriever.ChunkQuery, queryEmbedding []float32, companions ...string) []chunk_retriever.Chunk {
+	topK := query.TopK
+	diversify := r.mmrLambda < 1
+	if r.reranker != nil || diversify {
+		query.TopK = max(r.candidates, topK)
+	}
+	// Vectors give MMR its similarities and the threshold the distances of
+	// full-text hits
+	query.WithVectors = diversify || r.threshold.Enabled()
+
+	queries := []chunk_retriever.ChunkQuery{query}
+	embeddings := [][]float32{queryEmbedding}
+	for _, name := range companions {
+		if !r.store.Exists(ctx, name) {
+			continue
+		}
+		if err := checkCompanionIndex(ctx, r.store, name, r.model, len(queryEmbedding)); err != nil {
+			fmt.Printf("Warning: skipping index %q: %v\n", name, err)
+			continue
+		}
+		// Module and file filters name project code, so they do not apply here
+		companion := query
+		companion.IndexName = name
+		companion.Modules = nil
+		companion.Filters = nil
+		queries = append(queries, companion)
+		embeddings = append(embeddings, queryEmbedding)
+	}
+
+	// Each reformulation searches the same indexes as its own variant
+	searches := len(queries)
+	for v, x := range r.expansions {
+		for i := range searches {
+			q := queries[i]
+			q.Query = x.text
+			q.Variant = v + 1
+			queries = append(queries, q)
+			embeddings = append(embeddings, x.embedding)
+		}
+	}
+
+	// Concurrent chunk retrieval
+	chunks, err := chunk_retriever.ConcurrentChunkRetrieval(r.store, queries, embeddings, r.workers)
+	if err != nil {
+		fmt.Printf("Warning: retrieval error: %v\n", err)
+	}
+
+	// Keep the best hits across all indexes
+	if len(chunks) > query.TopK {
+		chunks = chunks[:query.TopK]
+	}
+	// Drop what is too far from the question before reranking it
+	if r.threshold.Enabled() {
+		relevant := r.threshold.Apply(chunks, queryEmbedding)
+		if r.debug && len(relevant) < len(chunks) {
+			fmt.Printf("Relevance threshold dropped %d of %d candidates from %s\n", len(chunks)-len(relevant), len(chunks), query.IndexName)
+		}
+		chunks = relevant
+	}
+	reranked := false
+	if r.reranker != nil {
+		ranked, err := reranker.Rerank(ctx, r.reranker, query.Query, chunks, 0)
+		if err != nil {
+			fmt.Printf("Warning: reranking failed, keeping the retrieval order: %v\n", err)
+		} else {
+			chunks, reranked = ranked, true
+		}
+	}
+
+	// Spend the slots on distinct code rather than overlapping chunks
+	var kept []chunk_retriever.Chunk
+	if diversify {
+		relevance := make([]float64, len(chunks))
+		for i, ch := range chunks {
+			relevance[i] = ch.Fused
+			if reranked {
+				relevance[i] = ch.Rerank
+			}
+		}
+		kept = chunk_retriever.SelectMMR(chunks, relevance, topK, r.mmrLambda)
+	} else {
+		kept = chunks[:min(topK, len(chunks))]
+	}
+	if r.debug {
+		printScores(query.IndexName, chunks, kept, reranked)
+	}
+	return kept
+}
+
+// windows adds the neighbors of hits and merges chunks that overlap or are
+// adjacent in their file, so the context reads as contiguous code.
+func (r *retriever) windows(hits []chunk_retriever.Chunk) []chunk_retriever.Chunk {
+	chunks, err := chunk_retriever.FetchNeighbors(r.store, hits, r.neighbors)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	merged := chunk_retriever.MergeAdjacent(chunks, r.overlap)
+	if r.debug && len(merged) != len(hits) {
+		fmt.Printf("Merged %d hits and %d neighbor chunks into %d windows\n", len(hits), len(chunks)-len(hits), len(merged))
+	}
+	return merged
+}
+
+// retrieveFile fills query.TopK with chunks of file, except for the related
+// share, which is reserved for chunks elsewhere in the repository and its
+// dependencies. Slots the file cannot fill go to related chunks as well.
+func (r *retriever) retrieveFile(ctx context.Context, query chunk_retriever.ChunkQuery, file string, related float64, queryEmbedding []float32) []chunk_retriever.Chunk {
+	filter := chunk_retriever.TagFilter("file", file)
+	reserved := int(math.Round(float64(query.TopK) * related))
+
+	var chunks []chunk_retriever.Chunk
+	if own := query.TopK - reserved; own > 0 {
+		fileQuery := query
+		fileQuery.TopK = own
+		fileQuery.Filters = append(slices.Clone(query.Filters), filter)
+		chunks = r.search(ctx, fileQuery, queryEmbedding)
+		if len(chunks) == 0 && !r.threshold.Enabled() {
+			fmt.Printf("Warning: the index has no chunks of %s; re-index if the file is new.\n", file)
+		}
+	}
+	fromFile := len(chunks)
+	if rest := query.TopK - fromFile; rest > 0 {
+		relatedQuery := query
+		relatedQuery.TopK = rest
+		relatedQuery.Filters = append(slices.Clone(query.Filters), filter.Not())
+		chunks = append(chunks, r.search(ctx, relatedQuery, queryEmbedding, go_deps.IndexName(query.IndexName))...)
+	}
+	fmt.Printf("Using %d chunks of %s and %d related chunks\n", fromFile, file, len(chunks)-fromFile)
+	return r.windows(chunks)
+}
+
+// printScores lists the candidates retrieved from index with their scores,
+// marking the ones kept.
+func printScores(index string, candidates, kept []chunk_retriever.Chunk, reranked bool) {
+	used := map[string]int{}
+	for i, ch := range kept {
+		used[ch.Key] = i + 1
+	}
+	fmt.Printf("\n--- Retrieval scores (%s: %d candidates, %d kept) ---\n", index, len(candidates), len(kept))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEPT\tFUSED\tDISTANCE\tBM25\tRERANK\tCHUNK")
+	for _, ch := range candidates {
+		keptAt := "-"
+		if n, ok := used[ch.Key]; ok {
+			keptAt = fmt.Sprintf("#%d", n)
+		}
+		distance, bm25, rerank := "-", "-", "-"
+		if ch.VectorRank > 0 {
+			distance = fmt.Sprintf("%.4f (#%d)", ch.Score, ch.VectorRank)
+		}
+		if ch.TextRank > 0 {
+			bm25 = fmt.Sprintf("%.2f (#%d)", ch.TextScore, ch.TextRank)
+		}
+		if reranked {
+			rerank = fmt.Sprintf("%.3f", ch.Rerank)
+		}
+		fmt.Fprintf(w, "%s\t%.4f\t%s\t%s\t%s\t%s\n", keptAt, ch.Fused, distance, bm25, rerank, ch.Key)
+	}
+	_ = w.Flush()
+}
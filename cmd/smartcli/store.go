@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/config"
+	"smart-cli/go-backend/local_store"
+)
+
+// storeFlag is the --store flag; it overrides the config's "store".
+var storeFlag string
+
+// storeKind returns the store selected for the project at dir.
+func storeKind(dir string) (string, error) {
+	kind := storeFlag
+	if kind == "" {
+		cfg, err := config.Load(dir)
+		if err != nil {
+			return "", err
+		}
+		kind = cfg.Store
+	}
+	if kind == "" {
+		kind = chunk_retriever.StoreRedis
+	}
+	return kind, chunk_retriever.ValidStore(kind)
+}
+
+// openStore opens the store holding the indexes of the project at dir: the
+// local store found from dir, or Redis.
+func openStore(dir string) (chunk_retriever.VectorStore, error) {
+	kind, err := storeKind(dir)
+	if err != nil {
+		return nil, err
+	}
+	if kind == chunk_retriever.StoreLocal {
+		p, err := local_store.Find(dir)
+		if err != nil {
+			return nil, err
+		}
+		return local_store.Open(p), nil
+	}
+	rdb, err := connectRedis(dir)
+	if err != nil {
+		return nil, err
+	}
+	return chunk_retriever.NewRedisStore(rdb), nil
+}
+
+// redisOf returns the Redis client behind store, or nil when it is not Redis.
+func redisOf(store chunk_retriever.VectorStore) redis.UniversalClient {
+	if rs, ok := store.(*chunk_retriever.RedisStore); ok {
+		return rs.Client()
+	}
+	return nil
+}
+
+// requireRedis connects to Redis for commands the local store does not
+// support.
+func requireRedis(command string) (redis.UniversalClient, error) {
+	kind, err := storeKind(".")
+	if err != nil {
+		return nil, err
+	}
+	if kind == chunk_retriever.StoreLocal {
+		dir, _ := local_store.Find(".")
+		return nil, fmt.Errorf("smartcli %s needs the Redis store; local indexes are files in %s", command, dir)
+	}
+	return connectRedis(".")
+}
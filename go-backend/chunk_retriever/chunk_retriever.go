@@ -7,52 +7,82 @@ import (
 	"math"
 	"os"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
 	"sync"
 
 	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/workspace"
 )
 
 type Chunk struct {
+	// Key is the chunk's Redis key; it identifies the chunk across searches.
+	Key      string
 	Text     string
 	Metadata map[string]string
-	// Score is the vector distance (COSINE). Lower = more similar.
+	// Score is the vector distance (COSINE). Lower = more similar. Only set
+	// when the chunk was found by the KNN search (VectorRank > 0).
 	Score float64
+	// TextScore is the BM25 relevance of a full-text hit. Higher = better.
+	TextScore float64
+	// VectorRank and TextRank are the chunk's 1-based positions in the KNN
+	// and full-text rankings, 0 when that search did not return it.
+	VectorRank int
+	TextRank   int
+	// Fused is the reciprocal rank fusion score results are ordered by.
+	// Higher = better.
+	Fused float64
+	// Rerank is the score of the second-stage reranker, when one ran.
+	// Higher = better.
+	Rerank float64
+	// Embedding is the chunk's stored vector, loaded when the query asked
+	// for it with WithVectors.
+	Embedding []float32
+	// Neighbor marks a chunk fetched because it is next to a hit, rather
+	// than retrieved itself.
+	Neighbor bool
+
+	// variant is the ChunkQuery.Variant of the query that found the chunk
+	variant int
 }
 
 type ChunkQuery struct {
 	Query     string
 	IndexName string
 	TopK      int
-}
-
-func Connect() *redis.Client {
-	ctx := context.Background()
-	addr := "localhost:6379"
-	if v := os.Getenv("REDIS_ADDR"); v != "" {
-		addr = v
-	}
-	rdb := redis.NewClient(&redis.Options{
-		Addr: addr,
-		// If you want to force RESP3 consistently, uncomment:
-		// Protocol: 3,
-	})
-	if _, err := rdb.Ping(ctx).Result(); err != nil {
-		panic(fmt.Errorf("failed to connect to redis at %s: %w", addr, err))
-	}
-	return rdb
+	// Modules restricts results to chunks tagged with one of these workspace
+	// modules; empty searches the whole index.
+	Modules []string
+	// Filters restrict hits by chunk metadata, such as
+	// TagFilter("file", path); every hit must pass all of them.
+	Filters []Filter
+	// Mode is ModeHybrid, ModeVector or ModeText; empty means ModeVector.
+	Mode string
+	// VectorWeight and TextWeight scale the KNN and full-text rankings when
+	// they are fused.
+	VectorWeight float64
+	TextWeight   float64
+	// WithVectors also loads each hit's embedding, e.g. for MMR selection.
+	WithVectors bool
+	// Variant numbers the reformulation of the question this query runs,
+	// 0 for the question itself. Fuse ranks each variant's hits separately.
+	Variant int
 }
 
 func PrepareQuery(queryText string, topK int, indexName string) ChunkQuery {
 	return ChunkQuery{
-		Query:     queryText,
-		IndexName: indexName,
-		TopK:      topK,
+		Query:        queryText,
+		IndexName:    indexName,
+		TopK:         topK,
+		Mode:         ModeHybrid,
+		VectorWeight: 1,
+		TextWeight:   1,
 	}
 }
 
-func getIndexes(rdb *redis.Client) ([]string, error) {
+// ListIndexes returns the names of all RediSearch indexes (FT._LIST).
+func ListIndexes(rdb redis.UniversalClient) ([]string, error) {
 	ctx := context.Background()
 	res, err := rdb.Do(ctx, "FT._LIST").Result()
 	if err != nil {
@@ -76,33 +106,99 @@ func getIndexes(rdb *redis.Client) ([]string, error) {
 	return indexes, nil
 }
 
-func GetIndexName(rdb *redis.Client) (string, error) {
-	indexes, err := getIndexes(rdb)
+// ResolveIndex returns the index that name refers to. Aliases resolve to
+// their current target; index names resolve to themselves.
+func ResolveIndex(rdb redis.UniversalClient, name string) (string, error) {
+	ctx := context.Background()
+	res, err := rdb.Do(ctx, "FT.INFO", name).Result()
 	if err != nil {
 		return "", err
 	}
-	if len(indexes) == 0 {
-		return "", fmt.Errorf("no indexes found in Redis")
+	var indexName any
+	switch t := res.(type) {
+	case map[interface{}]interface{}:
+		indexName = getMapVal(t, "index_name")
+	case []interface{}:
+		for i := 0; i+1 < len(t); i += 2 {
+			if toString(t[i]) == "index_name" {
+				indexName = t[i+1]
+			}
+		}
+	}
+	if indexName == nil {
+		return name, nil
+	}
+	return toString(indexName), nil
+}
+
+// IndexExists reports whether name is an existing index or alias.
+func IndexExists(rdb redis.UniversalClient, name string) bool {
+	_, err := ResolveIndex(rdb, name)
+	return err == nil
+}
+
+// ShardsOf returns the shards of name when it is a sharded index, otherwise
+// just name.
+func ShardsOf(rdb redis.UniversalClient, name string) []string {
+	set, err := index_meta.LoadShardSet(context.Background(), rdb, name)
+	if err != nil || set == nil {
+		return []string{name}
+	}
+	return set.Shards()
+}
+
+// IsSharded reports whether name is a sharded index.
+func IsSharded(rdb redis.UniversalClient, name string) bool {
+	set, err := index_meta.LoadShardSet(context.Background(), rdb, name)
+	return err == nil && set != nil
+}
+
+// GetIndexName resolves the index to query in Redis; see ResolveIndexName.
+func GetIndexName(rdb redis.UniversalClient) (string, error) {
+	return ResolveIndexName(NewRedisStore(rdb))
+}
+
+// ResolveIndexName resolves the index to query: SMARTCLI_INDEX if set,
+// otherwise "<workspace root>_index" inside a go.work workspace and "<current
+// folder>_index" elsewhere. In Redis either may be an index, an alias or a
+// sharded index. When that does not exist and the store holds exactly one
+// index, that index is used; with several candidates it is an error rather
+// than a guess.
+func ResolveIndexName(store VectorStore) (string, error) {
+	ctx := context.Background()
+	want := os.Getenv("SMARTCLI_INDEX")
+	if want == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		want = filepath.Base(cwd) + "_index"
+		if ws, err := workspace.Find(cwd); err == nil && ws != nil && store.Exists(ctx, ws.IndexName()) {
+			want = ws.IndexName()
+		}
 	}
-	cwd, err := os.Getwd()
+	if store.Exists(ctx, want) {
+		return want, nil
+	}
+	indexes, err := store.Indexes(ctx)
 	if err != nil {
 		return "", err
 	}
-	folderName := filepath.Base(cwd)
-	want := folderName + "_index"
-	for _, idx := range indexes {
-		if idx == want {
-			return idx, nil
-		}
+	if len(indexes) == 0 {
+		return "", fmt.Errorf("no indexes found")
+	}
+	if len(indexes) == 1 && os.Getenv("SMARTCLI_INDEX") == "" {
+		return indexes[0], nil
 	}
-	return indexes[0], nil
+	return "", fmt.Errorf("index %q not found; available indexes: %s (set SMARTCLI_INDEX or see smartcli index list)",
+		want, strings.Join(indexes, ", "))
 }
 
 // EnsureIndex creates a RediSearch vector index if it does not already exist.
 // prefix should be something like "<indexName>:".
-func EnsureIndex(rdb *redis.Client, indexName, prefix string, dim int) error {
+func EnsureIndex(rdb redis.UniversalClient, indexName, prefix string, dim int) error {
 	// If it exists, do nothing
-	indexes, err := getIndexes(rdb)
+	indexes, err := ListIndexes(rdb)
 	if err != nil {
 		return err
 	}
@@ -120,6 +216,8 @@ func EnsureIndex(rdb *redis.Client, indexName, prefix string, dim int) error {
 		"SCHEMA",
 		"text", "TEXT",
 		"file", "TAG",
+		"module", "TAG",
+		"source", "TAG",
 		"chunk", "NUMERIC",
 		"embedding", "VECTOR", "HNSW", 6,
 		"TYPE", "FLOAT32",
@@ -143,32 +241,142 @@ func float32SliceToLEBytes(vec []float32) []byte {
 	return buf
 }
 
-func RetrieveChunks(rdb *redis.Client, query ChunkQuery, queryEmbedding []float32) ([]Chunk, error) {
+func leBytesToFloat32Slice(buf []byte) []float32 {
+	if len(buf)%4 != 0 {
+		return nil
+	}
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vec
+}
+
+// docFields are the hash fields loaded for each hit. History chunks carry
+// commit details; other chunks simply lack those fields.
+var docFields = []any{
+	"text", "file", "chunk", "module", "source",
+	"commit", "author", "date", "subject",
+}
+
+// returnArgs returns the RETURN clause loading docFields, the embedding when
+// query asks for it, and extra.
+func returnArgs(query ChunkQuery, extra ...any) []any {
+	fields := append([]any{}, docFields...)
+	if query.WithVectors {
+		fields = append(fields, "embedding")
+	}
+	fields = append(fields, extra...)
+	return append([]any{"RETURN", len(fields)}, fields...)
+}
+
+func RetrieveChunks(rdb redis.UniversalClient, query ChunkQuery, queryEmbedding []float32) ([]Chunk, error) {
 	ctx := context.Background()
 	vec := float32SliceToLEBytes(queryEmbedding)
 
-	res, err := rdb.Do(
-		ctx,
+	args := []any{
 		"FT.SEARCH",
 		query.IndexName,
-		fmt.Sprintf("*=>[KNN %d @embedding $vec AS vector_score]", query.TopK),
+		fmt.Sprintf("%s=>[KNN %d @embedding $vec AS vector_score]", prefilter(query), query.TopK),
 		"PARAMS", 2, "vec", vec,
 		"SORTBY", "vector_score",
-		"RETURN", 3, "text", "file", "vector_score",
-		"LIMIT", 0, query.TopK,
-		"DIALECT", 2,
-	).Result()
+	}
+	args = append(args, returnArgs(query, "vector_score")...)
+	args = append(args, "LIMIT", 0, query.TopK, "DIALECT", 2)
+	res, err := rdb.Do(ctx, args...).Result()
 	if err != nil {
 		return nil, err
 	}
-	return parseSearchResults(res)
+	return parseSearchResults(res, false)
+}
+
+// prefilter returns the KNN pre-filter expression for query's restrictions.
+func prefilter(query ChunkQuery) string {
+	var parts []string
+	for _, f := range query.AllFilters() {
+		parts = append(parts, f.String())
+	}
+	if len(parts) == 0 {
+		return "*"
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// AllFilters returns query's Filters plus the filter its Modules imply.
+func (query ChunkQuery) AllFilters() []Filter {
+	if len(query.Modules) == 0 {
+		return query.Filters
+	}
+	return append([]Filter{TagFilter("module", query.Modules...)}, query.Filters...)
+}
+
+// Filter restricts a search to chunks whose TAG field has one of Values or,
+// with Exclude, to chunks whose field has none of them.
+type Filter struct {
+	Field   string
+	Values  []string
+	Exclude bool
+}
+
+// TagFilter returns a filter matching chunks whose TAG field has any of
+// values, e.g. TagFilter("file", "/src/main.go").
+func TagFilter(field string, values ...string) Filter {
+	return Filter{Field: field, Values: values}
+}
+
+// Not returns the filter matching exactly the chunks f does not.
+func (f Filter) Not() Filter {
+	f.Exclude = !f.Exclude
+	return f
+}
+
+// String renders f as a RediSearch query expression.
+func (f Filter) String() string {
+	vals := make([]string, len(f.Values))
+	for i, v := range f.Values {
+		vals[i] = EscapeTag(v)
+	}
+	expr := fmt.Sprintf("@%s:{%s}", f.Field, strings.Join(vals, " | "))
+	if f.Exclude {
+		return "-" + expr
+	}
+	return expr
 }
 
-func ConcurrentChunkRetrieval(rdb *redis.Client,
+// Match reports whether a chunk with metadata passes f.
+func (f Filter) Match(metadata map[string]string) bool {
+	v, ok := metadata[f.Field]
+	found := ok && slices.Contains(f.Values, v)
+	return found != f.Exclude
+}
+
+// EscapeTag escapes RediSearch tag punctuation so v matches literally.
+func EscapeTag(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if strings.ContainsRune(",.<>{}[]\"':;!@#$%^&*()-+=~|/\\ ", r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ConcurrentChunkRetrieval runs queries concurrently and returns all hits
+// fused into one ranking, best first (see Fuse). The queries of one call
+// share the fusion weights of the first. In Redis, a query against a sharded
+// index fans out to every shard.
+func ConcurrentChunkRetrieval(store VectorStore,
 	queries []ChunkQuery,
 	embeddings [][]float32,
 	numWorkers int,
 ) ([]Chunk, error) {
+	if rs, ok := store.(*RedisStore); ok {
+		queries, embeddings = expandShards(rs.rdb, queries, embeddings)
+	}
+
+	// More workers than queries would only idle
+	numWorkers = min(max(numWorkers, 1), max(len(queries), 1))
 
 	// Create channels
 	queryCh := make(chan struct {
@@ -184,7 +392,7 @@ func ConcurrentChunkRetrieval(rdb *redis.Client,
 	var wg sync.WaitGroup
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go RetrieveWorker(rdb, queryCh, resultCh, &wg, errCh)
+		go RetrieveWorker(store, queryCh, resultCh, &wg, errCh)
 	}
 
 	// Dispatch queries and then close the input channel
@@ -226,24 +434,26 @@ func ConcurrentChunkRetrieval(rdb *redis.Client,
 
 	<-errDone
 
-	return allChunks, lastErr
+	if len(queries) == 0 {
+		return allChunks, lastErr
+	}
+	return Fuse(allChunks, queries[0].VectorWeight, queries[0].TextWeight), lastErr
 }
 
-func parseSearchResults(res any) ([]Chunk, error) {
-	out := []Chunk{}
-
-	// RESP3
-	if m, ok := res.(map[interface{}]interface{}); ok {
-		resultsAny := getMapVal(m, "results")
-		resultsArr, ok := resultsAny.([]interface{})
-		if !ok {
-			return out, nil
+// expandShards replaces each query against a sharded index with one query
+// per shard, sharing the embedding.
+func expandShards(rdb redis.UniversalClient, queries []ChunkQuery, embeddings [][]float32) ([]ChunkQuery, [][]float32) {
+	var outQ []ChunkQuery
+	var outE [][]float32
+	for i, q := range queries {
+		for _, shard := range ShardsOf(rdb, q.IndexName) {
+			sq := q
+			sq.IndexName = shard
+			outQ = append(outQ, sq)
+			outE = append(outE, embeddings[i])
 		}
-		parsed := appendChunks(resultsArr)
-		out = append(out, parsed...)
-		return out, nil
 	}
-	return out, nil
+	return outQ, outE
 }
 
 func getMapVal(m map[interface{}]interface{}, key string) any {
@@ -266,43 +476,11 @@ func toString(v any) string {
 	}
 }
 
-func appendChunks(resultsArr []interface{}) []Chunk {
-	out := []Chunk{}
-	for _, item := range resultsArr {
-		itMap, ok := item.(map[interface{}]interface{})
-		if !ok {
-			continue
-		}
-		extraAny := getMapVal(itMap, "extra_attributes")
-		extra, ok := extraAny.(map[interface{}]interface{})
-		if !ok {
-			continue
-		}
-		ch := Chunk{Metadata: map[string]string{}}
-		for k, v := range extra {
-			ks := toString(k)
-			vs := toString(v)
-			switch ks {
-			case "text":
-				ch.Text = vs
-			case "vector_score":
-				if f, err := strconv.ParseFloat(vs, 64); err == nil {
-					ch.Score = f
-				}
-			default:
-				ch.Metadata[ks] = vs
-			}
-		}
-		out = append(out, ch)
-	}
-	return out
-}
-
 // ===== Chunk retriever workers =====
 
 // RetrieveWorker listens for queries on queryCh, runs retrieval, and sends results.
 func RetrieveWorker(
-	rdb *redis.Client,
+	store VectorStore,
 	queryCh <-chan struct {
 	Query     ChunkQuery
 	Embedding []float32
@@ -313,10 +491,15 @@ func RetrieveWorker(
 ) {
 	defer wg.Done()
 	for q := range queryCh {
-		results, err := RetrieveChunks(rdb, q.Query, q.Embedding)
+		results, err := Retrieve(store, q.Query, q.Embedding)
+		for i := range results {
+			results[i].variant = q.Query.Variant
+		}
 		if err != nil {
 			errCh <- fmt.Errorf("retrieval failed for %q: %w", q.Query.Query, err)
-			continue
+			if len(results) == 0 {
+				continue
+			}
 		}
 		resultCh <- results
 	}
@@ -0,0 +1,258 @@
+package chunk_retriever
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/config"
+)
+
+// DefaultRedisAddr is the server Connect uses when none is configured.
+const DefaultRedisAddr = "localhost:6379"
+
+// Redis deployment modes of config.Redis.
+const (
+	RedisStandalone = "standalone"
+	RedisSentinel   = "sentinel"
+	RedisCluster    = "cluster"
+)
+
+// Connect opens a client for the Redis described by cfg, pings it and checks
+// that it can run search commands. The client is a *redis.Client for a
+// standalone or sentinel-managed server and a *redis.ClusterClient for a
+// cluster.
+//
+// In a cluster, key reads and writes go to the node owning each key, but the
+// FT.* commands (FT.CREATE, FT.SEARCH, FT.INFO, FT._LIST, FT.DROPINDEX) and
+// the alias commands (FT.ALIASADD, FT.ALIASUPDATE, FT.ALIASDEL) are sent to a
+// single node. They only see the whole index when search is coordinated
+// across shards, as in Redis Enterprise, Redis Cloud or the RediSearch
+// coordinator; on a plain OSS cluster each node indexes just its own keys.
+// MULTI/EXEC batches are atomic per hash slot only.
+func Connect(cfg config.Redis) (redis.UniversalClient, error) {
+	opts, err := redisOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var rdb redis.UniversalClient
+	switch cfg.Mode {
+	case RedisSentinel:
+		rdb = redis.NewFailoverClient(opts.Failover())
+	case RedisCluster:
+		rdb = redis.NewClusterClient(opts.Cluster())
+	default:
+		rdb = redis.NewClient(opts.Simple())
+	}
+
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		_ = rdb.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", strings.Join(opts.Addrs, ","), err)
+	}
+	if err := checkSearchModule(ctx, rdb); err != nil {
+		_ = rdb.Close()
+		return nil, err
+	}
+	return rdb, nil
+}
+
+// redisOptions turns cfg into client options: the URL first, then the
+// explicit fields on top of it.
+func redisOptions(cfg config.Redis) (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{}
+	switch cfg.Mode {
+	case "", RedisStandalone, RedisSentinel, RedisCluster:
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q (want %s, %s or %s)", cfg.Mode, RedisStandalone, RedisSentinel, RedisCluster)
+	}
+
+	if cfg.URL != "" {
+		if cfg.Mode == RedisCluster {
+			// Cluster URLs may list more seed nodes as addr= parameters
+			o, err := redis.ParseClusterURL(cfg.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redis url: %w", err)
+			}
+			opts.Addrs, opts.Username, opts.Password = o.Addrs, o.Username, o.Password
+			opts.TLSConfig = o.TLSConfig
+			opts.DialTimeout, opts.ReadTimeout, opts.WriteTimeout = o.DialTimeout, o.ReadTimeout, o.WriteTimeout
+			opts.PoolSize, opts.MinIdleConns = o.PoolSize, o.MinIdleConns
+		} else {
+			o, err := redis.ParseURL(cfg.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redis url: %w", err)
+			}
+			opts.Addrs, opts.Username, opts.Password, opts.DB = []string{o.Addr}, o.Username, o.Password, o.DB
+			opts.TLSConfig = o.TLSConfig
+			opts.DialTimeout, opts.ReadTimeout, opts.WriteTimeout = o.DialTimeout, o.ReadTimeout, o.WriteTimeout
+			opts.PoolSize, opts.MinIdleConns = o.PoolSize, o.MinIdleConns
+		}
+	}
+
+	if len(cfg.Addrs) > 0 {
+		opts.Addrs = cfg.Addrs
+	}
+	if len(opts.Addrs) == 0 {
+		opts.Addrs = []string{DefaultRedisAddr}
+	}
+	if cfg.Username != "" {
+		opts.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		opts.Password = cfg.Password
+	}
+	if cfg.DB != 0 {
+		opts.DB = cfg.DB
+	}
+	if cfg.PoolSize > 0 {
+		opts.PoolSize = cfg.PoolSize
+	}
+	if cfg.MinIdleConns > 0 {
+		opts.MinIdleConns = cfg.MinIdleConns
+	}
+	for _, t := range []struct {
+		name, value string
+		dst         *time.Duration
+	}{
+		{"dial_timeout", cfg.DialTimeout, &opts.DialTimeout},
+		{"read_timeout", cfg.ReadTimeout, &opts.ReadTimeout},
+		{"write_timeout", cfg.WriteTimeout, &opts.WriteTimeout},
+	} {
+		if t.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis %s %q: %w", t.name, t.value, err)
+		}
+		*t.dst = d
+	}
+
+	switch cfg.Mode {
+	case RedisSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel mode needs master_name")
+		}
+		opts.MasterName = cfg.MasterName
+		opts.SentinelUsername, opts.SentinelPassword = cfg.SentinelUsername, cfg.SentinelPassword
+	case RedisCluster:
+		if opts.DB != 0 {
+			return nil, fmt.Errorf("redis cluster only has database 0, not %d", opts.DB)
+		}
+	default:
+		if len(opts.Addrs) > 1 {
+			return nil, fmt.Errorf("standalone redis takes one address, got %d (set mode to cluster or sentinel)", len(opts.Addrs))
+		}
+	}
+
+	tlsConfig, err := redisTLS(cfg.TLS, opts.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	opts.TLSConfig = tlsConfig
+	return opts, nil
+}
+
+// redisTLS applies the TLS settings to the config a rediss:// URL produced,
+// if any. It returns nil when TLS is off.
+func redisTLS(t config.RedisTLS, fromURL *tls.Config) (*tls.Config, error) {
+	if !t.Enabled && fromURL == nil {
+		return nil, nil
+	}
+	c := fromURL
+	if c == nil {
+		c = &tls.Config{}
+	}
+	c.MinVersion = tls.VersionTLS12
+	if t.ServerName != "" {
+		c.ServerName = t.ServerName
+	}
+	// The config can only turn verification off; skip_verify=true in the
+	// URL is kept
+	c.InsecureSkipVerify = c.InsecureSkipVerify || t.InsecureSkipVerify
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in redis CA file %s", t.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading redis client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// checkSearchModule fails unless the server runs RediSearch, either as a
+// module or built in as in Redis 8.
+func checkSearchModule(ctx context.Context, rdb redis.UniversalClient) error {
+	if res, err := rdb.Do(ctx, "MODULE", "LIST").Result(); err == nil && hasSearchModule(res) {
+		return nil
+	}
+	// MODULE LIST may be blocked by ACLs or not list built-in search, so
+	// fall back to probing a search command
+	if err := rdb.Do(ctx, "FT._LIST").Err(); err != nil {
+		return fmt.Errorf("redis does not support search commands (%w); use Redis Stack or Redis 8 or later", err)
+	}
+	return nil
+}
+
+// hasSearchModule looks for the search module in a MODULE LIST reply, whose
+// entries are name/value arrays in RESP2 and maps in RESP3.
+func hasSearchModule(res any) bool {
+	modules, ok := res.([]any)
+	if !ok {
+		return false
+	}
+	for _, m := range modules {
+		var name string
+		if arr, ok := m.([]any); ok {
+			for i := 0; i+1 < len(arr); i += 2 {
+				if toString(arr[i]) == "name" {
+					name = toString(arr[i+1])
+				}
+			}
+		} else if v, ok := lookup(m, "name"); ok {
+			name = toString(v)
+		}
+		switch strings.ToLower(name) {
+		case "search", "ft", "searchlight":
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteKeys deletes keys with one DEL each, sent as a pipeline, since a
+// cluster rejects a multi-key DEL whose keys hash to different slots. It
+// returns how many keys existed.
+func DeleteKeys(ctx context.Context, rdb redis.UniversalClient, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	cmds, err := rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, key := range keys {
+			p.Del(ctx, key)
+		}
+		return nil
+	})
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.(*redis.IntCmd).Val()
+	}
+	return deleted, err
+}
@@ -0,0 +1,215 @@
+package chunk_retriever
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Retrieval modes.
+const (
+	// ModeHybrid runs a full-text and a KNN search and fuses their rankings.
+	ModeHybrid = "hybrid"
+	// ModeVector ranks chunks by embedding distance only.
+	ModeVector = "vector"
+	// ModeText ranks chunks by BM25 full-text relevance only.
+	ModeText = "text"
+)
+
+// RRFK is the rank constant of reciprocal rank fusion. Larger values flatten
+// the advantage of the top ranks.
+const RRFK = 60
+
+// ValidMode checks a retrieval mode.
+func ValidMode(mode string) error {
+	switch mode {
+	case ModeHybrid, ModeVector, ModeText:
+		return nil
+	}
+	return fmt.Errorf("unknown retrieval mode %q (want %s, %s or %s)", mode, ModeHybrid, ModeVector, ModeText)
+}
+
+// TextQuery turns free text into a RediSearch full-text query on the text
+// field matching any of its words, or "" when it has none.
+func TextQuery(text string) string {
+	terms := QueryTerms(text)
+	if len(terms) == 0 {
+		return ""
+	}
+	return "@text:(" + strings.Join(terms, " | ") + ")"
+}
+
+// QueryTerms returns the distinct lowercased words of text worth searching
+// for. Identifiers such as storeChunk or chunk_retriever are kept whole.
+func QueryTerms(text string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, w := range Words(text) {
+		if len(w) < 2 || seen[w] {
+			continue
+		}
+		seen[w] = true
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// Words splits text into lowercased words of letters, digits and
+// underscores.
+func Words(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return words
+}
+
+// SearchText runs a BM25 full-text search for query and returns its best
+// query.TopK chunks, most relevant first, with TextScore set.
+func SearchText(rdb redis.UniversalClient, query ChunkQuery) ([]Chunk, error) {
+	text := TextQuery(query.Query)
+	if text == "" {
+		return nil, nil
+	}
+	if filter := prefilter(query); filter != "*" {
+		text = filter + " " + text
+	}
+
+	args := []any{
+		"FT.SEARCH",
+		query.IndexName,
+		text,
+		"WITHSCORES",
+		"SCORER", "BM25",
+	}
+	args = append(args, returnArgs(query)...)
+	args = append(args, "LIMIT", 0, query.TopK, "DIALECT", 2)
+	res, err := rdb.Do(context.Background(), args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	return parseSearchResults(res, true)
+}
+
+// Retrieve runs the searches of query's mode. KNN hits come back with
+// VectorRank set and full-text hits with TextRank set; Fuse combines them.
+func Retrieve(store VectorStore, query ChunkQuery, queryEmbedding []float32) ([]Chunk, error) {
+	ctx := context.Background()
+	var hits []Chunk
+	if query.Mode != ModeText {
+		vec, err := store.KNN(ctx, query, queryEmbedding)
+		if err != nil {
+			return nil, err
+		}
+		for i := range vec {
+			vec[i].VectorRank = i + 1
+		}
+		hits = append(hits, vec...)
+	}
+	if query.Mode == ModeText || query.Mode == ModeHybrid {
+		text, err := store.SearchText(ctx, query)
+		if err != nil {
+			return hits, fmt.Errorf("full-text search: %w", err)
+		}
+		for i := range text {
+			text[i].TextRank = i + 1
+		}
+		hits = append(hits, text...)
+	}
+	return hits, nil
+}
+
+// Fuse merges the hits of several searches with reciprocal rank fusion.
+// Within each query variant, KNN hits are ranked together by distance and
+// full-text hits by BM25 score; each chunk scores the weighted sum of
+// 1/(RRFK+rank) over all the rankings it appears in. Chunks are deduplicated
+// by key and returned best first with Fused, their best VectorRank and
+// TextRank, and their smallest distance set.
+func Fuse(hits []Chunk, vectorWeight, textWeight float64) []Chunk {
+	byVariant := map[int][]Chunk{}
+	var variants []int
+	for _, h := range hits {
+		if _, ok := byVariant[h.variant]; !ok {
+			variants = append(variants, h.variant)
+		}
+		byVariant[h.variant] = append(byVariant[h.variant], h)
+	}
+	sort.Ints(variants)
+
+	byKey := map[string]*Chunk{}
+	var order []*Chunk
+	get := func(h Chunk) *Chunk {
+		if c, ok := byKey[h.Key]; ok {
+			if c.Embedding == nil {
+				c.Embedding = h.Embedding
+			}
+			return c
+		}
+		c := h
+		c.VectorRank, c.TextRank, c.Fused = 0, 0, 0
+		byKey[h.Key] = &c
+		order = append(order, &c)
+		return &c
+	}
+
+	for _, v := range variants {
+		var vec, text []Chunk
+		for _, h := range byVariant[v] {
+			switch {
+			case h.VectorRank > 0:
+				vec = append(vec, h)
+			case h.TextRank > 0:
+				text = append(text, h)
+			}
+		}
+		sort.SliceStable(vec, func(i, j int) bool { return vec[i].Score < vec[j].Score })
+		sort.SliceStable(text, func(i, j int) bool { return text[i].TextScore > text[j].TextScore })
+
+		// The same chunk can come back from several searches of one index
+		seen := map[string]bool{}
+		rank := 0
+		for _, h := range vec {
+			if seen[h.Key] {
+				continue
+			}
+			seen[h.Key] = true
+			rank++
+			c := get(h)
+			if c.VectorRank == 0 || h.Score < c.Score {
+				c.Score = h.Score
+			}
+			if c.VectorRank == 0 || rank < c.VectorRank {
+				c.VectorRank = rank
+			}
+			c.Fused += vectorWeight / float64(RRFK+rank)
+		}
+		seen = map[string]bool{}
+		rank = 0
+		for _, h := range text {
+			if seen[h.Key] {
+				continue
+			}
+			seen[h.Key] = true
+			rank++
+			c := get(h)
+			if c.TextRank == 0 || rank < c.TextRank {
+				c.TextRank = rank
+				c.TextScore = h.TextScore
+			}
+			c.Fused += textWeight / float64(RRFK+rank)
+		}
+	}
+
+	out := make([]Chunk, len(order))
+	for i, c := range order {
+		out[i] = *c
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Fused > out[j].Fused })
+	return out
+}
@@ -0,0 +1,82 @@
+package chunk_retriever
+
+import "math"
+
+// DefaultMMRLambda balances relevance against redundancy in SelectMMR.
+const DefaultMMRLambda = 0.6
+
+// SelectMMR picks k of chunks by maximal marginal relevance: each pick
+// maximizes lambda*relevance - (1-lambda)*similarity, where relevance[i] is
+// chunk i's score from the previous ranking stage scaled to [0, 1] and
+// similarity is the highest cosine similarity of its embedding to a chunk
+// already picked. Lambda 1 keeps the ranking as is; lower values trade
+// relevance for diversity. Chunks without an embedding are never considered
+// redundant. The picks are returned in selection order.
+func SelectMMR(chunks []Chunk, relevance []float64, k int, lambda float64) []Chunk {
+	if k <= 0 || k >= len(chunks) || lambda >= 1 {
+		return chunks[:min(max(k, 0), len(chunks))]
+	}
+	rel := normalize(relevance)
+
+	picked := make([]Chunk, 0, k)
+	// maxSim[i] is chunk i's highest similarity to the picks so far
+	maxSim := make([]float64, len(chunks))
+	used := make([]bool, len(chunks))
+	for len(picked) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range chunks {
+			if used[i] {
+				continue
+			}
+			if score := lambda*rel[i] - (1-lambda)*maxSim[i]; score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		picked = append(picked, chunks[best])
+		for i := range chunks {
+			if !used[i] {
+				maxSim[i] = max(maxSim[i], Cosine(chunks[i].Embedding, chunks[best].Embedding))
+			}
+		}
+	}
+	return picked
+}
+
+// normalize scales scores to [0, 1]; equal scores all become 1.
+func normalize(scores []float64) []float64 {
+	if len(scores) == 0 {
+		return nil
+	}
+	lo, hi := scores[0], scores[0]
+	for _, s := range scores {
+		lo, hi = min(lo, s), max(hi, s)
+	}
+	out := make([]float64, len(scores))
+	for i, s := range scores {
+		if hi > lo {
+			out[i] = (s - lo) / (hi - lo)
+		} else {
+			out[i] = 1
+		}
+	}
+	return out
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 when either is
+// missing or their dimensions differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
@@ -0,0 +1,207 @@
+package chunk_retriever
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chunkPosition splits a chunk key "<prefix>:<path>:<n>" into the part
+// before the chunk number and the number.
+func chunkPosition(ch Chunk) (string, int, bool) {
+	i := strings.LastIndex(ch.Key, ":")
+	if i < 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(ch.Key[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	// Keys written outside the indexer do not encode the chunk number
+	if c, ok := ch.Metadata["chunk"]; ok && c != strconv.Itoa(n) {
+		return "", 0, false
+	}
+	return ch.Key[:i], n, true
+}
+
+// FetchNeighbors loads up to radius chunks before and after each chunk from
+// the same file and returns them after chunks, marked as Neighbor. A side
+// stops at the first chunk that does not exist, such as past the end of the
+// file.
+func FetchNeighbors(store VectorStore, chunks []Chunk, radius int) ([]Chunk, error) {
+	if radius <= 0 {
+		return chunks, nil
+	}
+	have := map[string]bool{}
+	for _, ch := range chunks {
+		have[ch.Key] = true
+	}
+
+	// Load every candidate neighbor at once
+	type pending struct {
+		hit, offset int
+		key         string
+	}
+	var queued []pending
+	var keys []string
+	for i, ch := range chunks {
+		prefix, n, ok := chunkPosition(ch)
+		if !ok {
+			continue
+		}
+		for _, off := range neighborOffsets(radius) {
+			if n+off < 0 {
+				continue
+			}
+			key := fmt.Sprintf("%s:%d", prefix, n+off)
+			queued = append(queued, pending{hit: i, offset: off, key: key})
+			keys = append(keys, key)
+		}
+	}
+	if len(queued) == 0 {
+		return chunks, nil
+	}
+	found, err := store.Get(context.Background(), keys)
+	if err != nil {
+		return chunks, fmt.Errorf("fetching neighbor chunks: %w", err)
+	}
+
+	out := append([]Chunk{}, chunks...)
+	// stopped[hit][side] is set once a side has hit a missing chunk
+	stopped := map[[2]int]bool{}
+	for _, p := range queued {
+		side := [2]int{p.hit, sign(p.offset)}
+		if stopped[side] {
+			continue
+		}
+		ch, ok := found[p.key]
+		if !ok {
+			stopped[side] = true
+			continue
+		}
+		// A chunk of another file means the key is not positional after all
+		if ch.Metadata["file"] != chunks[p.hit].Metadata["file"] {
+			stopped[side] = true
+			continue
+		}
+		if have[p.key] {
+			continue
+		}
+		have[p.key] = true
+		ch.Neighbor = true
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+// neighborOffsets returns -1, 1, -2, 2, ... up to radius, nearest first so
+// each side can stop at its first gap.
+func neighborOffsets(radius int) []int {
+	offsets := make([]int, 0, 2*radius)
+	for d := 1; d <= radius; d++ {
+		offsets = append(offsets, -d, d)
+	}
+	return offsets
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+// MergeAdjacent joins chunks of the same file with consecutive chunk numbers
+// into one window, dropping the overlap runes consecutive chunks share (the
+// index's chunk overlap). A window takes the scores and metadata of its
+// best-ranked member, plus a chunk range such as "3-5", and sits at that
+// member's position. Chunks without a positional key are kept as they are.
+func MergeAdjacent(chunks []Chunk, overlap int) []Chunk {
+	type member struct {
+		pos, n int
+	}
+	groups := map[string][]member{}
+	var prefixes []string
+	var loose []int
+	for i, ch := range chunks {
+		prefix, n, ok := chunkPosition(ch)
+		if !ok {
+			loose = append(loose, i)
+			continue
+		}
+		if _, seen := groups[prefix]; !seen {
+			prefixes = append(prefixes, prefix)
+		}
+		groups[prefix] = append(groups[prefix], member{pos: i, n: n})
+	}
+
+	type window struct {
+		pos   int
+		chunk Chunk
+	}
+	var windows []window
+	for _, i := range loose {
+		windows = append(windows, window{pos: i, chunk: chunks[i]})
+	}
+	for _, prefix := range prefixes {
+		members := groups[prefix]
+		sort.Slice(members, func(a, b int) bool { return members[a].n < members[b].n })
+		for start := 0; start < len(members); {
+			end := start + 1
+			for end < len(members) && members[end].n <= members[end-1].n+1 {
+				end++
+			}
+			run := members[start:end]
+			best := run[0]
+			for _, m := range run {
+				if m.pos < best.pos {
+					best = m
+				}
+			}
+			merged := chunks[best.pos]
+			if len(run) > 1 {
+				var text string
+				for k, m := range run {
+					if k > 0 && m.n == run[k-1].n {
+						continue // the same chunk twice
+					}
+					if k == 0 {
+						text = chunks[m.pos].Text
+					} else {
+						text = joinOverlapping(text, chunks[m.pos].Text, overlap)
+					}
+				}
+				merged.Text = text
+				merged.Metadata = make(map[string]string, len(chunks[best.pos].Metadata)+1)
+				for k, v := range chunks[best.pos].Metadata {
+					merged.Metadata[k] = v
+				}
+				merged.Metadata["chunk"] = fmt.Sprintf("%d-%d", run[0].n, run[len(run)-1].n)
+			}
+			windows = append(windows, window{pos: best.pos, chunk: merged})
+			start = end
+		}
+	}
+
+	sort.SliceStable(windows, func(a, b int) bool { return windows[a].pos < windows[b].pos })
+	out := make([]Chunk, len(windows))
+	for i, w := range windows {
+		out[i] = w.chunk
+	}
+	return out
+}
+
+// joinOverlapping appends b to a, without its first overlap runes when they
+// repeat the end of a, as they do for consecutive chunks of one split. Text
+// is never dropped otherwise; at worst the overlap appears twice.
+func joinOverlapping(a, b string, overlap int) string {
+	if overlap > 0 {
+		rb := []rune(b)
+		if overlap <= len(rb) && strings.HasSuffix(a, string(rb[:overlap])) {
+			return a + string(rb[overlap:])
+		}
+	}
+	return a + b
+}
@@ -0,0 +1,108 @@
+package chunk_retriever
+
+import (
+	"math"
+	"slices"
+)
+
+// Elbow detection settings for Threshold.Adaptive.
+const (
+	// ElbowMinGap is the smallest jump in cosine distance treated as an
+	// elbow; smaller jumps are noise between equally relevant chunks.
+	ElbowMinGap = 0.02
+	// ElbowRatio is how many times the average of the other jumps the
+	// largest one must be to mark where relevant chunks end.
+	ElbowRatio = 2.0
+)
+
+// Threshold drops retrieved chunks that are too far from the question, so
+// unrelated code is not passed to the model just to fill the top-K.
+type Threshold struct {
+	// MaxDistance is the largest cosine distance kept; 0 disables it.
+	MaxDistance float64
+	// Adaptive cuts the ranking at its elbow: the largest jump in distance,
+	// when it clearly stands out from the others.
+	Adaptive bool
+}
+
+// Enabled reports whether t drops anything.
+func (t Threshold) Enabled() bool {
+	return t.MaxDistance > 0 || t.Adaptive
+}
+
+// Apply returns the chunks that pass t, in their order. Distances are
+// measured to vec (see Distance); chunks without one cannot be judged and are
+// kept.
+func (t Threshold) Apply(chunks []Chunk, vec []float32) []Chunk {
+	if !t.Enabled() {
+		return chunks
+	}
+	dist := make([]float64, len(chunks))
+	known := make([]bool, len(chunks))
+	var measured []float64
+	for i, ch := range chunks {
+		dist[i], known[i] = Distance(ch, vec)
+		if known[i] && (t.MaxDistance <= 0 || dist[i] <= t.MaxDistance) {
+			measured = append(measured, dist[i])
+		}
+	}
+	cutoff := math.Inf(1)
+	if t.MaxDistance > 0 {
+		cutoff = t.MaxDistance
+	}
+	if t.Adaptive {
+		if elbow, ok := ElbowCutoff(measured); ok {
+			cutoff = elbow
+		}
+	}
+
+	var kept []Chunk
+	for i, ch := range chunks {
+		if !known[i] || dist[i] <= cutoff {
+			kept = append(kept, ch)
+		}
+	}
+	return kept
+}
+
+// Distance returns the cosine distance of ch to vec, from its stored
+// embedding when it was loaded, else from the KNN Score. The Score is only
+// valid when the vector search found the chunk (VectorRank > 0), and may be
+// the distance to a reformulation of the question rather than to vec. ok is
+// false when neither is available, e.g. for a full-text hit without its
+// vector.
+func Distance(ch Chunk, vec []float32) (float64, bool) {
+	if len(ch.Embedding) > 0 && len(ch.Embedding) == len(vec) {
+		return 1 - Cosine(ch.Embedding, vec), true
+	}
+	if ch.VectorRank > 0 {
+		return ch.Score, true
+	}
+	return 0, false
+}
+
+// ElbowCutoff returns the largest distance before the elbow of distances:
+// the largest jump between consecutive sorted distances, if it is at least
+// ElbowMinGap and ElbowRatio times the average of the other jumps. ok is
+// false when there is no such elbow and everything should be kept.
+func ElbowCutoff(distances []float64) (float64, bool) {
+	if len(distances) < 3 {
+		return 0, false
+	}
+	sorted := slices.Clone(distances)
+	slices.Sort(sorted)
+
+	best, bestGap, total := 0, 0.0, 0.0
+	for i := 0; i+1 < len(sorted); i++ {
+		gap := sorted[i+1] - sorted[i]
+		total += gap
+		if gap > bestGap {
+			best, bestGap = i, gap
+		}
+	}
+	others := (total - bestGap) / float64(len(sorted)-2)
+	if bestGap < ElbowMinGap || bestGap < ElbowRatio*others {
+		return 0, false
+	}
+	return sorted[best], true
+}
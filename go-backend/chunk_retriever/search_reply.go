@@ -0,0 +1,221 @@
+package chunk_retriever
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// SearchReply is a parsed FT.SEARCH reply.
+type SearchReply struct {
+	// Total is the number of matching documents, which exceeds len(Docs)
+	// when the reply was limited.
+	Total int64
+	Docs  []SearchDoc
+	// Warnings are RESP3 warnings, such as a timeout cutting results short.
+	Warnings []string
+}
+
+// SearchDoc is one document of an FT.SEARCH reply.
+type SearchDoc struct {
+	Key string
+	// Score is the document's relevance when the query ran WITHSCORES.
+	Score    float64
+	HasScore bool
+	// Fields holds the returned fields; it is empty for NOCONTENT queries.
+	Fields map[string]string
+}
+
+// ParseSearchReply parses an FT.SEARCH reply of either protocol: the RESP2
+// array [total, key, (score,) [field, value, ...], ...] or the RESP3 map
+// with total_results and results. withScores must say whether the query ran
+// WITHSCORES, which RESP2 replies do not show; RESP3 replies label scores.
+func ParseSearchReply(res any, withScores bool) (*SearchReply, error) {
+	switch t := res.(type) {
+	case []any:
+		return parseRESP2(t, withScores)
+	case map[any]any, map[string]any:
+		return parseRESP3(t)
+	}
+	return nil, fmt.Errorf("unexpected FT.SEARCH reply type %T", res)
+}
+
+func parseRESP2(arr []any, withScores bool) (*SearchReply, error) {
+	if len(arr) == 0 {
+		return nil, fmt.Errorf("empty FT.SEARCH reply")
+	}
+	total, err := toInt64(arr[0])
+	if err != nil {
+		return nil, fmt.Errorf("FT.SEARCH total: %w", err)
+	}
+	reply := &SearchReply{Total: total, Docs: []SearchDoc{}}
+	for i := 1; i < len(arr); {
+		doc := SearchDoc{Key: toString(arr[i]), Fields: map[string]string{}}
+		i++
+		if withScores {
+			if i >= len(arr) {
+				return nil, fmt.Errorf("document %q has no score", doc.Key)
+			}
+			if doc.Score, err = parseScore(arr[i]); err != nil {
+				return nil, fmt.Errorf("document %q: %w", doc.Key, err)
+			}
+			doc.HasScore = true
+			i++
+		}
+		// NOCONTENT replies go straight on to the next key
+		if i < len(arr) {
+			if fields, ok := arr[i].([]any); ok {
+				if doc.Fields, err = fieldPairs(fields); err != nil {
+					return nil, fmt.Errorf("document %q: %w", doc.Key, err)
+				}
+				i++
+			}
+		}
+		reply.Docs = append(reply.Docs, doc)
+	}
+	return reply, nil
+}
+
+func parseRESP3(m any) (*SearchReply, error) {
+	reply := &SearchReply{Docs: []SearchDoc{}}
+	if v, ok := lookup(m, "total_results"); ok {
+		total, err := toInt64(v)
+		if err != nil {
+			return nil, fmt.Errorf("FT.SEARCH total_results: %w", err)
+		}
+		reply.Total = total
+	}
+	if v, ok := lookup(m, "warning"); ok {
+		if warnings, ok := v.([]any); ok {
+			for _, w := range warnings {
+				reply.Warnings = append(reply.Warnings, toString(w))
+			}
+		}
+	}
+
+	v, ok := lookup(m, "results")
+	if !ok || v == nil {
+		return reply, nil
+	}
+	results, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected FT.SEARCH results type %T", v)
+	}
+	for n, item := range results {
+		id, ok := lookup(item, "id")
+		if !ok {
+			return nil, fmt.Errorf("result %d has no id", n)
+		}
+		doc := SearchDoc{Key: toString(id), Fields: map[string]string{}}
+		if score, ok := lookup(item, "score"); ok {
+			f, err := parseScore(score)
+			if err != nil {
+				return nil, fmt.Errorf("document %q: %w", doc.Key, err)
+			}
+			doc.Score, doc.HasScore = f, true
+		}
+		if extra, ok := lookup(item, "extra_attributes"); ok {
+			switch attrs := extra.(type) {
+			case map[any]any:
+				for k, v := range attrs {
+					doc.Fields[toString(k)] = toString(v)
+				}
+			case map[string]any:
+				for k, v := range attrs {
+					doc.Fields[k] = toString(v)
+				}
+			default:
+				return nil, fmt.Errorf("document %q: unexpected attributes type %T", doc.Key, extra)
+			}
+		}
+		reply.Docs = append(reply.Docs, doc)
+	}
+	return reply, nil
+}
+
+// parseSearchResults parses an FT.SEARCH reply into chunks, with the
+// vector distance, BM25 score and embedding taken out of the fields.
+func parseSearchResults(res any, withScores bool) ([]Chunk, error) {
+	reply, err := ParseSearchReply(res, withScores)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Chunk, 0, len(reply.Docs))
+	for _, doc := range reply.Docs {
+		ch := Chunk{Key: doc.Key, Metadata: map[string]string{}}
+		if doc.HasScore {
+			ch.TextScore = doc.Score
+		}
+		for k, v := range doc.Fields {
+			switch k {
+			case "text":
+				ch.Text = v
+			case "embedding":
+				ch.Embedding = leBytesToFloat32Slice([]byte(v))
+			case "vector_score":
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					ch.Score = f
+				}
+			default:
+				ch.Metadata[k] = v
+			}
+		}
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+// lookup returns key's value in a RESP3 map of either decoded type.
+func lookup(m any, key string) (any, bool) {
+	switch t := m.(type) {
+	case map[string]any:
+		v, ok := t[key]
+		return v, ok
+	case map[any]any:
+		for k, v := range t {
+			if toString(k) == key {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// fieldPairs turns a RESP2 [field, value, ...] array into a map.
+func fieldPairs(arr []any) (map[string]string, error) {
+	if len(arr)%2 != 0 {
+		return nil, fmt.Errorf("odd number of field elements (%d)", len(arr))
+	}
+	fields := make(map[string]string, len(arr)/2)
+	for i := 0; i+1 < len(arr); i += 2 {
+		fields[toString(arr[i])] = toString(arr[i+1])
+	}
+	return fields, nil
+}
+
+// parseScore reads a score, which EXPLAINSCORE wraps as [score, explanation].
+func parseScore(v any) (float64, error) {
+	if arr, ok := v.([]any); ok && len(arr) > 0 {
+		v = arr[0]
+	}
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case int64:
+		return float64(t), nil
+	}
+	f, err := strconv.ParseFloat(toString(v), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid score %v", v)
+	}
+	return f, nil
+}
+
+func toInt64(v any) (int64, error) {
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case int:
+		return int64(t), nil
+	}
+	return strconv.ParseInt(toString(v), 10, 64)
+}
@@ -0,0 +1,195 @@
+package chunk_retriever
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/index_meta"
+)
+
+// Store backends.
+const (
+	// StoreRedis keeps chunks in RediSearch indexes.
+	StoreRedis = "redis"
+	// StoreLocal keeps chunks in files under .smartcli/, with no server.
+	StoreLocal = "local"
+)
+
+// ValidStore checks a store backend name.
+func ValidStore(store string) error {
+	switch store {
+	case StoreRedis, StoreLocal:
+		return nil
+	}
+	return fmt.Errorf("unknown store %q (want %s or %s)", store, StoreRedis, StoreLocal)
+}
+
+// VectorStore holds indexed chunks and searches them. RedisStore keeps them
+// in RediSearch; local_store keeps them in files for projects without a
+// Redis server.
+type VectorStore interface {
+	// EnsureIndex creates index for dim-dimensional embeddings unless it
+	// already exists.
+	EnsureIndex(ctx context.Context, index string, dim int) error
+	// Upsert writes chunks to index, replacing those with the same Key. Each
+	// chunk's Metadata, such as file and chunk, is stored with it.
+	Upsert(ctx context.Context, index string, chunks []Chunk) error
+	// DeleteFile removes every chunk of file from index and returns how many
+	// were removed.
+	DeleteFile(ctx context.Context, index, file string) (int64, error)
+	// KNN returns the query.TopK chunks nearest to vec that pass query's
+	// filters, nearest first, with Score set to their cosine distance.
+	KNN(ctx context.Context, query ChunkQuery, vec []float32) ([]Chunk, error)
+	// SearchText returns the query.TopK chunks most relevant to query.Query
+	// by BM25 that pass query's filters, best first, with TextScore set.
+	SearchText(ctx context.Context, query ChunkQuery) ([]Chunk, error)
+	// Get loads chunks by key. Keys that do not exist are left out.
+	Get(ctx context.Context, keys []string) (map[string]Chunk, error)
+	// Exists reports whether index exists.
+	Exists(ctx context.Context, index string) bool
+	// Indexes lists the indexes in the store.
+	Indexes(ctx context.Context) ([]string, error)
+	// SaveMeta records the smartcli metadata of index; LoadMeta returns it,
+	// or nil when there is none.
+	SaveMeta(ctx context.Context, index string, m *index_meta.Metadata) error
+	LoadMeta(ctx context.Context, index string) (*index_meta.Metadata, error)
+	Close() error
+}
+
+// RedisStore is the VectorStore backed by RediSearch. Chunks of an index are
+// hashes under the "<index>:" key prefix.
+type RedisStore struct {
+	rdb redis.UniversalClient
+}
+
+// NewRedisStore returns the store of rdb. Closing it closes rdb.
+func NewRedisStore(rdb redis.UniversalClient) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+// Client returns the Redis client, for the index bookkeeping (aliases,
+// shards, run state) only Redis supports.
+func (s *RedisStore) Client() redis.UniversalClient {
+	return s.rdb
+}
+
+func (s *RedisStore) EnsureIndex(ctx context.Context, index string, dim int) error {
+	return EnsureIndex(s.rdb, index, index+":", dim)
+}
+
+// Exists also accepts aliases and sharded indexes.
+func (s *RedisStore) Exists(ctx context.Context, index string) bool {
+	return IndexExists(s.rdb, index) || IsSharded(s.rdb, index)
+}
+
+func (s *RedisStore) Indexes(ctx context.Context) ([]string, error) {
+	return ListIndexes(s.rdb)
+}
+
+func (s *RedisStore) Upsert(ctx context.Context, index string, chunks []Chunk) error {
+	cmds, err := s.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, ch := range chunks {
+			fields := map[string]any{"text": ch.Text, "embedding": float32SliceToLEBytes(ch.Embedding)}
+			for k, v := range ch.Metadata {
+				fields[k] = v
+			}
+			p.HSet(ctx, ch.Key, fields)
+		}
+		return nil
+	})
+	for _, cmd := range cmds {
+		if cmd.Err() != nil {
+			return cmd.Err()
+		}
+	}
+	return err
+}
+
+func (s *RedisStore) DeleteFile(ctx context.Context, index, file string) (int64, error) {
+	var deleted int64
+	for {
+		res, err := s.rdb.Do(ctx, "FT.SEARCH", index, TagFilter("file", file).String(),
+			"NOCONTENT", "LIMIT", 0, 1000, "DIALECT", 2).Result()
+		if err != nil {
+			return deleted, err
+		}
+		reply, err := ParseSearchReply(res, false)
+		if err != nil {
+			return deleted, err
+		}
+		if len(reply.Docs) == 0 {
+			return deleted, nil
+		}
+		keys := make([]string, len(reply.Docs))
+		for n, doc := range reply.Docs {
+			keys[n] = doc.Key
+		}
+		n, err := DeleteKeys(ctx, s.rdb, keys...)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		if n == 0 {
+			// The index still lists keys that are gone; nothing left to delete
+			return deleted, nil
+		}
+	}
+}
+
+func (s *RedisStore) KNN(ctx context.Context, query ChunkQuery, vec []float32) ([]Chunk, error) {
+	return RetrieveChunks(s.rdb, query, vec)
+}
+
+func (s *RedisStore) SearchText(ctx context.Context, query ChunkQuery) ([]Chunk, error) {
+	return SearchText(s.rdb, query)
+}
+
+func (s *RedisStore) Get(ctx context.Context, keys []string) (map[string]Chunk, error) {
+	fields := make([]string, len(docFields))
+	for i, f := range docFields {
+		fields[i] = f.(string)
+	}
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HMGet(ctx, key, fields...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	out := make(map[string]Chunk, len(keys))
+	for i, cmd := range cmds {
+		vals, err := cmd.Result()
+		// HMGET of a missing key returns nil for every field
+		if err != nil || len(vals) == 0 || vals[0] == nil {
+			continue
+		}
+		ch := Chunk{Key: keys[i], Metadata: map[string]string{}}
+		for n, v := range vals {
+			if v == nil {
+				continue
+			}
+			if fields[n] == "text" {
+				ch.Text = toString(v)
+			} else {
+				ch.Metadata[fields[n]] = toString(v)
+			}
+		}
+		out[keys[i]] = ch
+	}
+	return out, nil
+}
+
+func (s *RedisStore) SaveMeta(ctx context.Context, index string, m *index_meta.Metadata) error {
+	return index_meta.Save(ctx, s.rdb, index, m)
+}
+
+func (s *RedisStore) LoadMeta(ctx context.Context, index string) (*index_meta.Metadata, error) {
+	return index_meta.Load(ctx, s.rdb, index)
+}
+
+func (s *RedisStore) Close() error {
+	return s.rdb.Close()
+}
@@ -7,6 +7,10 @@ import (
 	"unicode/utf8"
 )
 
+// Strategy names the chunking algorithm, recorded in index metadata so that
+// indexes built with a different chunker can be told apart.
+const Strategy = "rune-window"
+
 type Chunk struct {
 	Index int
 	Text  string
@@ -59,8 +63,13 @@ func SplitFile(filePath string, chunkSize, overlap int) ([]Chunk, error) {
 		// skip binary or invalid UTF-8 files
 		return nil, nil
 	}
+	return Split(fileContent, chunkSize, overlap), nil
+}
+
+// Split breaks content into numbered chunks with SplitText.
+func Split(content string, chunkSize, overlap int) []Chunk {
 	// Break the string down into chunks
-	chunkStrings := SplitText(fileContent, chunkSize, overlap)
+	chunkStrings := SplitText(content, chunkSize, overlap)
 
 	chunks := make([]Chunk, len(chunkStrings))
 
@@ -72,7 +81,7 @@ func SplitFile(filePath string, chunkSize, overlap int) ([]Chunk, error) {
 		}
 	}
 
-	return chunks, nil
+	return chunks
 }
 
 // ===== Go workers =====
@@ -0,0 +1,265 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults used for unset Settings fields.
+const (
+	DefaultFileWorkers      = 8
+	DefaultEmbedWorkers     = 10
+	DefaultRetrievalWorkers = 4
+	DefaultMinEmbedWorkers  = 1
+	DefaultMaxEmbedWorkers  = 32
+	DefaultBatchSize        = 64
+)
+
+// Write modes for batched Redis writes.
+const (
+	// WritePipeline sends each batch as one pipeline; commands succeed or
+	// fail individually.
+	WritePipeline = "pipeline"
+	// WriteMulti wraps each batch in MULTI/EXEC so it is applied atomically;
+	// on a cluster, atomically per hash slot.
+	WriteMulti = "multi"
+)
+
+// Settings sizes the worker pools of indexing and retrieval and the batches
+// chunks are written in. It is also the "concurrency" section of the project
+// config; zero values mean defaults.
+type Settings struct {
+	// FileWorkers read and chunk files.
+	FileWorkers int `json:"file_workers,omitempty"`
+	// EmbedWorkers call the embedding API and store chunks. In adaptive mode
+	// this is the starting point.
+	EmbedWorkers int `json:"embed_workers,omitempty"`
+	// RetrievalWorkers run index queries concurrently.
+	RetrievalWorkers int `json:"retrieval_workers,omitempty"`
+	// Adaptive grows or shrinks the embedding workers between
+	// MinEmbedWorkers and MaxEmbedWorkers based on latency and errors.
+	Adaptive        bool `json:"adaptive,omitempty"`
+	MinEmbedWorkers int  `json:"min_embed_workers,omitempty"`
+	MaxEmbedWorkers int  `json:"max_embed_workers,omitempty"`
+	// BatchSize is the number of chunk writes sent per Redis round trip;
+	// 1 writes every chunk on its own.
+	BatchSize int `json:"batch_size,omitempty"`
+	// WriteMode is WritePipeline or WriteMulti.
+	WriteMode string `json:"write_mode,omitempty"`
+}
+
+// Override returns s with every non-zero field of o applied on top.
+func (s Settings) Override(o Settings) Settings {
+	if o.FileWorkers > 0 {
+		s.FileWorkers = o.FileWorkers
+	}
+	if o.EmbedWorkers > 0 {
+		s.EmbedWorkers = o.EmbedWorkers
+	}
+	if o.RetrievalWorkers > 0 {
+		s.RetrievalWorkers = o.RetrievalWorkers
+	}
+	if o.Adaptive {
+		s.Adaptive = true
+	}
+	if o.MinEmbedWorkers > 0 {
+		s.MinEmbedWorkers = o.MinEmbedWorkers
+	}
+	if o.MaxEmbedWorkers > 0 {
+		s.MaxEmbedWorkers = o.MaxEmbedWorkers
+	}
+	if o.BatchSize > 0 {
+		s.BatchSize = o.BatchSize
+	}
+	if o.WriteMode != "" {
+		s.WriteMode = o.WriteMode
+	}
+	return s
+}
+
+// Resolve fills unset fields with defaults and keeps the embedding worker
+// range consistent: MinEmbedWorkers <= EmbedWorkers <= MaxEmbedWorkers.
+func (s Settings) Resolve() Settings {
+	if s.FileWorkers <= 0 {
+		s.FileWorkers = DefaultFileWorkers
+	}
+	if s.EmbedWorkers <= 0 {
+		s.EmbedWorkers = DefaultEmbedWorkers
+	}
+	if s.RetrievalWorkers <= 0 {
+		s.RetrievalWorkers = DefaultRetrievalWorkers
+	}
+	if s.MinEmbedWorkers <= 0 {
+		s.MinEmbedWorkers = DefaultMinEmbedWorkers
+	}
+	if s.MaxEmbedWorkers <= 0 {
+		s.MaxEmbedWorkers = max(DefaultMaxEmbedWorkers, s.EmbedWorkers)
+	}
+	if s.MinEmbedWorkers > s.MaxEmbedWorkers {
+		s.MinEmbedWorkers = s.MaxEmbedWorkers
+	}
+	s.EmbedWorkers = min(max(s.EmbedWorkers, s.MinEmbedWorkers), s.MaxEmbedWorkers)
+	if s.BatchSize <= 0 {
+		s.BatchSize = DefaultBatchSize
+	}
+	if s.WriteMode == "" {
+		s.WriteMode = WritePipeline
+	}
+	return s
+}
+
+// Validate reports settings that Resolve cannot fix.
+func (s Settings) Validate() error {
+	switch s.WriteMode {
+	case "", WritePipeline, WriteMulti:
+		return nil
+	}
+	return fmt.Errorf("unknown write mode %q (want %s or %s)", s.WriteMode, WritePipeline, WriteMulti)
+}
+
+// ===== Adaptive limiter =====
+
+// Limiter bounds the number of concurrent calls and adjusts the bound with
+// AIMD (additive increase, multiplicative decrease): after each window of
+// calls it adds one slot while latency stays near the best observed, and
+// halves the limit when calls fail or cuts it by a quarter when latency
+// doubles.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	min     int
+	max     int
+	inUse   int
+	changed chan struct{}
+
+	// current window
+	calls   int
+	errors  int
+	latency time.Duration
+	// baseline tracks the best recent average window latency
+	baseline time.Duration
+
+	stats Stats
+}
+
+// Stats describes how a Limiter behaved over a run.
+type Stats struct {
+	Initial     int
+	Final       int
+	Low         int
+	High        int
+	Adjustments int
+}
+
+// Thresholds of the adjustment policy.
+const (
+	minWindow      = 8
+	maxErrorRate   = 0.1
+	growLatency    = 1.5
+	backoffLatency = 2.0
+	baselineDrift  = 10 // the baseline drifts 1/10th towards slower windows
+)
+
+// NewLimiter creates a limiter starting at initial slots, kept within
+// [low, high].
+func NewLimiter(initial, low, high int) *Limiter {
+	low = max(low, 1)
+	high = max(high, low)
+	initial = min(max(initial, low), high)
+	return &Limiter{
+		limit:   initial,
+		min:     low,
+		max:     high,
+		changed: make(chan struct{}),
+		stats:   Stats{Initial: initial, Final: initial, Low: initial, High: initial},
+	}
+}
+
+// Acquire waits for a free slot or for ctx to be done.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inUse < l.limit {
+			l.inUse++
+			l.mu.Unlock()
+			return nil
+		}
+		wait := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees a slot and records how the call went.
+func (l *Limiter) Release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+	l.calls++
+	l.latency += latency
+	if err != nil {
+		l.errors++
+	}
+	if l.calls >= max(minWindow, l.limit) {
+		l.adjust()
+	}
+	// Wake waiters; they re-check the limit
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Limit returns the current number of slots.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Stats returns the limiter's history so far.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// adjust applies the policy to the finished window. Caller holds l.mu.
+func (l *Limiter) adjust() {
+	avg := l.latency / time.Duration(l.calls)
+	errRate := float64(l.errors) / float64(l.calls)
+	l.calls, l.errors, l.latency = 0, 0, 0
+
+	next := l.limit
+	switch {
+	case errRate > maxErrorRate:
+		next = l.limit / 2
+	case l.baseline > 0 && float64(avg) > backoffLatency*float64(l.baseline):
+		next = l.limit * 3 / 4
+	case l.baseline == 0 || float64(avg) <= growLatency*float64(l.baseline):
+		next = l.limit + 1
+	}
+
+	if errRate <= maxErrorRate {
+		if l.baseline == 0 || avg < l.baseline {
+			l.baseline = avg
+		} else {
+			l.baseline += (avg - l.baseline) / baselineDrift
+		}
+	}
+
+	next = min(max(next, l.min), l.max)
+	if next == l.limit {
+		return
+	}
+	l.limit = next
+	l.stats.Adjustments++
+	l.stats.Final = next
+	l.stats.Low = min(l.stats.Low, next)
+	l.stats.High = max(l.stats.High, next)
+}
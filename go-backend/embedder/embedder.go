@@ -5,11 +5,15 @@ import (
 	"encoding/binary"
 	"fmt"
 	"google.golang.org/api/option"
-	"io/fs"
 	"math"
 	"os"
 	"path/filepath"
 	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/concurrency"
+	"smart-cli/go-backend/file_policy"
+	"smart-cli/go-backend/redactor"
+	"smart-cli/go-backend/workspace"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,12 +29,36 @@ type FileEmbedding struct {
 	Embedding []float32
 }
 
+// DefaultModel is the Vertex AI embedding model used when none is given.
+const DefaultModel = "text-embedding-005"
+
 // Embedder manages embedding files with Vertex AI and storing in Redis
 type Embedder struct {
 	Client        *aiplatform.PredictionClient
-	RDB           *redis.Client
+	RDB           redis.UniversalClient
 	Ctx           context.Context
 	ModelEndpoint string
+	// Model is the embedding model name, e.g. "text-embedding-005"
+	Model string
+	// Policy selects the files EmbedDirectory reads; the default policy is
+	// used when nil.
+	Policy *file_policy.Policy
+	// Redactor, when set, replaces secrets in file contents read by
+	// ReadDirectory before they are embedded.
+	Redactor *redactor.Redactor
+	// Workers is the number of concurrent embedding calls EmbedDirectory
+	// makes; concurrency.DefaultEmbedWorkers when zero.
+	Workers int
+	// BatchSize is the number of hashes storeEmbeddingsInRedis writes per
+	// pipeline; concurrency.DefaultBatchSize when zero.
+	BatchSize int
+}
+
+func (e *Embedder) policy() *file_policy.Policy {
+	if e.Policy == nil {
+		return file_policy.Default()
+	}
+	return e.Policy
 }
 
 // FileData represents a file read from disk
@@ -41,7 +69,7 @@ type FileData struct {
 
 // EmbedderClient creates a new Embedder instance with the Vertex AI Prediction client, Redis client,
 // and context, then returns a pointer to it along with nil error.
-func EmbedderClient(ctx context.Context, credsFile string, rdb *redis.Client, modelEndpoint string) (*Embedder, error) {
+func EmbedderClient(ctx context.Context, credsFile string, rdb redis.UniversalClient, modelEndpoint string) (*Embedder, error) {
 	// Initialize Vertex AI Prediction client using a service account JSON key
 	client, err := aiplatform.NewPredictionClient(ctx, option.WithCredentialsFile(credsFile))
 	if err != nil {
@@ -51,7 +79,10 @@ func EmbedderClient(ctx context.Context, credsFile string, rdb *redis.Client, mo
 	// Load in necessary ID's for embedding model initialization
 	projectID := os.Getenv("GCP_PROJECT_ID")
 	location := os.Getenv("GCP_LOCATION")
-	model := "text-embedding-005"
+	model := modelEndpoint
+	if model == "" {
+		model = DefaultModel
+	}
 
 	endpoint := fmt.Sprintf(
 		"projects/%s/locations/%s/publishers/google/models/%s",
@@ -63,32 +94,17 @@ func EmbedderClient(ctx context.Context, credsFile string, rdb *redis.Client, mo
 		RDB:           rdb,
 		Ctx:           ctx,
 		ModelEndpoint: endpoint,
+		Model:         model,
 	}, nil
 }
 
 // ===== Repo scanning helpers =====
 
-func ShouldSkipDir(name string) bool {
-	// A helper to decide whether a dir should be skipped for processing
-	skipDirs := map[string]struct{}{
-		"venv": {}, "__pycache__": {}, "node_modules": {}, ".git": {},
-	}
-	_, skip := skipDirs[name]
-	return skip
-}
-
-func defaultExtensions() []string {
-	return []string{".go", ".py", ".js", ".ts", ".tsx", ".jsx", ".json", ".md", ".txt", ".yaml", ".yml"}
-}
-
-func isAllowedExtension(path string, allowed []string) bool {
-	use := allowed
-	if len(use) == 0 {
-		use = defaultExtensions()
-	}
-	ext := filepath.Ext(path)
-	for _, a := range use {
-		if ext == a {
+// hasExtension reports whether path has one of the given extensions.
+func hasExtension(path string, extensions []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, a := range extensions {
+		if ext == strings.ToLower(a) {
 			return true
 		}
 	}
@@ -100,9 +116,13 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
-// findProjectRoot walks up from start until it finds a .git or go.mod directory/file.
-// If neither is found, returns the original start directory.
+// findProjectRoot returns the root of the go.work workspace enclosing start,
+// if any. Otherwise it walks up from start until it finds a .git or go.mod
+// directory/file. If neither is found, returns the original start directory.
 func findProjectRoot(start string) string {
+	if ws, err := workspace.Find(start); err == nil && ws != nil {
+		return ws.Root
+	}
 	curr := start
 	for {
 		if fileExists(filepath.Join(curr, ".git")) || fileExists(filepath.Join(curr, "go.mod")) {
@@ -142,30 +162,22 @@ func detectBase(dir string) (string, error) {
 }
 
 // ReadDirectory Will walk through the current directory to read in content
-func ReadDirectory(dir string, extensions []string) (files []FileData, err error) {
+func (e *Embedder) ReadDirectory(dir string, extensions []string) (files []FileData, err error) {
 	// Recursively walks the directory tree starting at dir
-	// Filters by given extensions
+	// Selects files with the embedder's file policy, optionally narrowed to extensions
 	// Returns a slice of FileData structs containing file paths and content
-	newErr := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+	newErr := e.policy().Walk(dir, func(path string) error {
+		if len(extensions) > 0 && !hasExtension(path, extensions) {
+			return nil
+		}
+		ctn, err := os.ReadFile(path)
 		if err != nil {
 			return err
 		}
-		// Handle dirs
-		if d.IsDir() && ShouldSkipDir(d.Name()) {
-			return filepath.SkipDir
-		}
-		// Handle files
-		if !d.IsDir() && isAllowedExtension(path, extensions) {
-			// process file
-			ctn, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			files = append(files, FileData{
-				Path:    path,
-				Content: string(ctn),
-			})
-		}
+		files = append(files, FileData{
+			Path:    path,
+			Content: e.Redactor.Redact(path, string(ctn)),
+		})
 		return nil
 	})
 
@@ -266,6 +278,42 @@ func (e *Embedder) EmbedQuery(userInput string) ([]float32, error) {
 	return queryEmbedding, nil
 }
 
+// EmbedQueries embeds several queries with a single prediction request and
+// returns their embeddings in order.
+func (e *Embedder) EmbedQueries(inputs []string) ([][]float32, error) {
+	instances := make([]*structpb.Value, len(inputs))
+	for i, input := range inputs {
+		instance, err := structpb.NewStruct(map[string]interface{}{
+			"content": input,
+		})
+		if err != nil {
+			return nil, err
+		}
+		instances[i] = structpb.NewStructValue(instance)
+	}
+	// Per-call timeout
+	ctx, cancel := context.WithTimeout(e.Ctx, 20*time.Second)
+	defer cancel()
+
+	resp, err := e.Client.Predict(ctx, &aiplatformpb.PredictRequest{
+		Endpoint:  e.ModelEndpoint,
+		Instances: instances,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("prediction failed: %w", err)
+	}
+	if len(resp.Predictions) != len(inputs) {
+		return nil, fmt.Errorf("got %d predictions for %d queries", len(resp.Predictions), len(inputs))
+	}
+	embeddings := make([][]float32, len(inputs))
+	for i, pred := range resp.Predictions {
+		if embeddings[i], err = parsePrediction(pred); err != nil {
+			return nil, err
+		}
+	}
+	return embeddings, nil
+}
+
 // ===== Redis Helpers =====
 
 // float32ToLEBytes converts a float32 slice to little-endian byte slice for RediSearch VECTOR.
@@ -295,24 +343,46 @@ func (e *Embedder) storeFileEmbeddingInRedis(file FileData, embedding []byte) er
 
 // storeEmbeddingsInRedis writes indexable entries under "<prefix><i>".
 // Each hash contains fields: text, file, chunk, embedding (LE bytes).
+// Hashes are sent in pipelined batches; every entry is attempted and the
+// first failure is reported with the file it belongs to.
 func (e *Embedder) storeEmbeddingsInRedis(prefix string, embeddings []FileEmbedding) (int, error) {
 	if e.RDB == nil {
 		return 0, fmt.Errorf("redis client is nil")
 	}
-	for i, ebd := range embeddings {
-		key := fmt.Sprintf("%s%d", prefix, i)
-		vec := float32ToLEBytes(ebd.Embedding)
-
-		if err := e.RDB.HSet(e.Ctx, key, map[string]interface{}{
-			"text":      ebd.Content,
-			"embedding": vec,
-			"file":      ebd.Path,
-			"chunk":     i,
-		}).Err(); err != nil {
-			return i, fmt.Errorf("failed to store embedding for %s: %w", ebd.Path, err)
+	size := e.BatchSize
+	if size <= 0 {
+		size = concurrency.DefaultBatchSize
+	}
+
+	stored := 0
+	var firstErr error
+	for start := 0; start < len(embeddings); start += size {
+		batch := embeddings[start:min(start+size, len(embeddings))]
+		cmds, err := e.RDB.Pipelined(e.Ctx, func(p redis.Pipeliner) error {
+			for n, ebd := range batch {
+				i := start + n
+				p.HSet(e.Ctx, fmt.Sprintf("%s%d", prefix, i), map[string]interface{}{
+					"text":      ebd.Content,
+					"embedding": float32ToLEBytes(ebd.Embedding),
+					"file":      ebd.Path,
+					"chunk":     i,
+				})
+			}
+			return nil
+		})
+		for n, ebd := range batch {
+			cmdErr := err
+			if n < len(cmds) {
+				cmdErr = cmds[n].Err()
+			}
+			if cmdErr == nil {
+				stored++
+			} else if firstErr == nil {
+				firstErr = fmt.Errorf("failed to store embedding for %s: %w", ebd.Path, cmdErr)
+			}
 		}
 	}
-	return len(embeddings), nil
+	return stored, firstErr
 }
 
 // ===== Public API =====
@@ -348,10 +418,13 @@ func (e *Embedder) EmbedDirectory(dir string, extensions []string) ([]FileEmbedd
 	}
 	// Calling read directory worker
 	wg.Add(1)
-	go ReadDirWorker(base, extensions, fileCh, &wg, errCh)
+	go e.ReadDirWorker(base, extensions, fileCh, &wg, errCh)
 
 	// Spawning embedding workers for each file
-	numWorkers := 10
+	numWorkers := e.Workers
+	if numWorkers <= 0 {
+		numWorkers = concurrency.DefaultEmbedWorkers
+	}
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
@@ -414,10 +487,10 @@ func (e *Embedder) EmbedAndIndex(dir, indexName string, extensions []string) (st
 
 // ===== Goroutine workers =====
 
-func ReadDirWorker(dir string, extensions []string, ch chan<- FileData, wg *sync.WaitGroup, errCh chan<- error) {
+func (e *Embedder) ReadDirWorker(dir string, extensions []string, ch chan<- FileData, wg *sync.WaitGroup, errCh chan<- error) {
 	defer wg.Done()
 	defer close(ch)
-	files, err := ReadDirectory(dir, extensions)
+	files, err := e.ReadDirectory(dir, extensions)
 	if err != nil {
 		errCh <- fmt.Errorf("failed reading %s: %w", dir, err)
 		return
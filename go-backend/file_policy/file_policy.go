@@ -0,0 +1,280 @@
+package file_policy
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxFileSize skips files larger than 1 MiB unless configured otherwise.
+const DefaultMaxFileSize = 1 << 20
+
+// Config is the user-facing file selection configuration, read from the
+// "files" section of the project config.
+type Config struct {
+	// Include, when non-empty, restricts selection to files matching at least
+	// one glob. Exclude removes matching files and prunes matching directories.
+	// Globs are matched against slash-separated root-relative paths; "**"
+	// matches any number of directories, and a glob without "/" matches the
+	// base name at any depth.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// Languages maps a language name to its extensions. Entries are merged
+	// over the defaults; an empty list disables a default language.
+	Languages map[string][]string `json:"languages,omitempty"`
+	// SkipDirs adds directory names to the default skip list.
+	SkipDirs []string `json:"skip_dirs,omitempty"`
+	// MaxFileSize in bytes; 0 uses DefaultMaxFileSize, negative disables it.
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+	// IncludeDotfiles selects dotfiles and descends into dot-directories.
+	IncludeDotfiles bool `json:"include_dotfiles,omitempty"`
+	// FollowSymlinks follows symlinked files and directories; otherwise they
+	// are skipped.
+	FollowSymlinks bool `json:"follow_symlinks,omitempty"`
+}
+
+var defaultLanguages = map[string][]string{
+	"go":         {".go"},
+	"python":     {".py"},
+	"javascript": {".js", ".jsx"},
+	"typescript": {".ts", ".tsx"},
+	"java":       {".java"},
+	"ruby":       {".rb"},
+	"rust":       {".rs"},
+	"c":          {".c", ".h"},
+	"cpp":        {".cpp", ".cc", ".hpp"},
+	"csharp":     {".cs"},
+	"markdown":   {".md"},
+	"text":       {".txt"},
+	"json":       {".json"},
+	"yaml":       {".yaml", ".yml"},
+}
+
+// defaultSkipDirs are pruned in every project: VCS and smartcli state,
+// dependencies and build output, which is generated rather than written.
+var defaultSkipDirs = []string{
+	".git", ".smartcli", "node_modules", "venv", ".venv", "__pycache__",
+	"dist", "build", "out", "target", "bin", "vendor",
+}
+
+// Policy decides which files are walked for indexing, embedding and file
+// resolution.
+type Policy struct {
+	cfg       Config
+	langByExt map[string]string
+	skipDirs  map[string]struct{}
+}
+
+// New builds a Policy from cfg, filling in defaults.
+func New(cfg Config) *Policy {
+	p := &Policy{
+		cfg:       cfg,
+		langByExt: map[string]string{},
+		skipDirs:  map[string]struct{}{},
+	}
+	if p.cfg.MaxFileSize == 0 {
+		p.cfg.MaxFileSize = DefaultMaxFileSize
+	}
+
+	langs := map[string][]string{}
+	for lang, exts := range defaultLanguages {
+		langs[lang] = exts
+	}
+	for lang, exts := range cfg.Languages {
+		langs[lang] = exts
+	}
+	for lang, exts := range langs {
+		for _, ext := range exts {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			p.langByExt[ext] = lang
+		}
+	}
+
+	for _, d := range defaultSkipDirs {
+		p.skipDirs[d] = struct{}{}
+	}
+	for _, d := range cfg.SkipDirs {
+		p.skipDirs[d] = struct{}{}
+	}
+	return p
+}
+
+// Default returns the policy used when no project config exists.
+func Default() *Policy {
+	return New(Config{})
+}
+
+// Language returns the language of path by extension, or "" if the extension
+// is not selected.
+func (p *Policy) Language(path string) string {
+	return p.langByExt[strings.ToLower(filepath.Ext(path))]
+}
+
+// Extensions returns the selected extensions, sorted.
+func (p *Policy) Extensions() []string {
+	out := make([]string, 0, len(p.langByExt))
+	for ext := range p.langByExt {
+		out = append(out, ext)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SkipDir reports whether the directory at rel (root-relative) is pruned.
+func (p *Policy) SkipDir(rel, name string) bool {
+	if _, ok := p.skipDirs[name]; ok {
+		return true
+	}
+	if !p.cfg.IncludeDotfiles && strings.HasPrefix(name, ".") && name != "." {
+		return true
+	}
+	return matchAny(p.cfg.Exclude, rel)
+}
+
+// AllowFile reports whether the file at rel (root-relative) with the given
+// size is selected.
+func (p *Policy) AllowFile(rel string, size int64) bool {
+	name := path.Base(filepath.ToSlash(rel))
+	if !p.cfg.IncludeDotfiles && strings.HasPrefix(name, ".") {
+		return false
+	}
+	if p.Language(name) == "" {
+		return false
+	}
+	if p.cfg.MaxFileSize > 0 && size > p.cfg.MaxFileSize {
+		return false
+	}
+	if len(p.cfg.Include) > 0 && !matchAny(p.cfg.Include, rel) {
+		return false
+	}
+	return !matchAny(p.cfg.Exclude, rel)
+}
+
+// Walk calls fn for every selected file under root, in lexical order.
+// Unreadable entries are skipped. Symlinks are followed only when the policy
+// allows it, and each real directory is visited at most once.
+func (p *Policy) Walk(root string, fn func(path string) error) error {
+	visited := map[string]struct{}{}
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		visited[real] = struct{}{}
+	}
+	return p.walk(root, root, visited, fn)
+}
+
+func (p *Policy) walk(root, dir string, visited map[string]struct{}, fn func(string) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip unreadable entries
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			if path != dir && p.SkipDir(filepath.ToSlash(rel), d.Name()) {
+				return filepath.SkipDir
+			}
+			// A followed link may already have walked this directory
+			if p.cfg.FollowSymlinks && path != dir {
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return filepath.SkipDir
+				}
+				if _, seen := visited[real]; seen {
+					return filepath.SkipDir
+				}
+				visited[real] = struct{}{}
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !p.cfg.FollowSymlinks {
+				return nil
+			}
+			target, err := os.Stat(path)
+			if err != nil {
+				return nil // dangling link
+			}
+			if target.IsDir() {
+				if p.SkipDir(filepath.ToSlash(rel), d.Name()) {
+					return nil
+				}
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return nil
+				}
+				if _, seen := visited[real]; seen {
+					return nil // cycle or already walked
+				}
+				visited[real] = struct{}{}
+				return p.walk(root, path+string(filepath.Separator), visited, fn)
+			}
+			info = target
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if !p.AllowFile(filepath.ToSlash(rel), info.Size()) {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
+// ===== Glob matching =====
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pat := range patterns {
+		if Match(pat, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the slash-separated relative path rel matches the
+// glob pattern. "**" matches zero or more path segments; a pattern without
+// "/" is matched against the base name, which during a walk also covers every
+// parent directory; a trailing "/" is ignored.
+func Match(pattern, rel string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+	rel = strings.TrimPrefix(filepath.ToSlash(rel), "./")
+	if pattern == "" {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			rest := pat[1:]
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(rest, segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
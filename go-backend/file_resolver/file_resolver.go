@@ -1,9 +1,8 @@
 package file_resolver
 
 import (
-	"io/fs"
 	"path/filepath"
-	"smart-cli/go-backend/embedder"
+	"smart-cli/go-backend/file_policy"
 	"sort"
 	"strings"
 )
@@ -17,24 +16,17 @@ type Resolver struct {
 }
 
 // NewRoot constructs a new Resolver and scans all files under the root
-func NewRoot(root string) (*Resolver, error) {
+// that the file policy selects (the default policy when nil)
+func NewRoot(root string, policy *file_policy.Policy) (*Resolver, error) {
 	r := &Resolver{
 		Root:   root,
 		byBase: make(map[string][]string),
 	}
+	if policy == nil {
+		policy = file_policy.Default()
+	}
 
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil // skip unreadable
-		}
-		if d.IsDir() {
-			name := d.Name()
-			// if embedder flags the file, skip it
-			if embedder.ShouldSkipDir(name) {
-				return filepath.SkipDir
-			}
-			return nil // otherwise, continue walking
-		}
+	err := policy.Walk(root, func(path string) error {
 		// Lowercasing the name for lookup
 		base := strings.ToLower(filepath.Base(path))
 		r.byBase[base] = append(r.byBase[base], path)
@@ -47,36 +39,9 @@ func NewRoot(root string) (*Resolver, error) {
 	return r, nil
 }
 
-// Helper to skip dirs like caches and dependencies etc
-func shouldSkipDir(name string) bool {
-	switch strings.ToLower(name) {
-	case ".git", "node_modules", "vendor", "dist", "build", "target", ".venv", "__pycache__":
-		return true
-	}
-	return false
-}
-
 // Helper to see if it's a code file
 func IsCodeFile(name string) bool {
-	ln := strings.ToLower(name)
-	switch {
-	case strings.HasSuffix(ln, ".go"),
-		strings.HasSuffix(ln, ".py"),
-		strings.HasSuffix(ln, ".js"),
-		strings.HasSuffix(ln, ".ts"),
-		strings.HasSuffix(ln, ".tsx"),
-		strings.HasSuffix(ln, ".jsx"),
-		strings.HasSuffix(ln, ".java"),
-		strings.HasSuffix(ln, ".rb"),
-		strings.HasSuffix(ln, ".rs"),
-		strings.HasSuffix(ln, ".cpp"),
-		strings.HasSuffix(ln, ".c"),
-		strings.HasSuffix(ln, ".cs"),
-		strings.HasSuffix(ln, ".md"):
-		return true
-	default:
-		return false
-	}
+	return file_policy.Default().Language(name) != ""
 }
 
 // Helper: Self explanatory name, it prefers to sort by shortest path
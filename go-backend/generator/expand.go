@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Expand asks the model for up to n reformulations of a question about the
+// codebase, for searching alongside it: guesses of the identifiers involved,
+// rephrasings with synonyms, and narrower sub-questions.
+func (g *Generator) Expand(ctx context.Context, question string, n int) ([]string, error) {
+	prompt := fmt.Sprintf(`Rewrite the developer's question about a codebase as %d different queries for a code search engine. Mix these kinds:
+- the identifiers (function, type, variable or file names) the answer most likely involves, e.g. "storeChunk HSet chunk key"
+- rephrasings of the question using synonyms
+- narrower sub-questions it depends on
+
+Question: %s
+
+Reply with only a JSON array of %d strings.`, n, question, n)
+
+	reply, err := g.Generate(ctx, prompt, 0.4, ThinkingTokens)
+	if err != nil {
+		return nil, err
+	}
+	var queries []string
+	if err := ParseJSONArray(reply, &queries); err != nil {
+		return nil, fmt.Errorf("query expansion: %w", err)
+	}
+	return DedupeQueries(question, queries, n), nil
+}
+
+// DedupeQueries returns up to n of queries, trimmed, without blanks and
+// without repeats of question or of each other, ignoring case.
+func DedupeQueries(question string, queries []string, n int) []string {
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(question)): true}
+	out := make([]string, 0, n)
+	for _, q := range queries {
+		q = strings.TrimSpace(q)
+		if key := strings.ToLower(q); q != "" && !seen[key] {
+			seen[key] = true
+			out = append(out, q)
+		}
+	}
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
@@ -2,12 +2,15 @@ package generator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"sort"
 	"strings"
 	"time"
 
 	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/git_history"
+	"smart-cli/go-backend/go_deps"
+	"smart-cli/go-backend/redactor"
 
 	"google.golang.org/genai"
 )
@@ -15,6 +18,8 @@ import (
 type Generator struct {
 	modelName string
 	client    *genai.Client
+	// Redactor, when set, replaces secrets in the prompt before it is sent.
+	Redactor *redactor.Redactor
 }
 
 func NewAgent(ctx context.Context, modelName string) (*Generator, error) {
@@ -34,6 +39,9 @@ func (g *Generator) Answer(ctx context.Context, query string, chunks []chunk_ret
 	// Build retrieved context and assemble the prompt
 	ctxText := buildContext(chunks)
 	prompt := assemblePrompt("", query, ctxText)
+	if g != nil {
+		prompt = g.Redactor.Redact("prompt", prompt)
+	}
 	// Require a configured model
 	if g == nil || g.client == nil {
 		// Fallback: return the prompt preview if model not initialized
@@ -45,16 +53,53 @@ func (g *Generator) Answer(ctx context.Context, query string, chunks []chunk_ret
 	topK := float32(15)
 	maxTokens := int32(2048)
 
-	// Per-call timeout
-	callCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-
-	resp, err := g.client.Models.GenerateContent(callCtx, g.modelName, genai.Text(prompt), &genai.GenerateContentConfig{
+	return g.generate(ctx, prompt, &genai.GenerateContentConfig{
 		Temperature:     &temp,
 		TopP:            &topP,
 		TopK:            &topK,
 		MaxOutputTokens: maxTokens,
 	})
+}
+
+// ThinkingTokens is added to the output limit of a Generate call on top of
+// what the reply needs, as the model's thinking tokens count towards it.
+const ThinkingTokens = 2048
+
+// ParseJSONArray decodes the JSON array in a model reply into v. Models often
+// wrap the array in a code fence or prose, so the outermost brackets are
+// taken.
+func ParseJSONArray(reply string, v any) error {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return fmt.Errorf("no JSON array in reply %q", reply)
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), v); err != nil {
+		return fmt.Errorf("invalid JSON array in reply: %w", err)
+	}
+	return nil
+}
+
+// Generate sends prompt as is, after redaction, and returns the model's
+// reply. Low temperatures suit prompts that expect structured output.
+func (g *Generator) Generate(ctx context.Context, prompt string, temperature float32, maxTokens int32) (string, error) {
+	if g == nil || g.client == nil {
+		return "", fmt.Errorf("no generation model configured")
+	}
+	prompt = g.Redactor.Redact("prompt", prompt)
+	return g.generate(ctx, prompt, &genai.GenerateContentConfig{
+		Temperature:     &temperature,
+		MaxOutputTokens: maxTokens,
+	})
+}
+
+// generate calls the model and joins the text parts of the first candidate
+// that has any.
+func (g *Generator) generate(ctx context.Context, prompt string, cfg *genai.GenerateContentConfig) (string, error) {
+	// Per-call timeout
+	callCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	resp, err := g.client.Models.GenerateContent(callCtx, g.modelName, genai.Text(prompt), cfg)
 
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content: %w", err)
@@ -97,7 +142,8 @@ func (g *Generator) Answer(ctx context.Context, query string, chunks []chunk_ret
 
 // ===== Helpers =====
 
-// Helper: build context (no headers; blank-line separators)
+// Helper: build context (no headers; blank-line separators). Chunks arrive
+// ranked best first, so the budget cuts the least relevant ones.
 func buildContext(chunks []chunk_retriever.Chunk) string {
 	const charBudget = 50000
 	if len(chunks) == 0 {
@@ -105,11 +151,6 @@ func buildContext(chunks []chunk_retriever.Chunk) string {
 		return ""
 	}
 
-	// Sort by ascending distance (lower score = better)
-	sort.SliceStable(chunks, func(i, j int) bool {
-		return chunks[i].Score < chunks[j].Score
-	})
-
 	// Start building context
 	var builder strings.Builder
 	chunksAdded := 0
@@ -119,6 +160,14 @@ func buildContext(chunks []chunk_retriever.Chunk) string {
 		if txt == "" {
 			continue
 		}
+		// Label dependency API excerpts and history so they are not mistaken for project code
+		switch ch.Metadata["source"] {
+		case go_deps.Source:
+			txt = fmt.Sprintf("[dependency %s]\n%s", ch.Metadata["module"], txt)
+		case git_history.Source:
+			txt = fmt.Sprintf("[commit %s by %s on %s]\n%s",
+				ch.Metadata["commit"], ch.Metadata["author"], ch.Metadata["date"], txt)
+		}
 		// Calculate space needed (text + separator)
 		separator := ""
 		if builder.Len() > 0 {
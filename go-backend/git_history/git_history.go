@@ -0,0 +1,173 @@
+package git_history
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Source is the value of the "source" tag on history chunks.
+const Source = "history"
+
+// IndexName returns the history index kept alongside the project index.
+func IndexName(projectIndex string) string {
+	return projectIndex + "_history"
+}
+
+// Commit is one entry of git log with its per-file diffs.
+type Commit struct {
+	SHA     string
+	Author  string
+	Email   string
+	Date    string
+	Subject string
+	Body    string
+	Files   []FileDiff
+}
+
+// FileDiff holds the diff hunks of one file in a commit.
+type FileDiff struct {
+	Path  string
+	Hunks string
+}
+
+// Document is a unit of history text to chunk and embed: a commit message or
+// one file's diff. ID is unique across the history and is used as the chunk's
+// path; Fields are stored with every chunk of the document.
+type Document struct {
+	ID     string
+	Text   string
+	Fields map[string]string
+}
+
+// Field separators in the git log format; they cannot occur in commit text.
+const (
+	recordSep = "\x1e"
+	fieldSep  = "\x1f"
+)
+
+// Log reads up to limit non-merge commits (all when limit <= 0) of the
+// repository at dir, newest first, including their patches.
+func Log(ctx context.Context, dir string, limit int) ([]Commit, error) {
+	args := []string{
+		"-C", dir, "log", "--no-merges", "--no-color", "--no-ext-diff",
+		"--date=iso-strict", "--patch", "--unified=3",
+		"--format=" + recordSep + strings.Join([]string{"%H", "%an", "%ae", "%ad", "%s", "%b"}, fieldSep) + fieldSep,
+	}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", limit))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git log in %s: %w: %s", dir, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseLog(stdout.String()), nil
+}
+
+// Documents splits commits into documents: one per commit message and one per
+// changed file. allow filters files by path and diff size; nil allows all.
+func Documents(commits []Commit, allow func(path string, size int64) bool) []Document {
+	var docs []Document
+	for _, c := range commits {
+		fields := map[string]string{
+			"commit":  c.SHA,
+			"author":  c.Author,
+			"date":    c.Date,
+			"subject": c.Subject,
+			"file":    "",
+		}
+
+		var paths []string
+		for _, f := range c.Files {
+			paths = append(paths, f.Path)
+		}
+		var msg strings.Builder
+		fmt.Fprintf(&msg, "commit %s\nAuthor: %s <%s>\nDate: %s\n\n%s\n", c.SHA, c.Author, c.Email, c.Date, c.Subject)
+		if c.Body != "" {
+			fmt.Fprintf(&msg, "\n%s\n", c.Body)
+		}
+		if len(paths) > 0 {
+			fmt.Fprintf(&msg, "\nFiles changed: %s\n", strings.Join(paths, ", "))
+		}
+		docs = append(docs, Document{ID: c.SHA, Text: msg.String(), Fields: fields})
+
+		for _, f := range c.Files {
+			if f.Hunks == "" || (allow != nil && !allow(f.Path, int64(len(f.Hunks)))) {
+				continue
+			}
+			ff := map[string]string{"file": f.Path}
+			for k, v := range fields {
+				if k != "file" {
+					ff[k] = v
+				}
+			}
+			docs = append(docs, Document{
+				ID:     c.SHA + "/" + f.Path,
+				Text:   fmt.Sprintf("commit %s: %s\nFile: %s\n\n%s", c.SHA, c.Subject, f.Path, f.Hunks),
+				Fields: ff,
+			})
+		}
+	}
+	return docs
+}
+
+// ===== Helpers =====
+
+func parseLog(out string) []Commit {
+	var commits []Commit
+	for _, rec := range strings.Split(out, recordSep) {
+		parts := strings.SplitN(rec, fieldSep, 7)
+		if len(parts) < 7 {
+			continue
+		}
+		commits = append(commits, Commit{
+			SHA:     strings.TrimSpace(parts[0]),
+			Author:  parts[1],
+			Email:   parts[2],
+			Date:    parts[3],
+			Subject: parts[4],
+			Body:    strings.TrimSpace(parts[5]),
+			Files:   parseDiff(parts[6]),
+		})
+	}
+	return commits
+}
+
+// parseDiff splits a commit's patch into per-file hunks. Binary changes and
+// pure renames, which have no hunks, are returned with empty Hunks.
+func parseDiff(patch string) []FileDiff {
+	var files []FileDiff
+	for _, section := range strings.Split("\n"+patch, "\ndiff --git ")[1:] {
+		lines := strings.Split(section, "\n")
+		var f FileDiff
+		// "a/<old> b/<new>"; prefer the +++/--- lines, which are unambiguous
+		if i := strings.LastIndex(lines[0], " b/"); i >= 0 {
+			f.Path = lines[0][i+3:]
+		}
+		hunkStart := -1
+		for n, line := range lines {
+			switch {
+			case strings.HasPrefix(line, "+++ b/"):
+				f.Path = strings.TrimPrefix(line, "+++ b/")
+			case strings.HasPrefix(line, "--- a/") && f.Path == "":
+				f.Path = strings.TrimPrefix(line, "--- a/")
+			case strings.HasPrefix(line, "@@"):
+				hunkStart = n
+			}
+			if hunkStart >= 0 {
+				break
+			}
+		}
+		if hunkStart >= 0 {
+			f.Hunks = strings.TrimRight(strings.Join(lines[hunkStart:], "\n"), "\n")
+		}
+		if f.Path != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
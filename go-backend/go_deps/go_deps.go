@@ -0,0 +1,279 @@
+package go_deps
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/modfile"
+
+	"smart-cli/go-backend/file_policy"
+	"smart-cli/go-backend/workspace"
+)
+
+// Source is the value of the "source" tag on dependency chunks.
+const Source = "dependency"
+
+// IndexName returns the dependency index kept alongside the project index.
+func IndexName(projectIndex string) string {
+	return projectIndex + "_deps"
+}
+
+// Module is a required module and where its source lives locally.
+type Module struct {
+	Path    string
+	Version string
+	// Indirect is set for requirements marked "// indirect".
+	Indirect bool
+	// Dir is the module's directory in the module cache, or the target of a
+	// local replace directive.
+	Dir string
+}
+
+// ID returns "path@version", the module tag of the module's chunks.
+func (m Module) ID() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
+}
+
+// ModCache returns the module cache directory: GOMODCACHE, else
+// $GOPATH/pkg/mod, else ~/go/pkg/mod.
+func ModCache() string {
+	if v := os.Getenv("GOMODCACHE"); v != "" {
+		return v
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		gopath = filepath.Join(home, "go")
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
+
+// Resolve parses the requirements of gomod and locates each one under
+// cacheDir. Replace directives are applied. Modules missing from the cache
+// (run `go mod download`) are returned in missing.
+func Resolve(gomod, cacheDir string, includeIndirect bool) (found, missing []Module, err error) {
+	reqs, replaces, err := parseGoMod(gomod)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range reqs {
+		if m.Indirect && !includeIndirect {
+			continue
+		}
+		if r, ok := replaces[m.Path+"@"+m.Version]; ok {
+			m = r.apply(m, filepath.Dir(gomod))
+		} else if r, ok := replaces[m.Path]; ok {
+			m = r.apply(m, filepath.Dir(gomod))
+		}
+		if m.Dir == "" {
+			m.Dir = filepath.Join(cacheDir, EscapePath(m.Path)+"@"+EscapePath(m.Version))
+		}
+		if fi, err := os.Stat(m.Dir); err != nil || !fi.IsDir() {
+			missing = append(missing, m)
+			continue
+		}
+		found = append(found, m)
+	}
+	return found, missing, nil
+}
+
+// Workspace arranges modules as a workspace rooted at cacheDir, so the
+// indexer walks each module and tags its chunks with Module.ID.
+func Workspace(cacheDir string, mods []Module) *workspace.Workspace {
+	ws := &workspace.Workspace{Root: cacheDir, Source: "go.mod"}
+	for _, m := range mods {
+		rel, err := filepath.Rel(cacheDir, m.Dir)
+		if err != nil {
+			rel = m.Dir
+		}
+		ws.Modules = append(ws.Modules, workspace.Module{Name: m.ID(), Dir: m.Dir, Rel: filepath.ToSlash(rel)})
+	}
+	return ws
+}
+
+// Policy selects the non-test Go files of a module's public packages.
+func Policy() *file_policy.Policy {
+	return file_policy.New(file_policy.Config{
+		Include: []string{"*.go"},
+		Exclude: []string{"*_test.go", "internal", "testdata", "example", "examples"},
+	})
+}
+
+// EscapePath applies the module cache's case encoding: each upper-case
+// letter becomes "!" followed by its lower-case form.
+func EscapePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ExportedAPI returns the exported API surface of a Go file: the package
+// clause and doc, and every exported declaration with its doc comment.
+// Function bodies and unexported identifiers are dropped. It returns "" when
+// the file exports nothing.
+func ExportedAPI(path string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	if !ast.FileExports(f) {
+		return "", nil
+	}
+
+	var b strings.Builder
+	if f.Doc != nil {
+		writeDoc(&b, f.Doc)
+	}
+	fmt.Fprintf(&b, "package %s\n", f.Name.Name)
+
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	exported := 0
+	for _, decl := range f.Decls {
+		var doc *ast.CommentGroup
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && !exportedRecv(d.Recv) {
+				continue
+			}
+			doc, d.Doc, d.Body = d.Doc, nil, nil
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			doc, d.Doc = d.Doc, nil
+			stripSpecDocs(d)
+		default:
+			continue
+		}
+		var buf bytes.Buffer
+		if err := cfg.Fprint(&buf, fset, decl); err != nil {
+			return "", err
+		}
+		b.WriteString("\n")
+		if doc != nil {
+			writeDoc(&b, doc)
+		}
+		b.Write(buf.Bytes())
+		b.WriteString("\n")
+		exported++
+	}
+	if exported == 0 {
+		return "", nil
+	}
+	return b.String(), nil
+}
+
+// ===== Helpers =====
+
+type replacement struct {
+	path, version, dir string
+}
+
+func (r replacement) apply(m Module, modDir string) Module {
+	if r.dir != "" {
+		m.Dir = r.dir
+		if !filepath.IsAbs(m.Dir) {
+			m.Dir = filepath.Join(modDir, m.Dir)
+		}
+		return m
+	}
+	m.Path, m.Version = r.path, r.version
+	return m
+}
+
+// parseGoMod reads the require and replace directives of a go.mod file.
+// Replacements are keyed by "path@version" or, for all versions, "path".
+func parseGoMod(gomod string) ([]Module, map[string]replacement, error) {
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reqs := make([]Module, 0, len(f.Require))
+	for _, r := range f.Require {
+		reqs = append(reqs, Module{Path: r.Mod.Path, Version: r.Mod.Version, Indirect: r.Indirect})
+	}
+	replaces := map[string]replacement{}
+	for _, r := range f.Replace {
+		key := r.Old.Path
+		if r.Old.Version != "" {
+			key += "@" + r.Old.Version
+		}
+		if r.New.Version == "" {
+			// A replacement without a version is a local directory
+			replaces[key] = replacement{dir: r.New.Path}
+		} else {
+			replaces[key] = replacement{path: r.New.Path, version: r.New.Version}
+		}
+	}
+	return reqs, replaces, nil
+}
+
+func exportedRecv(recv *ast.FieldList) bool {
+	if len(recv.List) == 0 {
+		return false
+	}
+	t := recv.List[0].Type
+	for {
+		switch x := t.(type) {
+		case *ast.StarExpr:
+			t = x.X
+		case *ast.IndexExpr:
+			t = x.X
+		case *ast.IndexListExpr:
+			t = x.X
+		case *ast.Ident:
+			return x.IsExported()
+		default:
+			return false
+		}
+	}
+}
+
+// stripSpecDocs drops per-spec comments, which the printer would otherwise
+// misplace once declarations are printed without the file's comment list.
+func stripSpecDocs(d *ast.GenDecl) {
+	for _, s := range d.Specs {
+		switch sp := s.(type) {
+		case *ast.TypeSpec:
+			sp.Doc, sp.Comment = nil, nil
+		case *ast.ValueSpec:
+			sp.Doc, sp.Comment = nil, nil
+		}
+	}
+}
+
+func writeDoc(b *strings.Builder, doc *ast.CommentGroup) {
+	for _, line := range strings.Split(strings.TrimRight(doc.Text(), "\n"), "\n") {
+		if line == "" {
+			b.WriteString("//\n")
+			continue
+		}
+		b.WriteString("// " + line + "\n")
+	}
+}
@@ -0,0 +1,513 @@
+package index_manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/re_indexer"
+)
+
+// Info combines FT.INFO statistics with smartcli's own bookkeeping for an index.
+type Info struct {
+	// Name is the name that was looked up; IndexName is the index it resolves
+	// to, which differs when Name is an alias.
+	Name           string
+	IndexName      string
+	NumDocs        int64
+	MemoryMB       float64
+	VectorDim      int
+	DistanceMetric string
+	Prefixes       []string
+	// Aliases lists the smartcli-managed aliases pointing at IndexName.
+	Aliases []string
+
+	Meta         *index_meta.Metadata
+	Run          *re_indexer.RunState
+	FailedChunks int64
+}
+
+// IsAlias reports whether the looked-up name is an alias of another index.
+func (in *Info) IsAlias() bool {
+	return in.Name != in.IndexName
+}
+
+// List returns every index with its info, sorted by name.
+func List(ctx context.Context, rdb redis.UniversalClient) ([]*Info, error) {
+	names, err := chunk_retriever.ListIndexes(rdb)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	out := make([]*Info, 0, len(names))
+	for _, name := range names {
+		info, err := GetInfo(ctx, rdb, name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// GetInfo runs FT.INFO for name and loads smartcli metadata for the index.
+func GetInfo(ctx context.Context, rdb redis.UniversalClient, name string) (*Info, error) {
+	res, err := rdb.Do(ctx, "FT.INFO", name).Result()
+	if err != nil {
+		return nil, fmt.Errorf("FT.INFO %s: %w", name, err)
+	}
+	fields := pairs(res)
+
+	info := &Info{
+		Name:      name,
+		IndexName: toString(fields["index_name"]),
+		NumDocs:   int64(toFloat(fields["num_docs"])),
+		MemoryMB:  memoryMB(fields),
+	}
+	if info.IndexName == "" {
+		info.IndexName = name
+	}
+
+	def := pairs(fields["index_definition"])
+	if prefixes, ok := def["prefixes"].([]interface{}); ok {
+		for _, p := range prefixes {
+			info.Prefixes = append(info.Prefixes, toString(p))
+		}
+	}
+
+	if attrs, ok := fields["attributes"].([]interface{}); ok {
+		for _, a := range attrs {
+			attr := pairs(a)
+			if strings.EqualFold(toString(attr["type"]), "VECTOR") {
+				info.VectorDim = int(toFloat(attr["dim"]))
+				info.DistanceMetric = toString(attr["distance_metric"])
+			}
+		}
+	}
+
+	if info.Aliases, err = index_meta.AliasesOf(ctx, rdb, info.IndexName); err != nil {
+		return nil, err
+	}
+	if info.Meta, err = index_meta.Load(ctx, rdb, info.IndexName); err != nil {
+		return nil, err
+	}
+	// Run state is kept per alias; indexes built before aliases keep it under their own name
+	runName := name
+	if !info.IsAlias() && len(info.Aliases) > 0 {
+		runName = info.Aliases[0]
+	}
+	if info.Run, err = re_indexer.LoadRunState(ctx, rdb, runName); err != nil {
+		return nil, err
+	}
+	if info.FailedChunks, err = re_indexer.FailedCount(ctx, rdb, info.IndexName); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Drop deletes the index, every key under its prefixes and smartcli's
+// bookkeeping keys. Dropping an alias drops the index it points at, any
+// unactivated version being built for it, and the alias itself. Dropping a
+// sharded index drops every shard and the shard set.
+// It returns the number of keys deleted.
+func Drop(ctx context.Context, rdb redis.UniversalClient, name string) (int64, error) {
+	set, err := index_meta.LoadShardSet(ctx, rdb, name)
+	if err != nil {
+		return 0, err
+	}
+	if set != nil {
+		return dropShards(ctx, rdb, set)
+	}
+
+	info, err := GetInfo(ctx, rdb, name)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsAlias() {
+		return dropIndex(ctx, rdb, info)
+	}
+
+	deleted, err := dropIndex(ctx, rdb, info)
+	if err != nil {
+		return deleted, err
+	}
+	if info.Run != nil && info.Run.Target != "" && info.Run.Target != info.IndexName {
+		if building, err := GetInfo(ctx, rdb, info.Run.Target); err == nil {
+			n, err := dropIndex(ctx, rdb, building)
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+		}
+	}
+	// FT.DROPINDEX normally removes the alias too; make sure it is gone
+	_ = rdb.Do(ctx, "FT.ALIASDEL", name).Err()
+	if err := index_meta.DeleteAlias(ctx, rdb, name); err != nil {
+		return deleted, err
+	}
+	n, err := rdb.Del(ctx, re_indexer.RunStateKey(name)).Result()
+	return deleted + n, err
+}
+
+// dropShards drops every shard of set that exists, then the set itself.
+func dropShards(ctx context.Context, rdb redis.UniversalClient, set *index_meta.ShardSet) (int64, error) {
+	var deleted int64
+	for _, shard := range set.Shards() {
+		if !exists(ctx, rdb, shard) {
+			continue
+		}
+		n, err := Drop(ctx, rdb, shard)
+		deleted += n
+		if err != nil {
+			return deleted, fmt.Errorf("shard %s: %w", shard, err)
+		}
+	}
+	return deleted, index_meta.DeleteShardSet(ctx, rdb, set.Name)
+}
+
+// rejectSharded returns an error when name is a shard set, which op cannot
+// handle as a whole; its shards can still be managed one by one.
+func rejectSharded(ctx context.Context, rdb redis.UniversalClient, name, op string) error {
+	set, err := index_meta.LoadShardSet(ctx, rdb, name)
+	if err != nil {
+		return err
+	}
+	if set != nil {
+		return fmt.Errorf("%q is a sharded index and cannot be %s as a whole; use its shards (%s)",
+			name, op, strings.Join(set.Shards(), ", "))
+	}
+	return nil
+}
+
+// dropIndex drops a single (non-alias) index with its keys and state.
+func dropIndex(ctx context.Context, rdb redis.UniversalClient, info *Info) (int64, error) {
+	name := info.IndexName
+	if err := rdb.Do(ctx, "FT.DROPINDEX", name).Err(); err != nil {
+		return 0, fmt.Errorf("FT.DROPINDEX %s: %w", name, err)
+	}
+
+	var deleted int64
+	for _, prefix := range info.Prefixes {
+		n, err := deleteByPrefix(ctx, rdb, prefix)
+		deleted += n
+		if err != nil {
+			return deleted, fmt.Errorf("index dropped but deleting keys under %q failed: %w", prefix, err)
+		}
+	}
+	for _, alias := range info.Aliases {
+		if err := index_meta.DeleteAlias(ctx, rdb, alias); err != nil {
+			return deleted, err
+		}
+	}
+	n, err := chunk_retriever.DeleteKeys(ctx, rdb, append(stateKeys(name), re_indexer.RunStateKey(name))...)
+	if err != nil {
+		return deleted, fmt.Errorf("index dropped but deleting smartcli state failed: %w", err)
+	}
+	return deleted + n, nil
+}
+
+// Rename renames an index. Renaming an alias re-points a new alias at the
+// same index. Renaming an index creates the new index first, moves every key
+// from the old prefix to "<newName>:" without overwriting (RENAMENX, or DUMP
+// and RESTORE on a cluster), re-points its aliases and then drops the old,
+// now-empty index, so the documents are never deleted. Sharded indexes are
+// rejected.
+func Rename(ctx context.Context, rdb redis.UniversalClient, oldName, newName string) (moved int64, err error) {
+	if oldName == newName {
+		return 0, fmt.Errorf("old and new names are the same")
+	}
+	if err := rejectSharded(ctx, rdb, oldName, "renamed"); err != nil {
+		return 0, err
+	}
+	info, err := GetInfo(ctx, rdb, oldName)
+	if err != nil {
+		return 0, err
+	}
+	if exists(ctx, rdb, newName) {
+		return 0, fmt.Errorf("an index or alias named %q already exists", newName)
+	}
+
+	if info.IsAlias() {
+		if err := rdb.Do(ctx, "FT.ALIASADD", newName, info.IndexName).Err(); err != nil {
+			return 0, fmt.Errorf("FT.ALIASADD %s: %w", newName, err)
+		}
+		if err := rdb.Do(ctx, "FT.ALIASDEL", oldName).Err(); err != nil {
+			return 0, fmt.Errorf("alias %q added but FT.ALIASDEL %s failed: %w", newName, oldName, err)
+		}
+		if err := index_meta.SetAlias(ctx, rdb, newName, info.IndexName); err != nil {
+			return 0, err
+		}
+		if err := index_meta.DeleteAlias(ctx, rdb, oldName); err != nil {
+			return 0, err
+		}
+		return 0, renameIfExists(ctx, rdb, re_indexer.RunStateKey(oldName), re_indexer.RunStateKey(newName))
+	}
+
+	if info.VectorDim == 0 {
+		return 0, fmt.Errorf("index %q has no vector field; only smartcli indexes can be renamed", oldName)
+	}
+	newPrefix := newName + ":"
+	if err := chunk_retriever.EnsureIndex(rdb, newName, newPrefix, info.VectorDim); err != nil {
+		return 0, err
+	}
+
+	for _, prefix := range info.Prefixes {
+		n, err := renameByPrefix(ctx, rdb, prefix, newPrefix)
+		moved += n
+		if err != nil {
+			return moved, fmt.Errorf("moved %d keys to %q before failing; the rest are still under %q: %w", moved, newName, prefix, err)
+		}
+	}
+
+	// Re-point aliases before dropping the old index, which would delete them
+	for _, alias := range info.Aliases {
+		if err := rdb.Do(ctx, "FT.ALIASUPDATE", alias, newName).Err(); err != nil {
+			return moved, fmt.Errorf("keys moved but FT.ALIASUPDATE %s failed: %w", alias, err)
+		}
+		if err := index_meta.SetAlias(ctx, rdb, alias, newName); err != nil {
+			return moved, err
+		}
+		if err := retargetRun(ctx, rdb, alias, oldName, newName); err != nil {
+			return moved, fmt.Errorf("keys moved but updating the run state of %s failed: %w", alias, err)
+		}
+	}
+
+	if err := rdb.Do(ctx, "FT.DROPINDEX", oldName).Err(); err != nil {
+		return moved, fmt.Errorf("keys moved but FT.DROPINDEX %s failed: %w", oldName, err)
+	}
+
+	oldKeys := append(stateKeys(oldName), re_indexer.RunStateKey(oldName))
+	newKeys := append(stateKeys(newName), re_indexer.RunStateKey(newName))
+	for i := range oldKeys {
+		if err := renameIfExists(ctx, rdb, oldKeys[i], newKeys[i]); err != nil {
+			return moved, fmt.Errorf("index renamed but moving %s failed: %w", oldKeys[i], err)
+		}
+	}
+	return moved, nil
+}
+
+// renameIfExists moves oldKey to newKey. When there is no oldKey, newKey is
+// deleted instead, so state left by an earlier index of the new name does
+// not show up as this one's.
+func renameIfExists(ctx context.Context, rdb redis.UniversalClient, oldKey, newKey string) error {
+	n, err := rdb.Exists(ctx, oldKey).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return rdb.Del(ctx, newKey).Err()
+	}
+	_, err = moveKey(ctx, rdb, oldKey, newKey, true)
+	return err
+}
+
+// retargetRun points the run state of alias at newTarget if it recorded
+// oldTarget, the index just renamed.
+func retargetRun(ctx context.Context, rdb redis.UniversalClient, alias, oldTarget, newTarget string) error {
+	st, err := re_indexer.LoadRunState(ctx, rdb, alias)
+	if err != nil || st == nil || st.Target != oldTarget {
+		return err
+	}
+	return rdb.HSet(ctx, re_indexer.RunStateKey(alias), "target", newTarget).Err()
+}
+
+// moveKey renames oldKey to newKey, replacing an existing newKey only if
+// replace is set; it reports false when newKey exists and was kept. A cluster
+// rejects RENAME across hash slots, so there the key is copied with DUMP and
+// RESTORE and then deleted. That copy is not atomic, and the key loses its
+// TTL, which smartcli keys do not have.
+func moveKey(ctx context.Context, rdb redis.UniversalClient, oldKey, newKey string, replace bool) (bool, error) {
+	if _, ok := rdb.(*redis.ClusterClient); !ok {
+		if replace {
+			return true, rdb.Rename(ctx, oldKey, newKey).Err()
+		}
+		return rdb.RenameNX(ctx, oldKey, newKey).Result()
+	}
+	dump, err := rdb.Dump(ctx, oldKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("DUMP %s: %w", oldKey, err)
+	}
+	if replace {
+		err = rdb.RestoreReplace(ctx, newKey, 0, dump).Err()
+	} else {
+		err = rdb.Restore(ctx, newKey, 0, dump).Err()
+		if err != nil && strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return false, nil
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("RESTORE %s: %w", newKey, err)
+	}
+	return true, rdb.Del(ctx, oldKey).Err()
+}
+
+// ===== Helpers =====
+
+// stateKeys lists every smartcli-owned key that belongs to an index.
+func stateKeys(indexName string) []string {
+	return append(re_indexer.StateKeys(indexName), index_meta.Key(indexName))
+}
+
+func exists(ctx context.Context, rdb redis.UniversalClient, name string) bool {
+	return rdb.Do(ctx, "FT.INFO", name).Err() == nil
+}
+
+// scanPrefix calls fn with batches of keys that start with prefix. On a
+// cluster every master is scanned, as SCAN only covers the node it runs on.
+func scanPrefix(ctx context.Context, rdb redis.UniversalClient, prefix string, fn func(keys []string) error) error {
+	if cluster, ok := rdb.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanPrefix(ctx, node, prefix, func(keys []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				return fn(keys)
+			})
+		})
+	}
+	match := escapeGlob(prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, match, 500).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func deleteByPrefix(ctx context.Context, rdb redis.UniversalClient, prefix string) (int64, error) {
+	var deleted int64
+	err := scanPrefix(ctx, rdb, prefix, func(keys []string) error {
+		// A cluster rejects multi-key commands spanning hash slots
+		if _, ok := rdb.(*redis.ClusterClient); ok {
+			cmds, err := rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+				for _, key := range keys {
+					p.Unlink(ctx, key)
+				}
+				return nil
+			})
+			for _, cmd := range cmds {
+				deleted += cmd.(*redis.IntCmd).Val()
+			}
+			return err
+		}
+		n, err := rdb.Unlink(ctx, keys...).Result()
+		deleted += n
+		return err
+	})
+	return deleted, err
+}
+
+func renameByPrefix(ctx context.Context, rdb redis.UniversalClient, oldPrefix, newPrefix string) (int64, error) {
+	// Collect first: renaming while scanning can make SCAN miss or repeat keys
+	var keys []string
+	if err := scanPrefix(ctx, rdb, oldPrefix, func(batch []string) error {
+		keys = append(keys, batch...)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for _, key := range keys {
+		target := newPrefix + strings.TrimPrefix(key, oldPrefix)
+		ok, err := moveKey(ctx, rdb, key, target, false)
+		if err != nil {
+			return moved, err
+		}
+		if !ok {
+			return moved, fmt.Errorf("target key %q already exists", target)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// escapeGlob escapes SCAN MATCH metacharacters so prefix is matched literally.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// memoryMB prefers the total reported by newer RediSearch versions and
+// otherwise sums the individual size fields.
+func memoryMB(fields map[string]any) float64 {
+	if v, ok := fields["total_index_memory_sz_mb"]; ok {
+		return toFloat(v)
+	}
+	var total float64
+	for _, k := range []string{
+		"inverted_sz_mb", "vector_index_sz_mb", "offset_vectors_sz_mb",
+		"doc_table_size_mb", "sortable_values_size_mb", "key_table_size_mb",
+	} {
+		total += toFloat(fields[k])
+	}
+	return total
+}
+
+// pairs normalises a RESP3 map or a RESP2 flat key/value array into a map.
+func pairs(v any) map[string]any {
+	out := map[string]any{}
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		for k, val := range t {
+			out[toString(k)] = val
+		}
+	case map[string]interface{}:
+		for k, val := range t {
+			out[k] = val
+		}
+	case []interface{}:
+		for i := 0; i+1 < len(t); i += 2 {
+			out[toString(t[i])] = t[i+1]
+		}
+	}
+	return out
+}
+
+func toString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+func toFloat(v any) float64 {
+	switch t := v.(type) {
+	case int64:
+		return float64(t)
+	case float64:
+		return t
+	default:
+		f, _ := strconv.ParseFloat(toString(v), 64)
+		return f
+	}
+}
@@ -0,0 +1,302 @@
+package index_manager
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/re_indexer"
+)
+
+// Snapshot archives are gzip-compressed JSON streams: a SnapshotManifest
+// followed by one record per chunk. File paths are stored relative to the
+// indexed root so a snapshot can be imported into any checkout.
+const (
+	SnapshotFormat  = "smartcli-index-snapshot"
+	SnapshotVersion = 1
+)
+
+// snapshotBatch is the number of chunks read or written per pipeline.
+const snapshotBatch = 500
+
+// SnapshotManifest describes the index a snapshot was taken from.
+type SnapshotManifest struct {
+	Format        string `json:"format"`
+	Version       int    `json:"version"`
+	Index         string `json:"index"`
+	Model         string `json:"model"`
+	Dim           int    `json:"dim"`
+	Chunker       string `json:"chunker"`
+	ChunkSize     int    `json:"chunk_size"`
+	Overlap       int    `json:"overlap"`
+	SchemaVersion int    `json:"schema_version"`
+	Root          string `json:"root"`
+	CreatedAt     string `json:"created_at"`
+	ExportedAt    string `json:"exported_at"`
+	// Chunks is the number of keys found under the index prefixes.
+	Chunks int `json:"chunks"`
+}
+
+// snapshotRecord is one stored chunk. Embedding holds the raw little-endian
+// float32 vector, which encoding/json writes as base64.
+type snapshotRecord struct {
+	File      string            `json:"file"`
+	Chunk     int               `json:"chunk"`
+	Text      string            `json:"text"`
+	Embedding []byte            `json:"embedding"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// ImportOptions controls where a snapshot is restored.
+type ImportOptions struct {
+	// Name is the alias to import into; defaults to the exported index name.
+	Name string
+	// Root is the local checkout that relative paths are resolved against.
+	Root string
+	// Force allows importing over an existing index of the same name.
+	Force bool
+}
+
+// Export writes every chunk of index name to w as a snapshot archive.
+// Stored paths are made relative to root, or to the root recorded in the
+// index metadata when root is empty. Sharded indexes are rejected.
+func Export(ctx context.Context, rdb redis.UniversalClient, name, root string, w io.Writer) (*SnapshotManifest, error) {
+	if err := rejectSharded(ctx, rdb, name, "exported"); err != nil {
+		return nil, err
+	}
+	info, err := GetInfo(ctx, rdb, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SnapshotManifest{
+		Format:     SnapshotFormat,
+		Version:    SnapshotVersion,
+		Index:      name,
+		Dim:        info.VectorDim,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if meta := info.Meta; meta != nil {
+		m.Model, m.Chunker = meta.Model, meta.Chunker
+		m.ChunkSize, m.Overlap = meta.ChunkSize, meta.Overlap
+		m.SchemaVersion, m.Root, m.CreatedAt = meta.Version, meta.Root, meta.CreatedAt
+		if meta.Dim != 0 {
+			m.Dim = meta.Dim
+		}
+	}
+	if m.Dim == 0 {
+		return nil, fmt.Errorf("index %q has no vector dimension; nothing to export", name)
+	}
+	if root != "" {
+		m.Root = root
+	}
+	if m.Root == "" {
+		return nil, fmt.Errorf("index %q records no root directory; pass --root with the checkout it was built from", name)
+	}
+
+	prefixes := info.Prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{info.IndexName + ":"}
+	}
+	var keys []string
+	for _, prefix := range prefixes {
+		if err := scanPrefix(ctx, rdb, prefix, func(batch []string) error {
+			keys = append(keys, batch...)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(keys)
+	m.Chunks = len(keys)
+
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	if err := enc.Encode(m); err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(keys); start += snapshotBatch {
+		end := min(start+snapshotBatch, len(keys))
+		cmds := make([]*redis.MapStringStringCmd, 0, end-start)
+		if _, err := rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			for _, key := range keys[start:end] {
+				cmds = append(cmds, p.HGetAll(ctx, key))
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to read chunks: %w", err)
+		}
+		for _, cmd := range cmds {
+			rec := toRecord(cmd.Val(), m.Root)
+			if rec == nil {
+				continue
+			}
+			if err := enc.Encode(rec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, zw.Close()
+}
+
+// Import restores a snapshot into a new version of opts.Name and returns the
+// manifest and the version it wrote. The caller activates the version, so
+// queries keep using any existing index until the import has succeeded.
+func Import(ctx context.Context, rdb redis.UniversalClient, r io.Reader, opts ImportOptions) (*SnapshotManifest, string, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("not a snapshot archive: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+	dec := json.NewDecoder(zr)
+
+	var m SnapshotManifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, "", fmt.Errorf("invalid snapshot manifest: %w", err)
+	}
+	if m.Format != SnapshotFormat {
+		return nil, "", fmt.Errorf("not a smartcli index snapshot (format %q)", m.Format)
+	}
+	if m.Version > SnapshotVersion {
+		return nil, "", fmt.Errorf("snapshot format v%d is newer than this smartcli supports (v%d); upgrade smartcli",
+			m.Version, SnapshotVersion)
+	}
+	if m.SchemaVersion > index_meta.SchemaVersion {
+		return nil, "", fmt.Errorf("snapshot was built by a newer smartcli (schema v%d, this build supports v%d); upgrade smartcli",
+			m.SchemaVersion, index_meta.SchemaVersion)
+	}
+	if m.Dim <= 0 {
+		return nil, "", fmt.Errorf("snapshot manifest has no vector dimension")
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = m.Index
+	}
+	if !opts.Force && chunk_retriever.IndexExists(rdb, name) {
+		return nil, "", fmt.Errorf("index %q already exists; use --force to replace it or --name to import under another name", name)
+	}
+	target := re_indexer.NewVersionName(name)
+	if err := chunk_retriever.EnsureIndex(rdb, target, target+":", m.Dim); err != nil {
+		return nil, "", fmt.Errorf("failed to create index %q: %w", target, err)
+	}
+
+	if err := importRecords(ctx, rdb, dec, target, opts.Root, m.Dim); err != nil {
+		// Leave no half-imported version behind
+		if _, dropErr := Drop(context.WithoutCancel(ctx), rdb, target); dropErr != nil {
+			err = fmt.Errorf("%w (cleanup of %q also failed: %v)", err, target, dropErr)
+		}
+		return nil, "", err
+	}
+
+	meta := &index_meta.Metadata{
+		Model:     m.Model,
+		Dim:       m.Dim,
+		Chunker:   m.Chunker,
+		ChunkSize: m.ChunkSize,
+		Overlap:   m.Overlap,
+		Root:      opts.Root,
+		CreatedAt: m.CreatedAt,
+		Version:   m.SchemaVersion,
+	}
+	if err := index_meta.Save(ctx, rdb, target, meta); err != nil {
+		return nil, "", fmt.Errorf("failed to save index metadata: %w", err)
+	}
+	return &m, target, nil
+}
+
+func importRecords(ctx context.Context, rdb redis.UniversalClient, dec *json.Decoder, target, root string, dim int) error {
+	batch := make([]snapshotRecord, 0, snapshotBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			for _, rec := range batch {
+				file := rec.File
+				if !filepath.IsAbs(file) && root != "" {
+					file = filepath.Join(root, filepath.FromSlash(file))
+				}
+				fields := map[string]any{
+					"text":      rec.Text,
+					"file":      file,
+					"chunk":     rec.Chunk,
+					"embedding": rec.Embedding,
+				}
+				for k, v := range rec.Fields {
+					fields[k] = v
+				}
+				p.HSet(ctx, re_indexer.ChunkKey(target, rec.File, rec.Chunk), fields)
+			}
+			return nil
+		})
+		batch = batch[:0]
+		return err
+	}
+
+	for n := 1; ; n++ {
+		var rec snapshotRecord
+		if err := dec.Decode(&rec); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid snapshot record %d: %w", n, err)
+		}
+		if len(rec.Embedding) != dim*4 {
+			return fmt.Errorf("snapshot record %d (%s chunk %d) has a %d-byte vector, want %d",
+				n, rec.File, rec.Chunk, len(rec.Embedding), dim*4)
+		}
+		batch = append(batch, rec)
+		if len(batch) == snapshotBatch {
+			if err := flush(); err != nil {
+				return fmt.Errorf("failed to write chunks: %w", err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to write chunks: %w", err)
+	}
+	return nil
+}
+
+// toRecord converts a chunk hash into a snapshot record with a root-relative
+// path. It returns nil for keys that are not chunks.
+func toRecord(vals map[string]string, root string) *snapshotRecord {
+	emb, ok := vals["embedding"]
+	if !ok {
+		return nil
+	}
+	rec := &snapshotRecord{
+		File:      vals["file"],
+		Text:      vals["text"],
+		Embedding: []byte(emb),
+	}
+	rec.Chunk, _ = strconv.Atoi(vals["chunk"])
+	if root != "" {
+		if rel, err := filepath.Rel(root, rec.File); err == nil && !strings.HasPrefix(rel, "..") {
+			rec.File = filepath.ToSlash(rel)
+		}
+	}
+	for k, v := range vals {
+		switch k {
+		case "text", "file", "chunk", "embedding":
+			continue
+		}
+		if rec.Fields == nil {
+			rec.Fields = map[string]string{}
+		}
+		rec.Fields[k] = v
+	}
+	return rec
+}
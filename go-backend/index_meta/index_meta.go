@@ -0,0 +1,252 @@
+package index_meta
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Schema versions of indexed documents.
+const (
+	// VersionModuleTags keys chunks by root-relative path and adds the
+	// module tag.
+	VersionModuleTags = 2
+	// VersionSourceTags adds the source tag.
+	VersionSourceTags = 3
+)
+
+// SchemaVersion is bumped whenever the layout of indexed documents changes.
+const SchemaVersion = VersionSourceTags
+
+// Metadata records how an index was built. Queries must match its Model and
+// Dim; builds adding chunks to it must also match how chunks were cut, which
+// Hash fingerprints.
+type Metadata struct {
+	Model     string
+	Dim       int
+	Chunker   string
+	ChunkSize int
+	Overlap   int
+	Root      string
+	CreatedAt string
+	Version   int
+}
+
+// Key returns the Redis key holding the metadata of indexName.
+func Key(indexName string) string {
+	return "smartcli:meta:" + indexName
+}
+
+// Hash fingerprints how the stored chunks and vectors were produced: the
+// schema, model, chunker, chunk size and overlap. The dimension follows from
+// the model and is only known once the first chunk is embedded.
+func (m *Metadata) Hash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("v%d|%s|%s|%d|%d",
+		m.schema(), m.Model, m.Chunker, m.ChunkSize, m.Overlap)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// schema returns m's schema version; unsaved metadata gets the current one.
+func (m *Metadata) schema() int {
+	if m.Version == 0 {
+		return SchemaVersion
+	}
+	return m.Version
+}
+
+// Save writes m for indexName, replacing any previous metadata.
+func Save(ctx context.Context, rdb redis.UniversalClient, indexName string, m *Metadata) error {
+	if m.Version == 0 {
+		m.Version = SchemaVersion
+	}
+	key := Key(indexName)
+	_, err := rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, key)
+		p.HSet(ctx, key, map[string]any{
+			"model":      m.Model,
+			"dim":        m.Dim,
+			"chunker":    m.Chunker,
+			"chunk_size": m.ChunkSize,
+			"overlap":    m.Overlap,
+			"root":       m.Root,
+			"created_at": m.CreatedAt,
+			"version":    m.Version,
+			"hash":       m.Hash(),
+		})
+		return nil
+	})
+	return err
+}
+
+// Load returns the metadata of indexName, or nil if none was recorded
+// (e.g. the index predates metadata or was not built by smartcli).
+func Load(ctx context.Context, rdb redis.UniversalClient, indexName string) (*Metadata, error) {
+	vals, err := rdb.HGetAll(ctx, Key(indexName)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	m := &Metadata{
+		Model:     vals["model"],
+		Chunker:   vals["chunker"],
+		Root:      vals["root"],
+		CreatedAt: vals["created_at"],
+	}
+	m.Dim, _ = strconv.Atoi(vals["dim"])
+	m.ChunkSize, _ = strconv.Atoi(vals["chunk_size"])
+	m.Overlap, _ = strconv.Atoi(vals["overlap"])
+	m.Version, _ = strconv.Atoi(vals["version"])
+	return m, nil
+}
+
+// CheckQuery returns an error if a query embedded with model into dim
+// dimensions cannot be compared against this index. dim may be 0 when the
+// query has not been embedded yet.
+func (m *Metadata) CheckQuery(indexName, model string, dim int) error {
+	if m.Version > SchemaVersion {
+		return fmt.Errorf("index %q was built by a newer smartcli (schema v%d, this build supports v%d); upgrade smartcli",
+			indexName, m.Version, SchemaVersion)
+	}
+	if model != "" && m.Model != "" && model != m.Model {
+		return fmt.Errorf("index %q was built with embedding model %q but the query uses %q; "+
+			"query with --model %s or re-index with: smartcli index --force --name %s --model %s",
+			indexName, m.Model, model, m.Model, indexName, model)
+	}
+	if dim != 0 && m.Dim != 0 && dim != m.Dim {
+		return fmt.Errorf("index %q stores %d-dimensional vectors but the query embedding has %d dimensions; "+
+			"re-index with: smartcli index --force --name %s --model %s",
+			indexName, m.Dim, dim, indexName, model)
+	}
+	return nil
+}
+
+// CheckBuild returns an error if new chunks built with next cannot be added
+// to an index built with m, i.e. their Hash differs. Indexes from before the
+// chunker was recorded are only checked for the model.
+func (m *Metadata) CheckBuild(indexName string, next *Metadata) error {
+	if m.Model != "" && next.Model != m.Model {
+		return fmt.Errorf("index %q was built with embedding model %q, not %q; "+
+			"drop it first with: smartcli index drop %s, or choose another --name",
+			indexName, m.Model, next.Model, indexName)
+	}
+	if m.Chunker == "" || m.Hash() == next.Hash() {
+		return nil
+	}
+	var diff string
+	switch {
+	case m.schema() != next.schema():
+		diff = fmt.Sprintf("schema v%d, not v%d", m.schema(), next.schema())
+	case m.Chunker != next.Chunker:
+		diff = fmt.Sprintf("chunker %q, not %q", m.Chunker, next.Chunker)
+	default:
+		diff = fmt.Sprintf("chunk size %d and overlap %d, not %d and %d", m.ChunkSize, m.Overlap, next.ChunkSize, next.Overlap)
+	}
+	return fmt.Errorf("index %q was built with %s (metadata hash %s, this build %s); "+
+		"rebuild it with: smartcli index --force --name %s",
+		indexName, diff, m.Hash(), next.Hash(), indexName)
+}
+
+// ===== Alias registry =====
+
+// RediSearch cannot enumerate aliases, so smartcli records the aliases it
+// manages (alias -> index) in a single hash.
+const aliasesKey = "smartcli:aliases"
+
+// SetAlias records that alias points at indexName.
+func SetAlias(ctx context.Context, rdb redis.UniversalClient, alias, indexName string) error {
+	return rdb.HSet(ctx, aliasesKey, alias, indexName).Err()
+}
+
+// DeleteAlias forgets alias.
+func DeleteAlias(ctx context.Context, rdb redis.UniversalClient, alias string) error {
+	return rdb.HDel(ctx, aliasesKey, alias).Err()
+}
+
+// Aliases returns every recorded alias and the index it points at.
+func Aliases(ctx context.Context, rdb redis.UniversalClient) (map[string]string, error) {
+	return rdb.HGetAll(ctx, aliasesKey).Result()
+}
+
+// AliasesOf returns the recorded aliases pointing at indexName.
+func AliasesOf(ctx context.Context, rdb redis.UniversalClient, indexName string) ([]string, error) {
+	all, err := Aliases(ctx, rdb)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for alias, target := range all {
+		if target == indexName {
+			out = append(out, alias)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ===== Shard sets =====
+
+// ShardSet describes an index split into Count shards. Each shard is a
+// regular alias-managed index named ShardName(Name, k), so shards are built,
+// versioned and re-indexed independently; queries against Name fan out to
+// all of them.
+type ShardSet struct {
+	Name  string
+	Count int
+	// By is how files are assigned to shards: "dir" or "hash".
+	By string
+}
+
+// ShardSetKey returns the Redis key recording the shard set named name.
+func ShardSetKey(name string) string {
+	return "smartcli:shards:" + name
+}
+
+// ShardName returns the name of shard k of name.
+func ShardName(name string, k int) string {
+	return fmt.Sprintf("%s_s%d", name, k)
+}
+
+// Shards returns the names of every shard in order.
+func (s *ShardSet) Shards() []string {
+	names := make([]string, s.Count)
+	for k := range names {
+		names[k] = ShardName(s.Name, k)
+	}
+	return names
+}
+
+// SaveShardSet records s, replacing any previous layout.
+func SaveShardSet(ctx context.Context, rdb redis.UniversalClient, s *ShardSet) error {
+	return rdb.HSet(ctx, ShardSetKey(s.Name), map[string]any{
+		"count": s.Count,
+		"by":    s.By,
+	}).Err()
+}
+
+// LoadShardSet returns the shard set named name, or nil if name is not sharded.
+func LoadShardSet(ctx context.Context, rdb redis.UniversalClient, name string) (*ShardSet, error) {
+	vals, err := rdb.HGetAll(ctx, ShardSetKey(name)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(vals["count"])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("corrupt shard set %q: count %q", name, vals["count"])
+	}
+	return &ShardSet{Name: name, Count: count, By: vals["by"]}, nil
+}
+
+// DeleteShardSet forgets the shard set named name.
+func DeleteShardSet(ctx context.Context, rdb redis.UniversalClient, name string) error {
+	return rdb.Del(ctx, ShardSetKey(name)).Err()
+}
@@ -0,0 +1,597 @@
+package local_store
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/config"
+	"smart-cli/go-backend/index_meta"
+)
+
+// DirName is the directory inside config.Dir holding one file per index.
+const DirName = "store"
+
+// fileVersion is bumped whenever the layout of index files changes.
+const fileVersion = 1
+
+// BM25 parameters, the same defaults RediSearch uses.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Store is a chunk_retriever.VectorStore that keeps each index in a file
+// and searches it in memory by brute force: exact cosine distance for KNN
+// and BM25 over the chunk text. That needs no server, but every query scans
+// each chunk of the index, so large indexes are better kept in Redis.
+// Indexes are loaded on first use and written back by Flush and Close.
+type Store struct {
+	dir string
+
+	mu      sync.RWMutex
+	indexes map[string]*index
+}
+
+// index is one loaded index.
+type index struct {
+	name string
+	dim  int
+	meta *index_meta.Metadata
+	docs map[string]*doc
+	// files maps each file to the keys of its chunks
+	files map[string]map[string]struct{}
+	dirty bool
+
+	// BM25 statistics over all docs
+	df       map[string]int
+	totalLen int
+}
+
+// doc is a stored chunk and its term frequencies.
+type doc struct {
+	chunk_retriever.Chunk
+	terms  map[string]int
+	length int
+}
+
+// indexFile is the on-disk form of an index.
+type indexFile struct {
+	Version int
+	Dim     int
+	Meta    *index_meta.Metadata
+	Docs    []storedDoc
+}
+
+type storedDoc struct {
+	Key       string
+	Text      string
+	Metadata  map[string]string
+	Embedding []float32
+}
+
+// Open returns the store kept in dir, which is created on the first write.
+func Open(dir string) *Store {
+	return &Store{dir: dir, indexes: map[string]*index{}}
+}
+
+// Find returns the store directory for a project: the first
+// .smartcli/store found in start or its parents, else the one directly
+// under start.
+func Find(start string) (string, error) {
+	abs, err := filepath.Abs(start)
+	if err != nil {
+		return "", err
+	}
+	for curr := abs; ; {
+		p := filepath.Join(curr, config.Dir, DirName)
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			return p, nil
+		}
+		parent := filepath.Dir(curr)
+		if parent == curr {
+			return filepath.Join(abs, config.Dir, DirName), nil
+		}
+		curr = parent
+	}
+}
+
+// Dir returns the directory the store is kept in.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// path returns the file of index name; names are escaped so that any name
+// maps to one file inside dir.
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, url.PathEscape(name)+".gob")
+}
+
+// load returns index name, reading it from disk on first use. It returns
+// nil when the index does not exist and create is false.
+func (s *Store) load(name string, create bool) (*index, error) {
+	s.mu.RLock()
+	ix := s.indexes[name]
+	s.mu.RUnlock()
+	if ix != nil {
+		return ix, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ix := s.indexes[name]; ix != nil {
+		return ix, nil
+	}
+	f, err := os.Open(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return nil, nil
+		}
+		ix := newIndex(name)
+		s.indexes[name] = ix
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file indexFile
+	if err := gob.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("reading index %q from %s: %w", name, s.path(name), err)
+	}
+	if file.Version != fileVersion {
+		return nil, fmt.Errorf("index %q was written by another smartcli version (format %d, want %d); re-index it", name, file.Version, fileVersion)
+	}
+	ix = newIndex(name)
+	ix.dim, ix.meta = file.Dim, file.Meta
+	for _, d := range file.Docs {
+		ix.put(chunk_retriever.Chunk{Key: d.Key, Text: d.Text, Metadata: d.Metadata, Embedding: d.Embedding})
+	}
+	ix.dirty = false
+	s.indexes[name] = ix
+	return ix, nil
+}
+
+// mustLoad is load for operations that need the index to exist.
+func (s *Store) mustLoad(name string) (*index, error) {
+	ix, err := s.load(name, false)
+	if err == nil && ix == nil {
+		err = fmt.Errorf("%s: no such index", name)
+	}
+	return ix, err
+}
+
+func newIndex(name string) *index {
+	return &index{name: name, docs: map[string]*doc{}, files: map[string]map[string]struct{}{}, df: map[string]int{}}
+}
+
+// put adds or replaces a chunk, keeping the BM25 statistics current.
+func (ix *index) put(ch chunk_retriever.Chunk) {
+	ix.remove(ch.Key)
+	d := &doc{Chunk: ch, terms: map[string]int{}}
+	for _, w := range chunk_retriever.Words(ch.Text) {
+		d.terms[w]++
+		d.length++
+	}
+	for t := range d.terms {
+		ix.df[t]++
+	}
+	ix.totalLen += d.length
+	ix.docs[ch.Key] = d
+	if file := ch.Metadata["file"]; file != "" {
+		if ix.files[file] == nil {
+			ix.files[file] = map[string]struct{}{}
+		}
+		ix.files[file][ch.Key] = struct{}{}
+	}
+	ix.dirty = true
+}
+
+// remove deletes a chunk and reports whether it existed.
+func (ix *index) remove(key string) bool {
+	d, ok := ix.docs[key]
+	if !ok {
+		return false
+	}
+	for t := range d.terms {
+		if ix.df[t]--; ix.df[t] == 0 {
+			delete(ix.df, t)
+		}
+	}
+	ix.totalLen -= d.length
+	delete(ix.docs, key)
+	if file := d.Metadata["file"]; file != "" {
+		if delete(ix.files[file], key); len(ix.files[file]) == 0 {
+			delete(ix.files, file)
+		}
+	}
+	ix.dirty = true
+	return true
+}
+
+func (s *Store) EnsureIndex(ctx context.Context, name string, dim int) error {
+	ix, err := s.load(name, true)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ix.dim != 0 && ix.dim != dim {
+		return fmt.Errorf("index %q holds %d-dimensional vectors, not %d", name, ix.dim, dim)
+	}
+	if ix.dim == 0 {
+		ix.dim = dim
+		ix.dirty = true
+	}
+	return nil
+}
+
+func (s *Store) Upsert(ctx context.Context, name string, chunks []chunk_retriever.Chunk) error {
+	ix, err := s.mustLoad(name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range chunks {
+		if len(ch.Embedding) != ix.dim {
+			return fmt.Errorf("chunk %s has a %d-dimensional vector; index %q holds %d", ch.Key, len(ch.Embedding), name, ix.dim)
+		}
+	}
+	for _, ch := range chunks {
+		ch.Metadata = cloneMap(ch.Metadata)
+		ix.put(ch)
+	}
+	return nil
+}
+
+func (s *Store) DeleteFile(ctx context.Context, name, file string) (int64, error) {
+	ix, err := s.load(name, false)
+	if err != nil || ix == nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for key := range ix.files[file] {
+		if ix.remove(key) {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Files returns the distinct files with chunks in index name.
+func (s *Store) Files(name string) ([]string, error) {
+	ix, err := s.load(name, false)
+	if err != nil || ix == nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	files := make([]string, 0, len(ix.files))
+	for f := range ix.files {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// FileState returns the "hash" field shared by the chunks of file in index
+// name and how many chunks the file has. hash is "" when the chunks do not
+// all carry the same one, e.g. after a run that failed part of the file.
+func (s *Store) FileState(name, file string) (hash string, chunks int, err error) {
+	ix, err := s.load(name, false)
+	if err != nil || ix == nil {
+		return "", 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mixed := false
+	for key := range ix.files[file] {
+		d := ix.docs[key]
+		if chunks == 0 {
+			hash = d.Metadata["hash"]
+		} else if d.Metadata["hash"] != hash {
+			mixed = true
+		}
+		chunks++
+	}
+	if mixed {
+		hash = ""
+	}
+	return hash, chunks, nil
+}
+
+// PruneFile removes the chunks of file in index name numbered keep or
+// above, which a shorter new version of the file no longer has.
+func (s *Store) PruneFile(name, file string, keep int) (int64, error) {
+	ix, err := s.load(name, false)
+	if err != nil || ix == nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for key := range ix.files[file] {
+		d := ix.docs[key]
+		if n, err := strconv.Atoi(d.Metadata["chunk"]); err == nil && n < keep {
+			continue
+		}
+		if ix.remove(key) {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// scored is a search hit before it is turned into a result.
+type scored struct {
+	d     *doc
+	score float64
+}
+
+func (s *Store) KNN(ctx context.Context, query chunk_retriever.ChunkQuery, vec []float32) ([]chunk_retriever.Chunk, error) {
+	ix, err := s.mustLoad(query.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(vec) != ix.dim {
+		return nil, fmt.Errorf("query vector has %d dimensions; index %q holds %d", len(vec), query.IndexName, ix.dim)
+	}
+	filters := query.AllFilters()
+	var hits []scored
+	for _, d := range ix.docs {
+		if !matches(d, filters) {
+			continue
+		}
+		// The COSINE distance RediSearch reports: 0 for the same direction
+		hits = append(hits, scored{d: d, score: 1 - chunk_retriever.Cosine(vec, d.Embedding)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score < hits[j].score
+		}
+		return hits[i].d.Key < hits[j].d.Key
+	})
+	out := results(hits, query)
+	for i := range out {
+		out[i].Score = hits[i].score
+	}
+	return out, nil
+}
+
+func (s *Store) SearchText(ctx context.Context, query chunk_retriever.ChunkQuery) ([]chunk_retriever.Chunk, error) {
+	terms := chunk_retriever.QueryTerms(query.Query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	ix, err := s.mustLoad(query.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(ix.docs) == 0 {
+		return nil, nil
+	}
+	n := float64(len(ix.docs))
+	avgLen := float64(ix.totalLen) / n
+	idf := make(map[string]float64, len(terms))
+	for _, t := range terms {
+		df := float64(ix.df[t])
+		idf[t] = math.Log(1 + (n-df+0.5)/(df+0.5))
+	}
+
+	filters := query.AllFilters()
+	var hits []scored
+	for _, d := range ix.docs {
+		var score float64
+		for _, t := range terms {
+			tf := float64(d.terms[t])
+			if tf == 0 {
+				continue
+			}
+			score += idf[t] * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(d.length)/avgLen))
+		}
+		if score > 0 && matches(d, filters) {
+			hits = append(hits, scored{d: d, score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].d.Key < hits[j].d.Key
+	})
+	out := results(hits, query)
+	for i := range out {
+		out[i].TextScore = hits[i].score
+	}
+	return out, nil
+}
+
+// results returns copies of the best query.TopK hits, with their embedding
+// only when the query asks for it.
+func results(hits []scored, query chunk_retriever.ChunkQuery) []chunk_retriever.Chunk {
+	out := make([]chunk_retriever.Chunk, min(len(hits), max(query.TopK, 0)))
+	for i := range out {
+		out[i] = copyChunk(hits[i].d.Chunk, query.WithVectors)
+	}
+	return out
+}
+
+func (s *Store) Get(ctx context.Context, keys []string) (map[string]chunk_retriever.Chunk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := map[string]chunk_retriever.Chunk{}
+	for _, key := range keys {
+		// Keys start with their index's name, so only loaded indexes can hold them
+		for _, ix := range s.indexes {
+			if d, ok := ix.docs[key]; ok {
+				out[key] = copyChunk(d.Chunk, false)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) Exists(ctx context.Context, name string) bool {
+	ix, err := s.load(name, false)
+	return err == nil && ix != nil
+}
+
+func (s *Store) Indexes(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), ".gob")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if name, err := url.PathUnescape(base); err == nil {
+			seen[name] = true
+		}
+	}
+	s.mu.RLock()
+	for name := range s.indexes {
+		seen[name] = true
+	}
+	s.mu.RUnlock()
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Store) SaveMeta(ctx context.Context, name string, m *index_meta.Metadata) error {
+	ix, err := s.mustLoad(name)
+	if err != nil {
+		return err
+	}
+	if m.Version == 0 {
+		m.Version = index_meta.SchemaVersion
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta := *m
+	ix.meta = &meta
+	ix.dirty = true
+	return nil
+}
+
+func (s *Store) LoadMeta(ctx context.Context, name string) (*index_meta.Metadata, error) {
+	ix, err := s.load(name, false)
+	if err != nil || ix == nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if ix.meta == nil {
+		return nil, nil
+	}
+	meta := *ix.meta
+	return &meta, nil
+}
+
+// Drop deletes index name and its file.
+func (s *Store) Drop(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.indexes, name)
+	if err := os.Remove(s.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Flush writes the indexes changed since they were loaded. Each file is
+// replaced atomically, so a crash leaves the previous version intact.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ix := range s.indexes {
+		if !ix.dirty {
+			continue
+		}
+		if err := s.write(ix); err != nil {
+			return fmt.Errorf("saving index %q: %w", ix.name, err)
+		}
+		ix.dirty = false
+	}
+	return nil
+}
+
+func (s *Store) write(ix *index) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	file := indexFile{Version: fileVersion, Dim: ix.dim, Meta: ix.meta, Docs: make([]storedDoc, 0, len(ix.docs))}
+	for _, d := range ix.docs {
+		file.Docs = append(file.Docs, storedDoc{Key: d.Key, Text: d.Text, Metadata: d.Metadata, Embedding: d.Embedding})
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(&file); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(ix.name))
+}
+
+// Close flushes the store.
+func (s *Store) Close() error {
+	return s.Flush()
+}
+
+// ===== Helpers =====
+
+func matches(d *doc, filters []chunk_retriever.Filter) bool {
+	for _, f := range filters {
+		if !f.Match(d.Metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+func copyChunk(ch chunk_retriever.Chunk, withVector bool) chunk_retriever.Chunk {
+	ch.Metadata = cloneMap(ch.Metadata)
+	if !withVector {
+		ch.Embedding = nil
+	}
+	return ch
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
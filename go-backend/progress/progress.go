@@ -0,0 +1,396 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Format selects how a Reporter renders progress.
+type Format int
+
+const (
+	// Text renders a single self-overwriting status bar for terminals.
+	Text Format = iota
+	// JSON writes newline-delimited JSON events, one object per line.
+	JSON
+)
+
+// Counts is a point-in-time snapshot of pipeline counters.
+type Counts struct {
+	FilesDiscovered  int64 `json:"files_discovered"`
+	FilesChunked     int64 `json:"files_chunked"`
+	FilesFailed      int64 `json:"files_failed"`
+	FilesSkipped     int64 `json:"files_skipped"`
+	ChunksDiscovered int64 `json:"chunks_discovered"`
+	ChunksEmbedded   int64 `json:"chunks_embedded"`
+	ChunksStored     int64 `json:"chunks_stored"`
+	ChunksFailed     int64 `json:"chunks_failed"`
+}
+
+// Summary is the final report of an indexing run.
+type Summary struct {
+	Counts
+	Index           string   `json:"index"`
+	Root            string   `json:"root"`
+	StartedAt       string   `json:"started_at"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	ChunksPerSecond float64  `json:"chunks_per_second"`
+	Errors          []string `json:"errors,omitempty"`
+	ErrorsTruncated int      `json:"errors_truncated,omitempty"`
+	Workers         *Workers `json:"workers,omitempty"`
+	Writes          *Writes  `json:"writes,omitempty"`
+}
+
+// Workers records the worker pool sizes a run used. With adaptive embedding
+// the embed pool moved between EmbedLow and EmbedHigh and ended at Embed.
+type Workers struct {
+	Files            int  `json:"files"`
+	Embed            int  `json:"embed"`
+	Adaptive         bool `json:"adaptive,omitempty"`
+	EmbedInitial     int  `json:"embed_initial,omitempty"`
+	EmbedLow         int  `json:"embed_low,omitempty"`
+	EmbedHigh        int  `json:"embed_high,omitempty"`
+	EmbedAdjustments int  `json:"embed_adjustments,omitempty"`
+}
+
+// Writes records how chunks were written to Redis. Seconds is the time spent
+// waiting on Redis summed over batches, so CommandsPerSecond measures write
+// throughput independently of embedding.
+type Writes struct {
+	Mode              string  `json:"mode"`
+	BatchSize         int     `json:"batch_size"`
+	Batches           int64   `json:"batches"`
+	Commands          int64   `json:"commands"`
+	Failed            int64   `json:"failed,omitempty"`
+	Seconds           float64 `json:"seconds"`
+	CommandsPerSecond float64 `json:"commands_per_second"`
+}
+
+// Failures returns the number of failed files and chunks combined.
+func (s Summary) Failures() int64 {
+	return s.FilesFailed + s.ChunksFailed
+}
+
+// event is the envelope for JSON output.
+type event struct {
+	Event string `json:"event"`
+	Time  string `json:"time"`
+	Counts
+	ElapsedSeconds  float64 `json:"elapsed_seconds"`
+	ChunksPerSecond float64 `json:"chunks_per_second"`
+	ETASeconds      float64 `json:"eta_seconds,omitempty"`
+	Done            bool    `json:"discovery_done"`
+	File            string  `json:"file,omitempty"`
+	Chunk           *int    `json:"chunk,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// maxErrors caps how many error messages are kept for the summary.
+const maxErrors = 50
+
+// Reporter collects pipeline counters from concurrent workers and renders them
+// periodically. All counter methods are safe for concurrent use.
+type Reporter struct {
+	out      io.Writer
+	format   Format
+	interval time.Duration
+
+	filesDiscovered  atomic.Int64
+	filesChunked     atomic.Int64
+	filesFailed      atomic.Int64
+	filesSkipped     atomic.Int64
+	chunksDiscovered atomic.Int64
+	chunksEmbedded   atomic.Int64
+	chunksStored     atomic.Int64
+	chunksFailed     atomic.Int64
+	discoveryDone    atomic.Bool
+
+	mu        sync.Mutex
+	start     time.Time
+	errors    []string
+	truncated int
+	workers   *Workers
+	writes    *Writes
+	lineLen   int
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// New creates a Reporter writing to out in the given format.
+func New(out io.Writer, format Format) *Reporter {
+	return &Reporter{
+		out:      out,
+		format:   format,
+		interval: 250 * time.Millisecond,
+	}
+}
+
+// Discard returns a Reporter that only counts and never renders.
+func Discard() *Reporter {
+	return New(io.Discard, Text)
+}
+
+// Start begins periodic rendering until Finish is called.
+func (r *Reporter) Start() {
+	r.mu.Lock()
+	r.start = time.Now()
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+	r.mu.Unlock()
+
+	go func() {
+		defer close(r.stopped)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.render()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// ===== Counters =====
+
+func (r *Reporter) FileDiscovered() { r.filesDiscovered.Add(1) }
+func (r *Reporter) ChunkEmbedded()  { r.chunksEmbedded.Add(1) }
+func (r *Reporter) ChunkStored()    { r.chunksStored.Add(1) }
+func (r *Reporter) DiscoveryDone()  { r.discoveryDone.Store(true) }
+func (r *Reporter) FileSkipped()    { r.filesSkipped.Add(1) }
+
+// ChunksQueued adds n chunks that did not come from chunking a file,
+// e.g. jobs loaded from a retry queue.
+func (r *Reporter) ChunksQueued(n int) {
+	r.chunksDiscovered.Add(int64(n))
+}
+
+// FileChunked records a file that was split into n chunks.
+func (r *Reporter) FileChunked(n int) {
+	r.filesChunked.Add(1)
+	r.chunksDiscovered.Add(int64(n))
+}
+
+// FileFailed records a file that could not be read or split.
+func (r *Reporter) FileFailed(path string, err error) {
+	r.filesFailed.Add(1)
+	r.recordError(path, -1, err)
+}
+
+// ChunkFailed records a chunk that could not be embedded or stored.
+func (r *Reporter) ChunkFailed(path string, chunk int, err error) {
+	r.chunksFailed.Add(1)
+	r.recordError(path, chunk, err)
+}
+
+// Warn records an error that is not tied to a file or chunk counter.
+func (r *Reporter) Warn(err error) {
+	r.recordError("", -1, err)
+}
+
+func (r *Reporter) recordError(path string, chunk int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errors) < maxErrors {
+		r.errors = append(r.errors, err.Error())
+	} else {
+		r.truncated++
+	}
+
+	if r.format == JSON {
+		ev := r.event("error")
+		ev.File = path
+		if chunk >= 0 {
+			ev.Chunk = &chunk
+		}
+		ev.Error = err.Error()
+		r.writeJSON(ev)
+		return
+	}
+	// Print the warning on its own line, above the status bar
+	r.clearLine()
+	fmt.Fprintln(r.out, "Warning:", err)
+}
+
+// SetWorkers records the worker pool sizes for the summary.
+func (r *Reporter) SetWorkers(w Workers) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workers = &w
+}
+
+// SetWrites records the Redis write statistics for the summary.
+func (r *Reporter) SetWrites(w Writes) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = &w
+}
+
+// Snapshot returns the current counters.
+func (r *Reporter) Snapshot() Counts {
+	return Counts{
+		FilesDiscovered:  r.filesDiscovered.Load(),
+		FilesChunked:     r.filesChunked.Load(),
+		FilesFailed:      r.filesFailed.Load(),
+		FilesSkipped:     r.filesSkipped.Load(),
+		ChunksDiscovered: r.chunksDiscovered.Load(),
+		ChunksEmbedded:   r.chunksEmbedded.Load(),
+		ChunksStored:     r.chunksStored.Load(),
+		ChunksFailed:     r.chunksFailed.Load(),
+	}
+}
+
+// Finish stops rendering and returns the run summary.
+// In JSON mode the summary is also written as a final "summary" event.
+func (r *Reporter) Finish(index, root string) Summary {
+	r.mu.Lock()
+	stop := r.stop
+	r.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-r.stopped
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elapsed := time.Since(r.start)
+	c := r.Snapshot()
+	s := Summary{
+		Counts:          c,
+		Index:           index,
+		Root:            root,
+		StartedAt:       r.start.UTC().Format(time.RFC3339),
+		DurationSeconds: elapsed.Seconds(),
+		ChunksPerSecond: rate(c.ChunksStored, elapsed),
+		Errors:          append([]string(nil), r.errors...),
+		ErrorsTruncated: r.truncated,
+		Workers:         r.workers,
+		Writes:          r.writes,
+	}
+
+	if r.format == JSON {
+		r.writeJSON(struct {
+			Event string `json:"event"`
+			Summary
+		}{Event: "summary", Summary: s})
+	} else {
+		r.drawBar(c, elapsed)
+		fmt.Fprintln(r.out)
+		r.lineLen = 0
+	}
+	return s
+}
+
+// ===== Rendering =====
+
+func (r *Reporter) render() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.format == JSON {
+		r.writeJSON(r.event("progress"))
+		return
+	}
+	r.drawBar(r.Snapshot(), time.Since(r.start))
+}
+
+// event builds a JSON event from the current counters. Caller holds r.mu.
+func (r *Reporter) event(name string) event {
+	c := r.Snapshot()
+	elapsed := time.Since(r.start)
+	ev := event{
+		Event:           name,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		Counts:          c,
+		ElapsedSeconds:  elapsed.Seconds(),
+		ChunksPerSecond: rate(c.ChunksStored, elapsed),
+		Done:            r.discoveryDone.Load(),
+	}
+	if eta, ok := r.eta(c, elapsed); ok {
+		ev.ETASeconds = eta.Seconds()
+	}
+	return ev
+}
+
+func (r *Reporter) writeJSON(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_, _ = r.out.Write(append(b, '\n'))
+}
+
+// drawBar redraws the status line in place. Caller holds r.mu.
+func (r *Reporter) drawBar(c Counts, elapsed time.Duration) {
+	const width = 24
+	processed := c.ChunksStored + c.ChunksFailed
+
+	var frac float64
+	if c.ChunksDiscovered > 0 {
+		frac = float64(processed) / float64(c.ChunksDiscovered)
+	}
+	if frac > 1 {
+		frac = 1
+	}
+	filled := int(frac * width)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", width-filled)
+
+	etaText := "?"
+	if eta, ok := r.eta(c, elapsed); ok {
+		etaText = eta.Round(time.Second).String()
+	}
+
+	line := fmt.Sprintf("[%s] %3.0f%% | files %d/%d | chunks %d/%d embedded %d stored %d failed %d | %.1f chunks/s | ETA %s",
+		bar, frac*100,
+		c.FilesChunked+c.FilesFailed+c.FilesSkipped, c.FilesDiscovered,
+		processed, c.ChunksDiscovered,
+		c.ChunksEmbedded, c.ChunksStored, c.ChunksFailed+c.FilesFailed,
+		rate(c.ChunksStored, elapsed), etaText,
+	)
+	pad := ""
+	if r.lineLen > len(line) {
+		pad = strings.Repeat(" ", r.lineLen-len(line))
+	}
+	fmt.Fprint(r.out, "\r"+line+pad)
+	r.lineLen = len(line)
+}
+
+// clearLine erases the status bar so a message can be printed. Caller holds r.mu.
+func (r *Reporter) clearLine() {
+	if r.lineLen == 0 {
+		return
+	}
+	fmt.Fprint(r.out, "\r"+strings.Repeat(" ", r.lineLen)+"\r")
+	r.lineLen = 0
+}
+
+// eta estimates the remaining time once every file has been discovered.
+// Before that the total number of chunks is unknown.
+func (r *Reporter) eta(c Counts, elapsed time.Duration) (time.Duration, bool) {
+	if !r.discoveryDone.Load() || c.FilesChunked+c.FilesFailed+c.FilesSkipped < c.FilesDiscovered {
+		return 0, false
+	}
+	processed := c.ChunksStored + c.ChunksFailed
+	if processed == 0 {
+		return 0, false
+	}
+	remaining := c.ChunksDiscovered - processed
+	if remaining <= 0 {
+		return 0, true
+	}
+	perChunk := elapsed / time.Duration(processed)
+	return perChunk * time.Duration(remaining), true
+}
+
+func rate(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
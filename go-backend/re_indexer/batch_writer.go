@@ -0,0 +1,143 @@
+package re_indexer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/concurrency"
+	"smart-cli/go-backend/progress"
+)
+
+// pendingWrite is a buffered chunk HSET. done receives the command's own
+// result once its batch has been sent.
+type pendingWrite struct {
+	key    string
+	fields map[string]any
+	vec    []float32
+	done   func(error)
+}
+
+// batchWriter buffers chunk writes from concurrent workers and sends them in
+// batches, as a pipeline or a MULTI/EXEC transaction, so a remote Redis costs
+// one round trip per batch instead of one per chunk.
+type batchWriter struct {
+	rdb  redis.UniversalClient
+	mode string
+	size int
+	// store and index replace rdb for indexers without Redis; a batch is
+	// then one Upsert
+	store chunk_retriever.VectorStore
+	index string
+
+	mu      sync.Mutex
+	pending []pendingWrite
+
+	statsMu  sync.Mutex
+	batches  int64
+	commands int64
+	failed   int64
+	elapsed  time.Duration
+}
+
+func newBatchWriter(rdb redis.UniversalClient, s concurrency.Settings) *batchWriter {
+	return &batchWriter{rdb: rdb, mode: s.WriteMode, size: max(s.BatchSize, 1)}
+}
+
+// add buffers a write. The worker that fills a batch sends it, which also
+// throttles workers while Redis is slow.
+func (w *batchWriter) add(ctx context.Context, key string, fields map[string]any, vec []float32, done func(error)) {
+	w.mu.Lock()
+	w.pending = append(w.pending, pendingWrite{key: key, fields: fields, vec: vec, done: done})
+	var batch []pendingWrite
+	if len(w.pending) >= w.size {
+		batch, w.pending = w.pending, nil
+	}
+	w.mu.Unlock()
+
+	if batch != nil {
+		w.send(ctx, batch)
+	}
+}
+
+// flush sends whatever is still buffered.
+func (w *batchWriter) flush(ctx context.Context) {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	if len(batch) > 0 {
+		w.send(ctx, batch)
+	}
+}
+
+// send writes batch and reports each command's result to its write. Chunks
+// were already embedded, so the writes are not abandoned when ctx is
+// cancelled.
+func (w *batchWriter) send(ctx context.Context, batch []pendingWrite) {
+	ctx = context.WithoutCancel(ctx)
+	queue := func(p redis.Pipeliner) error {
+		for _, pw := range batch {
+			p.HSet(ctx, pw.key, pw.fields)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	var cmds []redis.Cmder
+	var err error
+	if w.store != nil {
+		chunks := make([]chunk_retriever.Chunk, len(batch))
+		for n, pw := range batch {
+			chunks[n] = hashChunk(pw.key, pw.fields, pw.vec)
+		}
+		err = w.store.Upsert(ctx, w.index, chunks)
+	} else if w.mode == concurrency.WriteMulti {
+		cmds, err = w.rdb.TxPipelined(ctx, queue)
+	} else {
+		cmds, err = w.rdb.Pipelined(ctx, queue)
+	}
+	elapsed := time.Since(start)
+
+	var failed int64
+	for n, pw := range batch {
+		// Commands carry their own error; err is the first of them or a
+		// connection failure that left no per-command result
+		cmdErr := err
+		if n < len(cmds) {
+			cmdErr = cmds[n].Err()
+		}
+		if cmdErr != nil {
+			failed++
+		}
+		pw.done(cmdErr)
+	}
+
+	w.statsMu.Lock()
+	w.batches++
+	w.commands += int64(len(batch))
+	w.failed += failed
+	w.elapsed += elapsed
+	w.statsMu.Unlock()
+}
+
+// stats summarizes the writes sent so far.
+func (w *batchWriter) stats() progress.Writes {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+	s := progress.Writes{
+		Mode:      w.mode,
+		BatchSize: w.size,
+		Batches:   w.batches,
+		Commands:  w.commands,
+		Failed:    w.failed,
+		Seconds:   w.elapsed.Seconds(),
+	}
+	if w.elapsed > 0 {
+		s.CommandsPerSecond = float64(w.commands) / w.elapsed.Seconds()
+	}
+	return s
+}
@@ -0,0 +1,269 @@
+package re_indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/chunker"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/progress"
+)
+
+// Run states stored in the run hash
+const (
+	RunRunning     = "running"
+	RunInterrupted = "interrupted"
+	// RunBuilt means the new version is complete but not yet activated.
+	RunBuilt    = "built"
+	RunComplete = "complete"
+)
+
+// RunState describes the last indexing run behind an alias.
+type RunState struct {
+	Status    string
+	Root      string
+	Target    string
+	ChunkSize int
+	Overlap   int
+}
+
+// failedJob is a chunk that could not be embedded or stored,
+// persisted so it can be retried without re-walking the repo.
+type failedJob struct {
+	File  string `json:"file"`
+	Chunk int    `json:"chunk"`
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+func checkpointKey(indexName string) string { return "smartcli:checkpoint:" + indexName }
+func failedKey(indexName string) string     { return "smartcli:failed:" + indexName }
+
+// RunStateKey returns the key holding the run state of an alias.
+func RunStateKey(alias string) string { return "smartcli:run:" + alias }
+
+// StateKeys returns the smartcli bookkeeping keys kept for a versioned index
+// (checkpoint set and failed-chunk queue).
+func StateKeys(indexName string) []string {
+	return []string{checkpointKey(indexName), failedKey(indexName)}
+}
+
+// LoadRunState returns the state of the last run behind alias, or nil if
+// there is none.
+func LoadRunState(ctx context.Context, rdb redis.UniversalClient, alias string) (*RunState, error) {
+	vals, err := rdb.HGetAll(ctx, RunStateKey(alias)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	st := &RunState{Status: vals["status"], Root: vals["root"], Target: vals["target"]}
+	st.ChunkSize, _ = strconv.Atoi(vals["chunk_size"])
+	st.Overlap, _ = strconv.Atoi(vals["overlap"])
+	return st, nil
+}
+
+// FailedCount returns the number of chunk jobs waiting in the retry queue.
+func FailedCount(ctx context.Context, rdb redis.UniversalClient, indexName string) (int64, error) {
+	return rdb.LLen(ctx, failedKey(indexName)).Result()
+}
+
+func (i *Indexer) recordRun(ctx context.Context, status string, chunkSize, overlap int) error {
+	if i.Redis == nil {
+		return nil
+	}
+	return i.Redis.HSet(ctx, RunStateKey(i.IndexName), map[string]any{
+		"status":     status,
+		"root":       i.Root,
+		"target":     i.target(),
+		"chunk_size": chunkSize,
+		"overlap":    overlap,
+	}).Err()
+}
+
+func (i *Indexer) setRunStatus(ctx context.Context, status string) error {
+	if i.Redis == nil {
+		return nil
+	}
+	return i.Redis.HSet(ctx, RunStateKey(i.IndexName), "status", status).Err()
+}
+
+// resetCheckpoint clears the checkpoint and retry queue before a fresh run.
+func (i *Indexer) resetCheckpoint(ctx context.Context) error {
+	if i.Redis == nil {
+		return nil
+	}
+	_, err := chunk_retriever.DeleteKeys(ctx, i.Redis, StateKeys(i.target())...)
+	return err
+}
+
+// loadCheckpoint returns the set of files completed by a previous run.
+func (i *Indexer) loadCheckpoint(ctx context.Context) (map[string]struct{}, error) {
+	if i.Redis == nil {
+		return nil, fmt.Errorf("resuming needs Redis")
+	}
+	members, err := i.Redis.SMembers(ctx, checkpointKey(i.target())).Result()
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		done[m] = struct{}{}
+	}
+	return done, nil
+}
+
+func (i *Indexer) markFileDone(ctx context.Context, path string) {
+	if i.Redis == nil {
+		return
+	}
+	if err := i.Redis.SAdd(context.WithoutCancel(ctx), checkpointKey(i.target()), path).Err(); err != nil {
+		i.Progress.Warn(fmt.Errorf("checkpoint failed for %s: %w", path, err))
+	}
+}
+
+// pushFailed queues job for RetryFailed. It also runs after the pipeline was
+// cancelled, so it does not inherit ctx's cancellation.
+func (i *Indexer) pushFailed(ctx context.Context, job chunkJob, cause error) {
+	if i.Redis == nil {
+		return
+	}
+	b, err := json.Marshal(failedJob{
+		File:  job.filePath,
+		Chunk: job.chunk.Index,
+		Text:  job.chunk.Text,
+		Error: cause.Error(),
+	})
+	if err == nil {
+		err = i.Redis.RPush(context.WithoutCancel(ctx), failedKey(i.target()), b).Err()
+	}
+	if err != nil {
+		i.Progress.Warn(fmt.Errorf("could not queue failed chunk %s [chunk %d]: %w", job.filePath, job.chunk.Index, err))
+	}
+}
+
+// ===== Per-file completion tracking =====
+
+// fileTracker counts outstanding chunks per file so a file is checkpointed
+// only once every one of its chunks has been stored or queued for retry.
+type fileTracker struct {
+	remaining sync.Map // path -> *fileChunks
+}
+
+// fileChunks tracks the chunks of one file.
+type fileChunks struct {
+	total     int
+	remaining atomic.Int64
+	failed    atomic.Bool
+}
+
+func (t *fileTracker) add(path string, n int) {
+	c := &fileChunks{total: n}
+	c.remaining.Store(int64(n))
+	t.remaining.Store(path, c)
+}
+
+// done marks one chunk of path as finished, failed or not. When it was the
+// last, it returns the file's chunk count and whether they were all stored.
+func (t *fileTracker) done(path string, failed bool) (total int, stored, last bool) {
+	v, ok := t.remaining.Load(path)
+	if !ok {
+		return 0, false, false
+	}
+	c := v.(*fileChunks)
+	if failed {
+		c.failed.Store(true)
+	}
+	if c.remaining.Add(-1) != 0 {
+		return 0, false, false
+	}
+	t.remaining.Delete(path)
+	return c.total, !c.failed.Load(), true
+}
+
+// ===== Retry queue =====
+
+// RetryFailed re-embeds and stores the chunks in the retry queue.
+// Chunks that fail again are pushed back onto the queue.
+func (i *Indexer) RetryFailed(ctx context.Context) (progress.Summary, error) {
+	if i.Redis == nil {
+		return progress.Summary{}, fmt.Errorf("retrying failed chunks needs Redis")
+	}
+	settings := i.Concurrency.Resolve()
+	embedWorkers := i.startPools(settings)
+
+	if i.Progress == nil {
+		i.Progress = progress.Discard()
+	}
+	rep := i.Progress
+
+	// Retried vectors must be comparable with the ones already stored
+	if existing, err := index_meta.Load(ctx, i.Redis, i.target()); err != nil {
+		return progress.Summary{}, fmt.Errorf("failed to load index metadata: %w", err)
+	} else if existing != nil {
+		if err := existing.CheckQuery(i.target(), i.Embedder.Model, 0); err != nil {
+			return progress.Summary{}, err
+		}
+	}
+	rep.Start()
+
+	key := failedKey(i.target())
+	raw, err := i.Redis.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return rep.Finish(i.target(), i.Root), fmt.Errorf("failed to read retry queue: %w", err)
+	}
+	// Remove the entries we took; re-failures are appended to the tail meanwhile
+	defer func() {
+		if len(raw) > 0 {
+			_ = i.Redis.LTrim(context.Background(), key, int64(len(raw)), -1).Err()
+		}
+	}()
+
+	rep.ChunksQueued(len(raw))
+	rep.DiscoveryDone()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var fatalOnce sync.Once
+	var fatalErr error
+	fail := func(err error) {
+		fatalOnce.Do(func() {
+			fatalErr = err
+			cancel()
+		})
+	}
+
+	chunksCh := make(chan chunkJob, embedWorkers)
+	go func() {
+		defer close(chunksCh)
+		for _, r := range raw {
+			var fj failedJob
+			if err := json.Unmarshal([]byte(r), &fj); err != nil {
+				rep.Warn(fmt.Errorf("skipping malformed retry entry: %w", err))
+				continue
+			}
+			chunksCh <- chunkJob{filePath: fj.File, chunk: chunker.Chunk{Index: fj.Chunk, Text: fj.Text}}
+		}
+	}()
+
+	var embedWG sync.WaitGroup
+	for w := 0; w < embedWorkers; w++ {
+		embedWG.Add(1)
+		go i.embedAndStore(ctx, chunksCh, fail, nil, &embedWG)
+	}
+	embedWG.Wait()
+	i.finishPools(ctx, settings, false)
+
+	summary := rep.Finish(i.target(), i.Root)
+	if fatalErr != nil {
+		return summary, fatalErr
+	}
+	return summary, ctx.Err()
+}
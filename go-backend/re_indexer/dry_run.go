@@ -0,0 +1,129 @@
+package re_indexer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"smart-cli/go-backend/progress"
+)
+
+// CharsPerToken is the rough characters-per-token ratio used for estimates.
+const CharsPerToken = 4
+
+// Pricing holds embedding prices used for cost estimates. Vertex AI bills
+// text embedding models per 1,000 input characters; newer models per token.
+type Pricing struct {
+	PerThousandChars float64 `json:"per_1k_chars"`
+	PerMillionTokens float64 `json:"per_1m_tokens"`
+}
+
+// FileStats describes what a single file contributes to an index.
+type FileStats struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Chunks   int    `json:"chunks"`
+	Chars    int64  `json:"chars"`
+}
+
+// LanguageStats aggregates FileStats per language.
+type LanguageStats struct {
+	Language string `json:"language"`
+	Files    int    `json:"files"`
+	Chunks   int    `json:"chunks"`
+	Chars    int64  `json:"chars"`
+}
+
+// DryRunReport estimates the size and cost of indexing a directory.
+type DryRunReport struct {
+	Root            string          `json:"root"`
+	Files           int             `json:"files"`
+	FilesFailed     int             `json:"files_failed"`
+	Chunks          int             `json:"chunks"`
+	Chars           int64           `json:"chars"`
+	EstimatedTokens int64           `json:"estimated_tokens"`
+	EstimatedCost   float64         `json:"estimated_cost_usd"`
+	Pricing         Pricing         `json:"pricing"`
+	ByLanguage      []LanguageStats `json:"by_language"`
+	Largest         []FileStats     `json:"largest"`
+	// Redactions counts the secrets that would be redacted, by kind.
+	Redactions map[string]int `json:"redactions,omitempty"`
+}
+
+// DryRun walks, filters and chunks dir exactly like ReIndexDirectory, but
+// never calls the embedding API or Redis. Characters are counted per chunk,
+// so overlap is included just as it would be billed.
+func (i *Indexer) DryRun(ctx context.Context, dir string, chunkSize, overlap int, pricing Pricing, topN int) (*DryRunReport, error) {
+	if i.Progress == nil {
+		i.Progress = progress.Discard()
+	}
+
+	filesCh := make(chan string, 256)
+	var walkWG sync.WaitGroup
+	walkWG.Add(1)
+	go i.walkDirectory(ctx, dir, nil, filesCh, &walkWG)
+	go func() {
+		walkWG.Wait()
+		close(filesCh)
+	}()
+
+	report := &DryRunReport{Root: dir, Pricing: pricing}
+	byLang := map[string]*LanguageStats{}
+	var files []FileStats
+
+	for path := range filesCh {
+		chunks, err := i.chunkFile(path, chunkSize, overlap)
+		if err != nil {
+			report.FilesFailed++
+			i.Progress.FileFailed(path, fmt.Errorf("split failed for %s: %w", path, err))
+			continue
+		}
+		fs := FileStats{Path: path, Language: i.Policy.Language(path), Chunks: len(chunks)}
+		if fs.Language == "" {
+			fs.Language = "other" // e.g. commit messages
+		}
+		for _, ch := range chunks {
+			fs.Chars += int64(utf8.RuneCountInString(ch.Text))
+		}
+		files = append(files, fs)
+
+		ls, ok := byLang[fs.Language]
+		if !ok {
+			ls = &LanguageStats{Language: fs.Language}
+			byLang[fs.Language] = ls
+		}
+		ls.Files++
+		ls.Chunks += fs.Chunks
+		ls.Chars += fs.Chars
+
+		report.Files++
+		report.Chunks += fs.Chunks
+		report.Chars += fs.Chars
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if counts := i.Redactor.Counts(); len(counts) > 0 {
+		report.Redactions = counts
+	}
+	report.EstimatedTokens = (report.Chars + CharsPerToken - 1) / CharsPerToken
+	report.EstimatedCost = float64(report.Chars)/1000*pricing.PerThousandChars +
+		float64(report.EstimatedTokens)/1e6*pricing.PerMillionTokens
+
+	for _, ls := range byLang {
+		report.ByLanguage = append(report.ByLanguage, *ls)
+	}
+	sort.Slice(report.ByLanguage, func(a, b int) bool {
+		return report.ByLanguage[a].Chars > report.ByLanguage[b].Chars
+	})
+
+	sort.Slice(files, func(a, b int) bool { return files[a].Chars > files[b].Chars })
+	if topN > 0 && len(files) > topN {
+		files = files[:topN]
+	}
+	report.Largest = files
+	return report, nil
+}
@@ -2,30 +2,91 @@ package re_indexer
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/redis/go-redis/v9"
 	"smart-cli/go-backend/chunk_retriever"
 	"smart-cli/go-backend/chunker"
+	"smart-cli/go-backend/concurrency"
 	"smart-cli/go-backend/embedder"
+	"smart-cli/go-backend/file_policy"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/progress"
+	"smart-cli/go-backend/redactor"
+	"smart-cli/go-backend/workspace"
 )
 
 type Indexer struct {
-	Redis     *redis.Client
-	Embedder  *embedder.Embedder
-	Root      string
+	// Redis holds the index, unless it is nil and Store is set.
+	Redis redis.UniversalClient
+	// Store, used when Redis is nil, receives the chunks instead, e.g. a
+	// local_store. Such runs keep no checkpoint, retry queue or run state
+	// and update the index in place: each file's chunks replace its old
+	// ones, and files no longer found are removed once the run completes.
+	Store    chunk_retriever.VectorStore
+	Embedder *embedder.Embedder
+	Root     string
+	// IndexName is the stable name queries use. It is a RediSearch alias that
+	// points at the active versioned index.
 	IndexName string
+	// Target is the versioned index chunks are written to. When empty, writes
+	// go to whatever IndexName currently resolves to.
+	Target string
+	// Resume skips files checkpointed by a previous, interrupted run instead
+	// of starting over.
+	Resume bool
+	// Policy selects the files to index.
+	Policy *file_policy.Policy
+	// Workspace, when set, indexes each of its modules (instead of the
+	// directory passed to ReIndexDirectory) and tags chunks with their module.
+	Workspace *workspace.Workspace
+	// Extract, when set, turns a file into the text that is chunked instead
+	// of using its raw contents; "" skips the file.
+	Extract func(path string) (string, error)
+	// Source is stored in the "source" tag of every chunk, e.g. "dependency".
+	Source string
+	// Discover, when set, replaces the directory walk as the source of paths.
+	// Paths may then be synthetic document IDs that Extract resolves.
+	Discover func(ctx context.Context, emit func(path string) error) error
+	// Fields, when set, returns extra hash fields stored with each chunk of
+	// path; they override the defaults.
+	Fields func(path string) map[string]string
+	// Select, when set, indexes only the paths it returns true for, e.g.
+	// the files of one shard.
+	Select func(path string) bool
+	// Redactor, when set, replaces secrets in each file's text before it is
+	// chunked, so neither the embedding service nor the index sees them.
+	Redactor *redactor.Redactor
+	// Concurrency sizes the file and embedding worker pools; zero values use
+	// the defaults.
+	Concurrency concurrency.Settings
+	// Progress receives pipeline counters and errors. A silent reporter is
+	// used when nil.
+	Progress *progress.Reporter
+
+	// limiter bounds concurrent embedding calls in adaptive mode
+	limiter *concurrency.Limiter
+	// writer batches chunk writes during ReIndexDirectory and RetryFailed
+	writer *batchWriter
 
 	ensureOnce sync.Once
+	ensureErr  error
+	// meta is written alongside the index once the vector dimension is known
+	meta *index_meta.Metadata
+	// walked records the files found by a Store run, to prune the rest
+	walked map[string]struct{}
 }
 
-func NewIndexer(redisClient *redis.Client, emb *embedder.Embedder, root string, indexName string) *Indexer {
+func NewIndexer(redisClient redis.UniversalClient, emb *embedder.Embedder, root string, indexName string) *Indexer {
 	if root == "" {
 		root = "."
 	}
@@ -37,20 +98,50 @@ func NewIndexer(redisClient *redis.Client, emb *embedder.Embedder, root string,
 		Embedder:  emb,
 		Root:      root,
 		IndexName: indexName,
+		Policy:    file_policy.Default(),
+	}
+}
+
+// store returns the store that receives chunks.
+func (i *Indexer) store() chunk_retriever.VectorStore {
+	if i.Redis == nil {
+		return i.Store
+	}
+	return chunk_retriever.NewRedisStore(i.Redis)
+}
+
+// target returns the index that receives writes.
+func (i *Indexer) target() string {
+	if i.Target == "" && i.Redis == nil {
+		i.Target = i.IndexName
+	}
+	if i.Target == "" {
+		if resolved, err := chunk_retriever.ResolveIndex(i.Redis, i.IndexName); err == nil {
+			i.Target = resolved
+		} else {
+			i.Target = i.IndexName
+		}
 	}
+	return i.Target
 }
 
 func (i *Indexer) ensureIndex(dim int) error {
-	var err error
 	i.ensureOnce.Do(func() {
-		prefix := i.IndexName + ":"
-		err = chunk_retriever.EnsureIndex(i.Redis, i.IndexName, prefix, dim)
+		ctx := context.Background()
+		target := i.target()
+		i.ensureErr = i.store().EnsureIndex(ctx, target, dim)
+		if i.ensureErr == nil && i.meta != nil {
+			i.meta.Dim = dim
+			if err := i.store().SaveMeta(ctx, target, i.meta); err != nil {
+				i.ensureErr = fmt.Errorf("failed to save index metadata: %w", err)
+			}
+		}
 	})
-	return err
+	return i.ensureErr
 }
 
 func (i *Indexer) IndexFile(ctx context.Context, path string, chunkSize int, overlap int) error {
-	chunks, err := chunker.SplitFile(path, chunkSize, overlap)
+	chunks, err := i.chunkFile(path, chunkSize, overlap)
 	if err != nil {
 		return err
 	}
@@ -65,7 +156,7 @@ func (i *Indexer) IndexFile(ctx context.Context, path string, chunkSize int, ove
 		}
 		// Ensure the vector index exists once, using the first vector's dimension
 		if err := i.ensureIndex(len(vector)); err != nil {
-			return fmt.Errorf("failed to ensure index %q: %w", i.IndexName, err)
+			return fmt.Errorf("failed to ensure index %q: %w", i.target(), err)
 		}
 		if err := i.storeChunk(ctx, path, chunk.Index, chunk.Text, vector); err != nil {
 			fmt.Printf("Warning: failed storing chunk %d: %v\n", chunk.Index, err)
@@ -77,15 +168,68 @@ func (i *Indexer) IndexFile(ctx context.Context, path string, chunkSize int, ove
 
 // ===== Helpers =====
 
-// storeChunk saves a single chunk in Redis under a simple key
+// ChunkKey returns the Redis key of chunk chunkNo of the file at relPath
+// (relative to the indexed root) in indexName.
+func ChunkKey(indexName, relPath string, chunkNo int) string {
+	return fmt.Sprintf("%s:%s:%d", indexName, filepath.ToSlash(relPath), chunkNo)
+}
+
+// relPath returns filePath relative to the indexed root, so files with the
+// same base name in different directories get distinct keys.
+func (ix *Indexer) relPath(filePath string) string {
+	if rel, err := filepath.Rel(ix.Root, filePath); err == nil {
+		return rel
+	}
+	return filePath
+}
+
+// storeChunk saves a single chunk, keyed by its root-relative path
 func (ix *Indexer) storeChunk(ctx context.Context, filePath string, chunkNo int, text string, vec []float32) error {
-	key := fmt.Sprintf("%s:%s:%d", ix.IndexName, filepath.Base(filePath), chunkNo)
-	return ix.Redis.HSet(ctx, key, map[string]any{
+	key, fields := ix.chunkHash(filePath, chunkNo, text, vec)
+	if ix.Redis == nil {
+		return ix.Store.Upsert(ctx, ix.target(), []chunk_retriever.Chunk{hashChunk(key, fields, vec)})
+	}
+	return ix.Redis.HSet(ctx, key, fields).Err()
+}
+
+// chunkHash returns the key and hash fields stored for a chunk.
+func (ix *Indexer) chunkHash(filePath string, chunkNo int, text string, vec []float32) (string, map[string]any) {
+	key := ChunkKey(ix.target(), ix.relPath(filePath), chunkNo)
+	fields := map[string]any{
 		"text":      text,
 		"file":      filePath,
 		"chunk":     chunkNo,
 		"embedding": float32ToBytes(vec),
-	}).Err()
+	}
+	if ix.Workspace != nil {
+		if m := ix.Workspace.ModuleFor(filePath); m != nil {
+			fields["module"] = m.Name
+		}
+	}
+	if ix.Source != "" {
+		fields["source"] = ix.Source
+	}
+	if ix.Fields != nil {
+		for k, v := range ix.Fields(filePath) {
+			fields[k] = v
+		}
+	}
+	return key, fields
+}
+
+// hashChunk turns a chunk hash from chunkHash into the Chunk a Store takes.
+func hashChunk(key string, fields map[string]any, vec []float32) chunk_retriever.Chunk {
+	ch := chunk_retriever.Chunk{Key: key, Metadata: map[string]string{}, Embedding: vec}
+	for k, v := range fields {
+		switch k {
+		case "text":
+			ch.Text = v.(string)
+		case "embedding":
+		default:
+			ch.Metadata[k] = fmt.Sprint(v)
+		}
+	}
+	return ch
 }
 
 // float32ToBytes converts a float32 slice to little-endian bytes
@@ -97,78 +241,97 @@ func float32ToBytes(vec []float32) []byte {
 	return b
 }
 
-// ===== Filters =====
-
-var skipDirs = map[string]struct{}{
-	".git":         {},
-	"node_modules": {},
-	"venv":         {},
-	".venv":        {},
-	"dist":         {},
-	"build":        {},
-	"out":          {},
-	"target":       {},
-	"bin":          {},
-	"vendor":       {},
-}
-
-func shouldSkipDir(name string) bool {
-	_, ok := skipDirs[name]
-	return ok
-}
-
-var allowedExt = map[string]struct{}{
-	".go":   {},
-	".md":   {},
-	".txt":  {},
-	".json": {},
-	".yaml": {},
-	".yml":  {},
-	".py":   {},
-	".js":   {},
-	".ts":   {},
-	".tsx":  {},
-	".jsx":  {},
-}
-
-func isAllowedExtension(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	_, ok := allowedExt[ext]
-	return ok
-}
-
-// Skip dotfiles like .DS_Store, .env, .gitignore, etc.
-func isDotFile(path string) bool {
-	base := filepath.Base(path)
-	return strings.HasPrefix(base, ".")
-}
-
 // ===== Concurrent pipeline =====
 
 type chunkJob struct {
 	filePath string
 	chunk    chunker.Chunk
+	// fileHash is stored with the chunk by stores that update files in place
+	fileHash string
 }
 
-func (i *Indexer) ReIndexDirectory(ctx context.Context, dir string, chunkSize, overlap int) error {
-	// Tunables
-	const fileWorkers = 8
-	const embedWorkers = 10
+// ReIndexDirectory walks dir, chunks every allowed file and embeds and stores
+// the chunks concurrently. Per-file and per-chunk failures are counted in the
+// returned summary; an error is only returned when the run cannot continue,
+// e.g. the vector index cannot be created.
+//
+// Completed files are checkpointed in Redis and failed chunks are pushed to a
+// retry queue, so an interrupted run can continue with Resume and failures can
+// be reprocessed with RetryFailed.
+//
+// Chunks are written to Target, which should be a fresh version from
+// NewVersionName; queries keep using the previous version until Activate
+// switches the alias.
+func (i *Indexer) ReIndexDirectory(ctx context.Context, dir string, chunkSize, overlap int) (progress.Summary, error) {
+	settings := i.Concurrency.Resolve()
+	embedWorkers := i.startPools(settings)
+
+	if i.Progress == nil {
+		i.Progress = progress.Discard()
+	}
+	rep := i.Progress
+
+	// Refuse to mix vectors from different models in one index
+	i.meta = &index_meta.Metadata{
+		Model:     i.Embedder.Model,
+		Chunker:   chunker.Strategy,
+		ChunkSize: chunkSize,
+		Overlap:   overlap,
+		Root:      i.Root,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if existing, err := i.store().LoadMeta(ctx, i.target()); err != nil {
+		return progress.Summary{}, fmt.Errorf("failed to load index metadata: %w", err)
+	} else if existing != nil {
+		if err := existing.CheckBuild(i.target(), i.meta); err != nil {
+			return progress.Summary{}, err
+		}
+	}
+
+	var completed map[string]struct{}
+	if i.Resume {
+		done, err := i.loadCheckpoint(ctx)
+		if err != nil {
+			return progress.Summary{}, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+		completed = done
+	} else if err := i.resetCheckpoint(ctx); err != nil {
+		return progress.Summary{}, fmt.Errorf("failed to reset checkpoint: %w", err)
+	}
+	if err := i.recordRun(ctx, RunRunning, chunkSize, overlap); err != nil {
+		return progress.Summary{}, fmt.Errorf("failed to record run state: %w", err)
+	}
+
+	rep.Start()
 
 	filesCh := make(chan string, 256)
 	chunksCh := make(chan chunkJob, 1024)
-	errCh := make(chan error, 64)
+	tracker := &fileTracker{}
+
+	// The first fatal error cancels the rest of the pipeline
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var fatalOnce sync.Once
+	var fatalErr error
+	fail := func(err error) {
+		fatalOnce.Do(func() {
+			fatalErr = err
+			cancel()
+		})
+	}
+
+	i.walked = map[string]struct{}{}
 
 	// walk dir
 	var walkWG sync.WaitGroup
 	walkWG.Add(1)
-	go i.walkDirectory(dir, filesCh, &walkWG)
+	go i.walkDirectory(runCtx, dir, completed, filesCh, &walkWG)
 
 	// file -> chunks (concurrent)
 	var chunkWG sync.WaitGroup
-	for w := 0; w < fileWorkers; w++ {
+	for w := 0; w < settings.FileWorkers; w++ {
 		chunkWG.Add(1)
-		go i.processFiles(filesCh, chunksCh, errCh, chunkSize, overlap, &chunkWG)
+		go i.processFiles(runCtx, filesCh, chunksCh, tracker, chunkSize, overlap, &chunkWG)
 	}
 
 	// Close filesCh once walking finishes
@@ -176,6 +339,7 @@ func (i *Indexer) ReIndexDirectory(ctx context.Context, dir string, chunkSize, o
 	go func() {
 		walkWG.Wait()
 		close(filesCh)
+		rep.DiscoveryDone()
 		chunkWG.Wait()
 		close(chunksCh)
 	}()
@@ -184,80 +348,330 @@ func (i *Indexer) ReIndexDirectory(ctx context.Context, dir string, chunkSize, o
 	var embedWG sync.WaitGroup
 	for w := 0; w < embedWorkers; w++ {
 		embedWG.Add(1)
-		go i.embedAndStore(ctx, chunksCh, errCh, &embedWG)
+		go i.embedAndStore(runCtx, chunksCh, fail, tracker, &embedWG)
 	}
+	embedWG.Wait()
+	i.finishPools(runCtx, settings, true)
 
-	// Drain errors in background so we don't block
-	doneErr := make(chan struct{})
-	go drainErrors(errCh, doneErr)
+	summary := rep.Finish(i.target(), i.Root)
 
-	// Wait for embedding stage to finish, then close errCh
-	embedWG.Wait()
-	close(errCh)
-	<-doneErr
+	// Record the outcome with a fresh context; the run context may be cancelled
+	status := RunBuilt
+	if fatalErr != nil || runCtx.Err() != nil {
+		status = RunInterrupted
+	}
+	if err := i.setRunStatus(context.WithoutCancel(ctx), status); err != nil {
+		rep.Warn(fmt.Errorf("failed to record run state: %w", err))
+	}
+
+	if fatalErr != nil {
+		return summary, fatalErr
+	}
+	if runCtx.Err() != nil {
+		return summary, runCtx.Err()
+	}
+	if err := i.pruneFiles(ctx); err != nil {
+		rep.Warn(fmt.Errorf("failed to remove deleted files from the index: %w", err))
+	}
+	return summary, nil
+}
 
+// fileStore is implemented by stores that update the files of an index in
+// place, such as local_store, rather than building a fresh version.
+type fileStore interface {
+	// Files lists the files with chunks in index.
+	Files(index string) ([]string, error)
+	// FileState returns the hash stored with every chunk of file and its
+	// chunk count.
+	FileState(index, file string) (hash string, chunks int, err error)
+	// PruneFile removes the chunks of file numbered keep or above.
+	PruneFile(index, file string, keep int) (int64, error)
+}
+
+// inPlace returns the Store when the run updates its files in place.
+func (i *Indexer) inPlace() (fileStore, bool) {
+	if i.Redis != nil {
+		return nil, false
+	}
+	fs, ok := i.Store.(fileStore)
+	return fs, ok
+}
+
+// fileHash identifies a file's chunks, so an unchanged file is not
+// re-embedded. Chunking settings are part of it because they change the
+// chunks.
+func fileHash(chunks []chunker.Chunk, chunkSize, overlap int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%d\n", chunkSize, overlap)
+	for _, ch := range chunks {
+		fmt.Fprintf(h, "%d:%s", len(ch.Text), ch.Text)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// pruneFile removes the chunks of path numbered keep or above.
+func (i *Indexer) pruneFile(path string, keep int) {
+	fs, _ := i.inPlace()
+	if _, err := fs.PruneFile(i.target(), path, keep); err != nil {
+		i.Progress.Warn(fmt.Errorf("failed to remove old chunks of %s: %w", path, err))
+	}
+}
+
+// pruneFiles removes the chunks of files a Store run did not find, such as
+// files deleted since the last run. Redis runs build a fresh version instead.
+func (i *Indexer) pruneFiles(ctx context.Context) error {
+	lister, ok := i.inPlace()
+	if !ok {
+		return nil
+	}
+	files, err := lister.Files(i.target())
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, ok := i.walked[f]; ok {
+			continue
+		}
+		if _, err := i.Store.DeleteFile(ctx, i.target(), f); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Walk directory and push file paths
-func (i *Indexer) walkDirectory(dir string, filesCh chan<- string, wg *sync.WaitGroup) {
+// Walk directory (or every workspace module, or the Discover source) and
+// push file paths, skipping files already completed
+func (i *Indexer) walkDirectory(ctx context.Context, dir string, completed map[string]struct{}, filesCh chan<- string, wg *sync.WaitGroup) {
 	defer wg.Done()
-	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return nil // skip unreadable entries
+	emit := func(path string) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
 		}
-		if d.IsDir() {
-			if shouldSkipDir(d.Name()) {
-				return filepath.SkipDir
-			}
+		if i.Select != nil && !i.Select(path) {
 			return nil
 		}
-		if isDotFile(path) || !isAllowedExtension(path) {
+		i.Progress.FileDiscovered()
+		i.walked[path] = struct{}{}
+		if _, ok := completed[path]; ok {
+			i.Progress.FileSkipped()
 			return nil
 		}
 		filesCh <- path
 		return nil
-	})
+	}
+	switch {
+	case i.Discover != nil:
+		_ = i.Discover(ctx, emit)
+	case i.Workspace == nil:
+		_ = i.Policy.Walk(dir, emit)
+	default:
+		for m := range i.Workspace.Modules {
+			if ctx.Err() != nil {
+				return
+			}
+			module := &i.Workspace.Modules[m]
+			// Files of a module nested inside this one are left to its own walk
+			_ = i.Policy.Walk(module.Dir, func(path string) error {
+				if i.Workspace.ModuleFor(path) != module {
+					return nil
+				}
+				return emit(path)
+			})
+		}
+	}
 }
 
-func (i *Indexer) processFiles(filesCh <-chan string, chunksCh chan<- chunkJob, errCh chan<- error, chunkSize, overlap int, wg *sync.WaitGroup) {
+func (i *Indexer) processFiles(ctx context.Context, filesCh <-chan string, chunksCh chan<- chunkJob, tracker *fileTracker, chunkSize, overlap int, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for path := range filesCh {
-		fmt.Printf("Indexing file: %s\n", path)
-		chunks, err := chunker.SplitFile(path, chunkSize, overlap)
+		if ctx.Err() != nil {
+			continue // keep draining so the walker never blocks
+		}
+		chunks, err := i.chunkFile(path, chunkSize, overlap)
 		if err != nil {
-			errCh <- fmt.Errorf("split failed for %s: %w", path, err)
+			i.Progress.FileFailed(path, fmt.Errorf("split failed for %s: %w", path, err))
+			continue
+		}
+		// Updating in place: unchanged files keep their chunks, and the new
+		// chunks of a changed file overwrite the old ones as they are stored
+		var hash string
+		if fs, ok := i.inPlace(); ok {
+			hash = fileHash(chunks, chunkSize, overlap)
+			if stored, n, err := fs.FileState(i.target(), path); err == nil && n > 0 && stored == hash && n == len(chunks) {
+				i.Progress.FileSkipped()
+				continue
+			}
+			if len(chunks) == 0 {
+				i.pruneFile(path, 0)
+			}
+		}
+		i.Progress.FileChunked(len(chunks))
+		if len(chunks) == 0 {
+			i.markFileDone(ctx, path)
 			continue
 		}
+		tracker.add(path, len(chunks))
 		for _, ch := range chunks {
-			chunksCh <- chunkJob{filePath: path, chunk: ch}
+			chunksCh <- chunkJob{filePath: path, chunk: ch, fileHash: hash}
+		}
+	}
+}
+
+// chunkFile splits path, or the text Extract derives from it, into chunks.
+// Secrets are redacted from the whole text first so that none straddles a
+// chunk boundary.
+func (i *Indexer) chunkFile(path string, chunkSize, overlap int) ([]chunker.Chunk, error) {
+	var text string
+	if i.Extract != nil {
+		var err error
+		if text, err = i.Extract(path); err != nil {
+			return nil, err
 		}
+	} else {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			// skip binary or invalid UTF-8 files
+			return nil, nil
+		}
+		text = string(b)
 	}
+	text = i.Redactor.Redact(i.relPath(path), text)
+	return chunker.Split(text, chunkSize, overlap), nil
 }
 
-func (i *Indexer) embedAndStore(ctx context.Context, chunksCh <-chan chunkJob, errCh chan<- error, wg *sync.WaitGroup) {
+// embedAndStore embeds chunk jobs and hands them to the batch writer. A
+// failed chunk is pushed to the retry queue; a file is checkpointed once all
+// its chunks are written or queued. tracker is nil when processing the retry
+// queue itself.
+func (i *Indexer) embedAndStore(ctx context.Context, chunksCh <-chan chunkJob, fail func(error), tracker *fileTracker, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for job := range chunksCh {
-		vec, err := i.Embedder.EmbedText(job.chunk.Text)
-		if err != nil {
-			errCh <- fmt.Errorf("embed failed %s [chunk %d]: %w", job.filePath, job.chunk.Index, err)
+		if ctx.Err() != nil {
+			// Drain remaining jobs after a fatal error. Retry jobs were already
+			// taken off the queue, so put them back rather than lose them.
+			if tracker == nil {
+				i.pushFailed(ctx, job, ctx.Err())
+			}
 			continue
 		}
-		if err := i.ensureIndex(len(vec)); err != nil {
-			errCh <- fmt.Errorf("ensure index failed: %w", err)
-			return
+		i.embedAndStoreChunk(ctx, job, fail, func(err error) {
+			i.finishChunk(ctx, job, tracker, err)
+		})
+	}
+}
+
+// embedAndStoreChunk embeds job and queues its write. done is called exactly
+// once, with the embedding or write error, when the chunk is finished.
+func (i *Indexer) embedAndStoreChunk(ctx context.Context, job chunkJob, fail func(error), done func(error)) {
+	vec, err := i.embed(ctx, job.chunk.Text)
+	if err != nil {
+		done(fmt.Errorf("embed failed %s [chunk %d]: %w", job.filePath, job.chunk.Index, err))
+		return
+	}
+	i.Progress.ChunkEmbedded()
+	if err := i.ensureIndex(len(vec)); err != nil {
+		err = fmt.Errorf("ensure index failed: %w", err)
+		fail(err)
+		done(err)
+		return
+	}
+	key, fields := i.chunkHash(job.filePath, job.chunk.Index, job.chunk.Text, vec)
+	if job.fileHash != "" {
+		fields["hash"] = job.fileHash
+	}
+	i.writer.add(ctx, key, fields, vec, func(err error) {
+		if err != nil {
+			err = fmt.Errorf("store failed %s [chunk %d]: %w", job.filePath, job.chunk.Index, err)
 		}
-		if err := i.storeChunk(ctx, job.filePath, job.chunk.Index, job.chunk.Text, vec); err != nil {
-			errCh <- fmt.Errorf("store failed %s [chunk %d]: %w", job.filePath, job.chunk.Index, err)
-			continue
+		done(err)
+	})
+}
+
+// finishChunk records the outcome of a chunk and checkpoints its file once
+// every chunk of the file is finished.
+func (i *Indexer) finishChunk(ctx context.Context, job chunkJob, tracker *fileTracker, err error) {
+	if err != nil {
+		i.Progress.ChunkFailed(job.filePath, job.chunk.Index, err)
+		i.pushFailed(ctx, job, err)
+	} else {
+		i.Progress.ChunkStored()
+	}
+	if ctx.Err() != nil || tracker == nil {
+		return
+	}
+	total, stored, last := tracker.done(job.filePath, err != nil)
+	if !last {
+		return
+	}
+	i.markFileDone(ctx, job.filePath)
+	// Old chunks past the new end of the file go only once the new ones
+	// are all stored; after a failure the mixed hashes re-index it next run
+	if stored {
+		if _, ok := i.inPlace(); ok {
+			i.pruneFile(job.filePath, total)
 		}
 	}
 }
 
-// Drain errors so we don’t block
-func drainErrors(errCh <-chan error, done chan<- struct{}) {
-	defer close(done)
-	for e := range errCh {
-		fmt.Println("Warning:", e)
+// ===== Worker pools =====
+
+// startPools prepares the embedding pool and the batch writer for a run and
+// returns how many embedding workers to start. In adaptive mode the pool is
+// sized for the maximum and the limiter decides how many may call the API at
+// once.
+func (i *Indexer) startPools(s concurrency.Settings) int {
+	i.writer = newBatchWriter(i.Redis, s)
+	if i.Redis == nil {
+		i.writer.store, i.writer.index = i.Store, i.target()
+	}
+	if !s.Adaptive {
+		i.limiter = nil
+		return s.EmbedWorkers
+	}
+	i.limiter = concurrency.NewLimiter(s.EmbedWorkers, s.MinEmbedWorkers, s.MaxEmbedWorkers)
+	return s.MaxEmbedWorkers
+}
+
+// embed calls the embedding API, within the adaptive limit if there is one.
+func (i *Indexer) embed(ctx context.Context, text string) ([]float32, error) {
+	if i.limiter == nil {
+		return i.Embedder.EmbedText(text)
+	}
+	if err := i.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	vec, err := i.Embedder.EmbedText(text)
+	i.limiter.Release(time.Since(start), err)
+	return vec, err
+}
+
+// finishPools sends the writes still buffered and records the pool sizes and
+// write statistics for the summary.
+func (i *Indexer) finishPools(ctx context.Context, s concurrency.Settings, readsFiles bool) {
+	i.writer.flush(ctx)
+	w := i.workers(s)
+	if !readsFiles {
+		w.Files = 0
+	}
+	i.Progress.SetWorkers(w)
+	i.Progress.SetWrites(i.writer.stats())
+}
+
+// workers reports the pool sizes used by a run for its summary.
+func (i *Indexer) workers(s concurrency.Settings) progress.Workers {
+	w := progress.Workers{Files: s.FileWorkers, Embed: s.EmbedWorkers}
+	if i.limiter != nil {
+		st := i.limiter.Stats()
+		w.Adaptive = true
+		w.Embed = st.Final
+		w.EmbedInitial = st.Initial
+		w.EmbedLow = st.Low
+		w.EmbedHigh = st.High
+		w.EmbedAdjustments = st.Adjustments
 	}
+	return w
 }
@@ -0,0 +1,73 @@
+package re_indexer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+
+	"smart-cli/go-backend/index_meta"
+)
+
+// Ways of assigning files to shards.
+const (
+	// ShardByDir keeps each top-level directory in a single shard.
+	ShardByDir = "dir"
+	// ShardByHash spreads files evenly by hashing their path.
+	ShardByHash = "hash"
+)
+
+// ShardOf returns the shard in [0, count) that the file at relPath (relative
+// to the indexed root) belongs to. The assignment depends only on the path,
+// so any shard can be rebuilt on its own.
+func ShardOf(by string, count int, relPath string) int {
+	if count <= 1 {
+		return 0
+	}
+	key := filepath.ToSlash(relPath)
+	if by == ShardByDir {
+		// Files directly under the root share the "." shard
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i]
+		} else {
+			key = "."
+		}
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(count))
+}
+
+// ValidShardBy checks a --shard-by value.
+func ValidShardBy(by string) error {
+	switch by {
+	case ShardByDir, ShardByHash:
+		return nil
+	}
+	return fmt.Errorf("unknown shard strategy %q (want %s or %s)", by, ShardByDir, ShardByHash)
+}
+
+// ForShard returns an indexer for shard k of set that shares i's settings
+// and indexes only the files assigned to that shard.
+func (i *Indexer) ForShard(set *index_meta.ShardSet, k int) *Indexer {
+	shard := &Indexer{
+		Redis:       i.Redis,
+		Embedder:    i.Embedder,
+		Root:        i.Root,
+		IndexName:   index_meta.ShardName(set.Name, k),
+		Resume:      i.Resume,
+		Policy:      i.Policy,
+		Workspace:   i.Workspace,
+		Extract:     i.Extract,
+		Source:      i.Source,
+		Discover:    i.Discover,
+		Fields:      i.Fields,
+		Redactor:    i.Redactor,
+		Concurrency: i.Concurrency,
+		Progress:    i.Progress,
+	}
+	shard.Select = func(path string) bool {
+		return ShardOf(set.By, set.Count, shard.relPath(path)) == k
+	}
+	return shard
+}
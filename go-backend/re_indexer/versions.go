@@ -0,0 +1,67 @@
+package re_indexer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/index_meta"
+)
+
+// NewVersionName returns a fresh versioned index name for alias. Its key
+// prefix is "<version>:", so it never overlaps the live version's keys.
+func NewVersionName(alias string) string {
+	return fmt.Sprintf("%s_v%d", alias, time.Now().UnixMilli())
+}
+
+// Activate atomically switches the alias IndexName to Target with
+// FT.ALIASUPDATE and returns the index the alias pointed at before ("" if
+// none), which the caller should drop once nothing needs it.
+//
+// A pre-alias index that is itself named IndexName is dropped first, since an
+// alias cannot share its name; this is the only moment queries see no index.
+func (i *Indexer) Activate(ctx context.Context) (previous string, err error) {
+	alias, target := i.IndexName, i.target()
+	if alias == target {
+		return "", fmt.Errorf("cannot activate %q: it is not a versioned index", target)
+	}
+
+	if resolved, err := chunk_retriever.ResolveIndex(i.Redis, alias); err == nil {
+		if resolved == alias {
+			if err := i.dropLegacyIndex(ctx, alias); err != nil {
+				return "", err
+			}
+		} else {
+			previous = resolved
+		}
+	}
+
+	if err := i.Redis.Do(ctx, "FT.ALIASUPDATE", alias, target).Err(); err != nil {
+		return "", fmt.Errorf("FT.ALIASUPDATE %s %s: %w", alias, target, err)
+	}
+	if err := index_meta.SetAlias(ctx, i.Redis, alias, target); err != nil {
+		return previous, fmt.Errorf("alias switched but recording it failed: %w", err)
+	}
+	if err := i.setRunStatus(ctx, RunComplete); err != nil {
+		return previous, fmt.Errorf("alias switched but recording run state failed: %w", err)
+	}
+	if previous == target {
+		previous = ""
+	}
+	return previous, nil
+}
+
+// dropLegacyIndex removes an unversioned index and its documents.
+func (i *Indexer) dropLegacyIndex(ctx context.Context, name string) error {
+	if strings.HasPrefix(i.target(), name+":") {
+		return fmt.Errorf("refusing to drop %q: its key prefix overlaps %q", name, i.target())
+	}
+	if err := i.Redis.Do(ctx, "FT.DROPINDEX", name, "DD").Err(); err != nil {
+		return fmt.Errorf("FT.DROPINDEX %s: %w", name, err)
+	}
+	keys := append(StateKeys(name), index_meta.Key(name))
+	_, err := chunk_retriever.DeleteKeys(ctx, i.Redis, keys...)
+	return err
+}
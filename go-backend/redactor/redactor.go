@@ -0,0 +1,320 @@
+package redactor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is the "redaction" section of the project config.
+type Config struct {
+	// Disabled turns redaction off entirely.
+	Disabled bool `json:"disabled,omitempty"`
+	// Patterns are custom detectors added to the built-in ones.
+	Patterns []Pattern `json:"patterns,omitempty"`
+	// Allow lists regexes for values that must never be redacted, e.g. test
+	// fixtures or public example keys.
+	Allow []string `json:"allow,omitempty"`
+	// EntropyThreshold is the minimum Shannon entropy in bits per character
+	// for a token to count as a secret; 0 uses DefaultEntropyThreshold and a
+	// negative value disables the entropy detector.
+	EntropyThreshold float64 `json:"entropy_threshold,omitempty"`
+}
+
+// Pattern is a named custom detector. If the regex has a capture group, only
+// the first group is redacted.
+type Pattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
+}
+
+// DefaultEntropyThreshold flags random-looking tokens of mixed case and
+// digits; identifiers and git SHAs stay well below it.
+const DefaultEntropyThreshold = 4.2
+
+// minEntropyLen is the shortest token the entropy detector considers.
+const minEntropyLen = 24
+
+type detector struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var builtin = []detector{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`)},
+	{"gcp_private_key_id", regexp.MustCompile(`"private_key_id"\s*:\s*"([0-9a-f]{40})"`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{"stripe_key", regexp.MustCompile(`\b[sr]k_(?:live|test)_[0-9A-Za-z]{20,}\b`)},
+	{"api_key", regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{20,}\b`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`)},
+}
+
+var tokenRe = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{24,}`)
+
+// Redactor replaces secrets and personal data with stable placeholders of
+// the form [REDACTED:<kind>:<hash>], where hash is derived from the value, so
+// the same secret always maps to the same placeholder.
+type Redactor struct {
+	detectors []detector
+	allow     []*regexp.Regexp
+	entropy   float64
+
+	auditPath string
+	mu        sync.Mutex
+	audit     *os.File
+	counts    map[string]int
+}
+
+// New builds a redactor from cfg. Redactions are appended to auditPath as
+// JSON lines; an empty auditPath disables the audit log.
+func New(cfg Config, auditPath string) (*Redactor, error) {
+	r := &Redactor{
+		detectors: append([]detector(nil), builtin...),
+		entropy:   cfg.EntropyThreshold,
+		auditPath: auditPath,
+		counts:    map[string]int{},
+	}
+	if r.entropy == 0 {
+		r.entropy = DefaultEntropyThreshold
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p.Name, err)
+		}
+		if p.Name == "" {
+			return nil, fmt.Errorf("redaction pattern %q has no name", p.Regex)
+		}
+		r.detectors = append(r.detectors, detector{kind: p.Name, re: re})
+	}
+	for _, a := range cfg.Allow {
+		re, err := regexp.Compile(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction allow pattern %q: %w", a, err)
+		}
+		r.allow = append(r.allow, re)
+	}
+	return r, nil
+}
+
+// auditEntry is one redaction in the audit log. The secret itself is never
+// written; the placeholder identifies it.
+type auditEntry struct {
+	Time        string `json:"time"`
+	Source      string `json:"source"`
+	Line        int    `json:"line"`
+	Kind        string `json:"kind"`
+	Placeholder string `json:"placeholder"`
+	Length      int    `json:"length"`
+}
+
+type match struct {
+	start, end int
+	kind       string
+}
+
+// Redact returns text with every detected secret replaced. source names
+// where the text came from (a file path or "prompt") for the audit log.
+func (r *Redactor) Redact(source, text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	matches := r.find(text)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	var entries []auditEntry
+	now := time.Now().UTC().Format(time.RFC3339)
+	last := 0
+	for _, m := range matches {
+		value := text[m.start:m.end]
+		ph := Placeholder(m.kind, value)
+		b.WriteString(text[last:m.start])
+		b.WriteString(ph)
+		last = m.end
+		entries = append(entries, auditEntry{
+			Time:        now,
+			Source:      source,
+			Line:        strings.Count(text[:m.start], "\n") + 1,
+			Kind:        m.kind,
+			Placeholder: ph,
+			Length:      len(value),
+		})
+	}
+	b.WriteString(text[last:])
+	r.record(entries)
+	return b.String()
+}
+
+// Counts returns the number of redactions made so far, by kind.
+func (r *Redactor) Counts() map[string]int {
+	out := map[string]int{}
+	if r == nil {
+		return out
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range r.counts {
+		out[k] = v
+	}
+	return out
+}
+
+// AuditPath returns the audit log file, or "" when auditing is off.
+func (r *Redactor) AuditPath() string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.auditPath
+}
+
+// Close flushes and closes the audit log.
+func (r *Redactor) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.audit == nil {
+		return nil
+	}
+	err := r.audit.Close()
+	r.audit = nil
+	return err
+}
+
+// Placeholder returns the stable replacement for value.
+func Placeholder(kind, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("[REDACTED:%s:%s]", kind, hex.EncodeToString(sum[:4]))
+}
+
+// ===== Helpers =====
+
+// find returns non-overlapping matches ordered by position. Where detectors
+// overlap, the earliest and then the longest match wins.
+func (r *Redactor) find(text string) []match {
+	var all []match
+	for _, d := range r.detectors {
+		for _, loc := range d.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start < end && !r.allowed(text[start:end]) {
+				all = append(all, match{start, end, d.kind})
+			}
+		}
+	}
+	if r.entropy > 0 {
+		for _, loc := range tokenRe.FindAllStringIndex(text, -1) {
+			tok := text[loc[0]:loc[1]]
+			if looksRandom(tok, r.entropy) && !r.allowed(tok) {
+				all = append(all, match{loc[0], loc[1], "high_entropy"})
+			}
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+
+	sort.Slice(all, func(a, b int) bool {
+		if all[a].start != all[b].start {
+			return all[a].start < all[b].start
+		}
+		return all[a].end > all[b].end
+	})
+	out := all[:1]
+	for _, m := range all[1:] {
+		if m.start < out[len(out)-1].end {
+			continue // overlaps a match already taken
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func (r *Redactor) allowed(value string) bool {
+	for _, re := range r.allow {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) record(entries []auditEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range entries {
+		r.counts[e.Kind]++
+	}
+	if r.auditPath == "" {
+		return
+	}
+	if r.audit == nil {
+		if err := os.MkdirAll(filepath.Dir(r.auditPath), 0o700); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot write redaction audit: %v\n", err)
+			r.auditPath = ""
+			return
+		}
+		f, err := os.OpenFile(r.auditPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot write redaction audit: %v\n", err)
+			r.auditPath = ""
+			return
+		}
+		r.audit = f
+	}
+	enc := json.NewEncoder(r.audit)
+	for _, e := range entries {
+		_ = enc.Encode(e)
+	}
+}
+
+// looksRandom reports whether tok mixes upper case, lower case and digits and
+// has at least minBits of Shannon entropy per character.
+func looksRandom(tok string, minBits float64) bool {
+	if len(tok) < minEntropyLen {
+		return false
+	}
+	var upper, lower, digit bool
+	freq := map[rune]int{}
+	for _, c := range tok {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		freq[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	var bits float64
+	n := float64(len(tok))
+	for _, count := range freq {
+		p := float64(count) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits >= minBits
+}
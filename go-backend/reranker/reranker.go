@@ -0,0 +1,289 @@
+package reranker
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/generator"
+)
+
+// Reranker kinds.
+const (
+	None    = "none"
+	Lexical = "lexical"
+	LLM     = "llm"
+)
+
+// Reranker scores retrieved chunks by their relevance to a query.
+type Reranker interface {
+	// Score returns one score per chunk, in order. Higher = more relevant.
+	Score(ctx context.Context, query string, chunks []chunk_retriever.Chunk) ([]float64, error)
+}
+
+// New returns the reranker of the given kind, or nil for None. gen is only
+// used, and required, by the LLM reranker.
+func New(kind string, gen *generator.Generator) (Reranker, error) {
+	switch kind {
+	case None, "":
+		return nil, nil
+	case Lexical:
+		return LexicalReranker{}, nil
+	case LLM:
+		if gen == nil {
+			return nil, fmt.Errorf("the llm reranker needs a generation model")
+		}
+		return &LLMReranker{Generator: gen}, nil
+	}
+	return nil, fmt.Errorf("unknown reranker %q (want %s, %s or %s)", kind, None, Lexical, LLM)
+}
+
+// Rerank scores chunks with r, records each score in Chunk.Rerank and returns
+// the best k, most relevant first. Ties keep the retrieval order.
+func Rerank(ctx context.Context, r Reranker, query string, chunks []chunk_retriever.Chunk, k int) ([]chunk_retriever.Chunk, error) {
+	if len(chunks) == 0 {
+		return chunks, nil
+	}
+	scores, err := r.Score(ctx, query, chunks)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) != len(chunks) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d chunks", len(scores), len(chunks))
+	}
+
+	ranked := make([]chunk_retriever.Chunk, len(chunks))
+	copy(ranked, chunks)
+	for i := range ranked {
+		ranked[i].Rerank = scores[i]
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Rerank > ranked[j].Rerank })
+	if k > 0 && len(ranked) > k {
+		ranked = ranked[:k]
+	}
+	return ranked, nil
+}
+
+// ===== Lexical reranker =====
+
+// Weights of the lexical score.
+const (
+	symbolWeight       = 1.0
+	boilerplatePenalty = 0.5
+	priorWeight        = 0.2
+)
+
+// LexicalReranker scores chunks offline: the share of query terms a chunk
+// contains, a bonus for query identifiers it declares or uses, and a penalty
+// for chunks made mostly of imports, comments and blank lines. A small prior
+// from the retrieval order breaks ties.
+type LexicalReranker struct{}
+
+func (LexicalReranker) Score(_ context.Context, query string, chunks []chunk_retriever.Chunk) ([]float64, error) {
+	terms := termSet(query)
+	for w := range terms {
+		if stopwords[w] {
+			delete(terms, w)
+		}
+	}
+	symbols := querySymbols(query)
+	declared := make([]*regexp.Regexp, len(symbols))
+	for i, sym := range symbols {
+		declared[i] = regexp.MustCompile(`\b(?:func|type|class|def|fn|var|const|let|interface|struct)\s+(?:\([^)]*\)\s*)?` + regexp.QuoteMeta(sym) + `\b`)
+	}
+
+	scores := make([]float64, len(chunks))
+	for i, ch := range chunks {
+		var score float64
+		if len(terms) > 0 {
+			words := termSet(ch.Text)
+			matched := 0
+			for t := range terms {
+				if words[t] {
+					matched++
+				}
+			}
+			score = float64(matched) / float64(len(terms))
+		}
+		if len(symbols) > 0 {
+			var hits float64
+			for n, sym := range symbols {
+				switch {
+				case declared[n].MatchString(ch.Text):
+					hits++
+				case containsWord(ch.Text, sym):
+					hits += 0.5
+				}
+			}
+			score += symbolWeight * hits / float64(len(symbols))
+		}
+		score *= 1 - boilerplatePenalty*boilerplate(ch.Text)
+		score += priorWeight * float64(len(chunks)-i) / float64(len(chunks))
+		scores[i] = score
+	}
+	return scores, nil
+}
+
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "what": true, "does": true, "this": true,
+	"that": true, "with": true, "how": true, "why": true, "when": true, "where": true,
+	"which": true, "who": true, "are": true, "was": true, "from": true, "into": true,
+	"about": true, "there": true, "their": true, "have": true, "has": true, "can": true,
+	"should": true, "would": true, "could": true, "its": true, "use": true, "used": true,
+	"explain": true, "code": true, "file": true, "function": true, "method": true,
+}
+
+// words splits text into identifier-like words.
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// termSet returns the lowercase words of text of 3+ characters together with
+// the parts of camelCase and snake_case identifiers, so "storeChunk" also
+// matches "store" and "chunk".
+func termSet(text string) map[string]bool {
+	set := map[string]bool{}
+	add := func(w string) {
+		if len(w) >= 3 {
+			set[strings.ToLower(w)] = true
+		}
+	}
+	for _, w := range words(text) {
+		add(w)
+		for _, part := range splitIdentifier(w) {
+			add(part)
+		}
+	}
+	return set
+}
+
+// splitIdentifier splits a camelCase or snake_case identifier into its parts.
+func splitIdentifier(w string) []string {
+	var parts []string
+	for _, seg := range strings.Split(w, "_") {
+		start := 0
+		runes := []rune(seg)
+		for i := 1; i < len(runes); i++ {
+			if unicode.IsUpper(runes[i]) && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
+
+// querySymbols returns the words of query that look like code identifiers:
+// they contain an underscore or an upper-case letter after the first.
+func querySymbols(query string) []string {
+	seen := map[string]bool{}
+	var symbols []string
+	for _, w := range words(query) {
+		if seen[w] || len(w) < 3 {
+			continue
+		}
+		if strings.Contains(w, "_") || strings.IndexFunc(w[1:], unicode.IsUpper) >= 0 {
+			seen[w] = true
+			symbols = append(symbols, w)
+		}
+	}
+	return symbols
+}
+
+// containsWord reports whether w occurs in text as a whole word.
+func containsWord(text, w string) bool {
+	for _, tw := range words(text) {
+		if tw == w {
+			return true
+		}
+	}
+	return false
+}
+
+// boilerplate returns the share of text's lines that are blank, comments,
+// or package and import declarations.
+func boilerplate(text string) float64 {
+	lines := strings.Split(text, "\n")
+	n := 0
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", line == ")",
+			strings.HasPrefix(line, "//"), strings.HasPrefix(line, "#"),
+			strings.HasPrefix(line, "/*"), strings.HasPrefix(line, "*"),
+			strings.HasPrefix(line, "package "), strings.HasPrefix(line, "import "),
+			strings.HasPrefix(line, "from "), strings.HasPrefix(line, "using "),
+			strings.HasPrefix(line, `"`) && strings.HasSuffix(line, `"`):
+			n++
+		}
+	}
+	return float64(n) / float64(len(lines))
+}
+
+// ===== LLM reranker =====
+
+// DefaultMaxChars is how much of each chunk the LLM reranker shows the model.
+const DefaultMaxChars = 1500
+
+// LLMReranker asks the generation model to rate each chunk's relevance from
+// 0 to 10 in a single prompt.
+type LLMReranker struct {
+	Generator *generator.Generator
+	// MaxChars truncates each chunk in the prompt; 0 means DefaultMaxChars.
+	MaxChars int
+}
+
+func (r *LLMReranker) Score(ctx context.Context, query string, chunks []chunk_retriever.Chunk) ([]float64, error) {
+	maxChars := r.MaxChars
+	if maxChars <= 0 {
+		maxChars = DefaultMaxChars
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Rate how relevant each code excerpt below is to answering the question, from 0 (unrelated) to 10 (directly answers it). Boilerplate such as imports or license headers is rarely relevant.
+
+Question: %s
+`, query)
+	for i, ch := range chunks {
+		text := ch.Text
+		if len(text) > maxChars {
+			// Back off to a rune boundary so no character is split
+			cut := maxChars
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			text = text[:cut] + "\n..."
+		}
+		fmt.Fprintf(&b, "\n--- excerpt %d (%s) ---\n%s\n", i, ch.Metadata["file"], text)
+	}
+	fmt.Fprintf(&b, "\nReply with only a JSON array of %d numbers, the score of each excerpt in order.", len(chunks))
+
+	reply, err := r.Generator.Generate(ctx, b.String(), 0, generator.ThinkingTokens+int32(8*len(chunks)))
+	if err != nil {
+		return nil, err
+	}
+	return ParseScores(reply, len(chunks))
+}
+
+// ParseScores extracts the JSON array of n scores from a reranker reply.
+func ParseScores(reply string, n int) ([]float64, error) {
+	var scores []float64
+	if err := generator.ParseJSONArray(reply, &scores); err != nil {
+		return nil, fmt.Errorf("reranker: %w", err)
+	}
+	if len(scores) != n {
+		return nil, fmt.Errorf("reranker scored %d of %d chunks", len(scores), n)
+	}
+	return scores, nil
+}
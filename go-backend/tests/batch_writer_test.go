@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/concurrency"
+)
+
+func TestBatchWriterCommandErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		batchSize int
+	}{
+		{name: "pipeline", mode: concurrency.WritePipeline, batchSize: 4},
+		{name: "multi", mode: concurrency.WriteMulti, batchSize: 4},
+		{name: "unbatched", mode: concurrency.WritePipeline, batchSize: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, rdb := newFakeRedis(t)
+			dir := writeFiles(t, map[string]string{"a.go": "aaaabbbb", "c.go": "cccc"})
+			// Only the write of a.go's second chunk fails; the other
+			// commands of its batch still apply
+			fake.setReject(func(args []string) string {
+				if strings.EqualFold(args[0], "HSET") && args[1] == "proj_v1:a.go:1" {
+					return "OOM command not allowed"
+				}
+				return ""
+			})
+			ix := newSerialIndexer(rdb, newFakeEmbedder(t, &fakeEmbedder{}), dir)
+			ix.Concurrency.WriteMode = tt.mode
+			ix.Concurrency.BatchSize = tt.batchSize
+			summary, err := ix.ReIndexDirectory(context.Background(), dir, chunkSize, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.ChunksStored != 2 || summary.ChunksFailed != 1 {
+				t.Fatalf("stored %d and failed %d chunks, want 2 and 1", summary.ChunksStored, summary.ChunksFailed)
+			}
+			if w := summary.Writes; w == nil || w.Commands != 3 || w.Failed != 1 || w.Mode != tt.mode {
+				t.Fatalf("write stats %+v", w)
+			}
+			if got, want := fake.keysWithPrefix("proj_v1:"), []string{"proj_v1:a.go:0", "proj_v1:c.go:0"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("chunk keys %v, want %v", got, want)
+			}
+
+			queue := fake.list("smartcli:failed:proj_v1")
+			if len(queue) != 1 {
+				t.Fatalf("retry queue %q, want one entry", queue)
+			}
+			var job struct {
+				Chunk int    `json:"chunk"`
+				Text  string `json:"text"`
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(queue[0]), &job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Chunk != 1 || job.Text != "bbbb" || !strings.Contains(job.Error, "OOM command not allowed") {
+				t.Fatalf("queued %+v", job)
+			}
+		})
+	}
+}
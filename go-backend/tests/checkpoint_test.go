@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	"smart-cli/go-backend/concurrency"
+	"smart-cli/go-backend/embedder"
+	"smart-cli/go-backend/re_indexer"
+)
+
+// writeFiles creates files (name -> contents) under a new directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// newSerialIndexer returns an indexer of dir into version "proj_v1" with one
+// worker per stage and unbatched writes, so chunks are handled in walk order.
+func newSerialIndexer(rdb redis.UniversalClient, emb *embedder.Embedder, dir string) *re_indexer.Indexer {
+	ix := re_indexer.NewIndexer(rdb, emb, dir, "proj")
+	ix.Target = "proj_v1"
+	ix.Concurrency = concurrency.Settings{FileWorkers: 1, EmbedWorkers: 1, BatchSize: 1}
+	return ix
+}
+
+// chunkSize splits the test files into four-character chunks.
+const chunkSize = 4
+
+func TestIndexerResume(t *testing.T) {
+	fake, rdb := newFakeRedis(t)
+	dir := writeFiles(t, map[string]string{"a.go": "aaaa", "b.go": "bbbbwait", "c.go": "cccc"})
+	abs := func(names ...string) []string {
+		for n, name := range names {
+			names[n] = filepath.Join(dir, name)
+		}
+		return names
+	}
+
+	// The run is cancelled while the second chunk of b.go is being embedded
+	reached, release := make(chan struct{}), make(chan struct{})
+	emb := &fakeEmbedder{check: func(text string) error {
+		if text == "wait" {
+			close(reached)
+			<-release
+		}
+		return nil
+	}}
+	ctx := context.Background()
+	runCtx, cancel := context.WithCancel(ctx)
+	ix := newSerialIndexer(rdb, newFakeEmbedder(t, emb), dir)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := ix.ReIndexDirectory(runCtx, dir, chunkSize, 0)
+		errc <- err
+	}()
+	<-reached
+	cancel()
+	close(release)
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted run returned %v", err)
+	}
+
+	// b.go had a chunk stored but not all of them, so only a.go is done
+	if got, want := fake.members("smartcli:checkpoint:proj_v1"), abs("a.go"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("checkpoint after the interruption: %v, want %v", got, want)
+	}
+	if st, err := re_indexer.LoadRunState(ctx, rdb, "proj"); err != nil || st.Status != re_indexer.RunInterrupted {
+		t.Fatalf("run state %+v, %v", st, err)
+	}
+
+	emb.setCheck(nil)
+	resumed := newSerialIndexer(rdb, newFakeEmbedder(t, emb), dir)
+	resumed.Resume = true
+	summary, err := resumed.ReIndexDirectory(ctx, dir, chunkSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.FilesSkipped != 1 || summary.ChunksStored != 3 {
+		t.Fatalf("resumed run skipped %d files and stored %d chunks, want 1 and 3", summary.FilesSkipped, summary.ChunksStored)
+	}
+	if got, want := emb.embedded(), []string{"aaaa", "bbbb", "wait", "bbbb", "wait", "cccc"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("embedded %q, want %q", got, want)
+	}
+	if got, want := fake.members("smartcli:checkpoint:proj_v1"), abs("a.go", "b.go", "c.go"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("checkpoint after resuming: %v, want %v", got, want)
+	}
+	if got, want := fake.keysWithPrefix("proj_v1:"), []string{"proj_v1:a.go:0", "proj_v1:b.go:0", "proj_v1:b.go:1", "proj_v1:c.go:0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("chunk keys %v, want %v", got, want)
+	}
+	if st, err := re_indexer.LoadRunState(ctx, rdb, "proj"); err != nil || st.Status != re_indexer.RunBuilt {
+		t.Fatalf("run state %+v, %v", st, err)
+	}
+
+	// A fresh run starts over
+	fresh := newSerialIndexer(rdb, newFakeEmbedder(t, emb), dir)
+	if summary, err := fresh.ReIndexDirectory(ctx, dir, chunkSize, 0); err != nil || summary.FilesSkipped != 0 {
+		t.Fatalf("fresh run skipped %d files, %v", summary.FilesSkipped, err)
+	}
+}
+
+func TestIndexerRetryFailed(t *testing.T) {
+	fake, rdb := newFakeRedis(t)
+	dir := writeFiles(t, map[string]string{"a.go": "aaaa", "b.go": "bbbbflak", "c.go": "cccc"})
+	emb := &fakeEmbedder{check: func(text string) error {
+		if text == "flak" {
+			return errors.New("quota exceeded")
+		}
+		return nil
+	}}
+	ctx := context.Background()
+	ix := newSerialIndexer(rdb, newFakeEmbedder(t, emb), dir)
+	summary, err := ix.ReIndexDirectory(ctx, dir, chunkSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ChunksStored != 3 || summary.ChunksFailed != 1 {
+		t.Fatalf("stored %d and failed %d chunks, want 3 and 1", summary.ChunksStored, summary.ChunksFailed)
+	}
+
+	// A file whose failed chunks are queued counts as done
+	if got := fake.members("smartcli:checkpoint:proj_v1"); len(got) != 3 {
+		t.Fatalf("checkpointed %v, want every file", got)
+	}
+	queue := fake.list("smartcli:failed:proj_v1")
+	if len(queue) != 1 {
+		t.Fatalf("retry queue %q, want one entry", queue)
+	}
+	var job struct {
+		File  string `json:"file"`
+		Chunk int    `json:"chunk"`
+		Text  string `json:"text"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(queue[0]), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.File != filepath.Join(dir, "b.go") || job.Chunk != 1 || job.Text != "flak" || !strings.Contains(job.Error, "quota exceeded") {
+		t.Fatalf("queued %+v", job)
+	}
+
+	// Chunks failing again go back on the queue, once
+	retry := newSerialIndexer(rdb, newFakeEmbedder(t, emb), dir)
+	if summary, err := retry.RetryFailed(ctx); err != nil || summary.ChunksFailed != 1 {
+		t.Fatalf("retry failed %d chunks, %v", summary.ChunksFailed, err)
+	}
+	if n, err := re_indexer.FailedCount(ctx, rdb, "proj_v1"); err != nil || n != 1 {
+		t.Fatalf("%d chunks queued after a failed retry, %v", n, err)
+	}
+
+	emb.setCheck(nil)
+	retry = newSerialIndexer(rdb, newFakeEmbedder(t, emb), dir)
+	if summary, err := retry.RetryFailed(ctx); err != nil || summary.ChunksStored != 1 {
+		t.Fatalf("retry stored %d chunks, %v", summary.ChunksStored, err)
+	}
+	if n, err := re_indexer.FailedCount(ctx, rdb, "proj_v1"); err != nil || n != 0 {
+		t.Fatalf("%d chunks queued after a successful retry, %v", n, err)
+	}
+	if h := fake.hash("proj_v1:b.go:1"); h["text"] != "flak" || h["chunk"] != "1" {
+		t.Fatalf("retried chunk stored as %v", h)
+	}
+}
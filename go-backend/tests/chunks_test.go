@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"strconv"
+
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/re_indexer"
+)
+
+// vectorHit is a vector search hit with cosine distance score and rank in
+// its own search.
+func vectorHit(key string, score float64, rank int) chunk_retriever.Chunk {
+	return chunk_retriever.Chunk{Key: key, Score: score, VectorRank: rank}
+}
+
+// textHit is a full-text hit with BM25 score and rank in its own search.
+func textHit(key string, score float64, rank int) chunk_retriever.Chunk {
+	return chunk_retriever.Chunk{Key: key, TextScore: score, TextRank: rank}
+}
+
+// vecChunk is a chunk with a stored vector.
+func vecChunk(key string, vec ...float32) chunk_retriever.Chunk {
+	return chunk_retriever.Chunk{Key: key, Embedding: vec}
+}
+
+// fileChunk returns chunk n of file in index as the indexer keys and tags
+// it, with vector vec.
+func fileChunk(index, file string, n int, text string, vec ...float32) chunk_retriever.Chunk {
+	return chunk_retriever.Chunk{
+		Key:       re_indexer.ChunkKey(index, file, n),
+		Text:      text,
+		Embedding: vec,
+		Metadata:  map[string]string{"file": file, "chunk": strconv.Itoa(n)},
+	}
+}
+
+// textChunks returns chunks keyed "0", "1", ... holding texts, in retrieval
+// order.
+func textChunks(texts ...string) []chunk_retriever.Chunk {
+	chunks := make([]chunk_retriever.Chunk, len(texts))
+	for i, text := range texts {
+		chunks[i] = chunk_retriever.Chunk{Key: string(rune('0' + i)), Text: text}
+	}
+	return chunks
+}
+
+// chunkKeys returns the keys of chunks, in order.
+func chunkKeys(chunks []chunk_retriever.Chunk) []string {
+	out := make([]string, 0, len(chunks))
+	for _, ch := range chunks {
+		out = append(out, ch.Key)
+	}
+	return out
+}
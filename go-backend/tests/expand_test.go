@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"smart-cli/go-backend/generator"
+)
+
+func TestDedupeQueries(t *testing.T) {
+	const question = "How are embeddings cached?"
+	tests := []struct {
+		name    string
+		queries []string
+		n       int
+		want    []string
+	}{
+		{name: "distinct", queries: []string{"cachedEmbeddings", "embedding cache"}, n: 3, want: []string{"cachedEmbeddings", "embedding cache"}},
+		{name: "question repeated", queries: []string{" how are embeddings cached? ", "embedding cache"}, n: 3, want: []string{"embedding cache"}},
+		{name: "repeats differing in case", queries: []string{"Embedding cache", "embedding CACHE", "cache key"}, n: 3, want: []string{"Embedding cache", "cache key"}},
+		{name: "blanks dropped", queries: []string{"", "  ", "cache key"}, n: 3, want: []string{"cache key"}},
+		{name: "trimmed", queries: []string{"\tcache key\n"}, n: 3, want: []string{"cache key"}},
+		{name: "capped after dedupe", queries: []string{"a", "A", "b", "c"}, n: 2, want: []string{"a", "b"}},
+		{name: "none", queries: nil, n: 3, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generator.DedupeQueries(question, tt.queries, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	aiplatform "cloud.google.com/go/aiplatform/apiv1"
+	"cloud.google.com/go/aiplatform/apiv1/aiplatformpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"smart-cli/go-backend/embedder"
+)
+
+// fakeEmbedder is a prediction service that embeds a text as {len, 1}. check,
+// when set, runs first and fails the call with its error; it may also block.
+type fakeEmbedder struct {
+	aiplatformpb.UnimplementedPredictionServiceServer
+
+	mu    sync.Mutex
+	texts []string
+	check func(text string) error
+}
+
+// newFakeEmbedder serves f and returns an Embedder calling it.
+func newFakeEmbedder(t *testing.T, f *fakeEmbedder) *embedder.Embedder {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	aiplatformpb.RegisterPredictionServiceServer(srv, f)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	ctx := context.Background()
+	client, err := aiplatform.NewPredictionClient(ctx,
+		option.WithEndpoint(ln.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &embedder.Embedder{Client: client, Ctx: ctx, ModelEndpoint: "fake", Model: "fake-model"}
+}
+
+// embedded returns the texts embedded so far, in call order.
+func (f *fakeEmbedder) embedded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.texts...)
+}
+
+// setCheck replaces check between runs.
+func (f *fakeEmbedder) setCheck(check func(text string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.check = check
+}
+
+func (f *fakeEmbedder) Predict(ctx context.Context, req *aiplatformpb.PredictRequest) (*aiplatformpb.PredictResponse, error) {
+	text := req.Instances[0].GetStructValue().Fields["content"].GetStringValue()
+	f.mu.Lock()
+	check := f.check
+	f.mu.Unlock()
+	if check != nil {
+		if err := check(text); err != nil {
+			return nil, err
+		}
+	}
+	f.mu.Lock()
+	f.texts = append(f.texts, text)
+	f.mu.Unlock()
+
+	pred, err := structpb.NewValue(map[string]any{
+		"embeddings": map[string]any{"values": []any{float64(len(text)), 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &aiplatformpb.PredictResponse{Predictions: []*structpb.Value{pred}}, nil
+}
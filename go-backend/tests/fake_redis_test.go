@@ -0,0 +1,464 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is an in-memory server speaking enough RESP2 for the indexer and
+// index management: hashes, sets, lists, key moves and the FT.* commands
+// that create, describe, alias and drop indexes. Searching is not supported.
+type fakeRedis struct {
+	mu sync.Mutex
+	// keys holds map[string]string hashes, map[string]bool sets and
+	// []string lists
+	keys    map[string]any
+	indexes map[string]*fakeIndex
+	aliases map[string]string
+	// reject, when set, returns the error a command fails with, or ""
+	reject func(args []string) string
+}
+
+// fakeIndex is an index made by FT.CREATE.
+type fakeIndex struct {
+	prefix string
+	dim    int
+}
+
+// newFakeRedis starts a fake server and returns it with a client connected
+// to it.
+func newFakeRedis(t *testing.T) (*fakeRedis, redis.UniversalClient) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{keys: map[string]any{}, indexes: map[string]*fakeIndex{}, aliases: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	rdb := redis.NewClient(&redis.Options{Addr: ln.Addr().String()})
+	t.Cleanup(func() {
+		rdb.Close()
+		ln.Close()
+	})
+	return f, rdb
+}
+
+// setReject makes commands fail with the error fn returns for them.
+func (f *fakeRedis) setReject(fn func(args []string) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reject = fn
+}
+
+// hash returns the fields of the hash at key, or nil.
+func (f *fakeRedis) hash(key string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h, _ := f.keys[key].(map[string]string)
+	return h
+}
+
+// members returns the sorted members of the set at key.
+func (f *fakeRedis) members(key string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, _ := f.keys[key].(map[string]bool)
+	out := []string{}
+	for m := range s {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// list returns the list at key.
+func (f *fakeRedis) list(key string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, _ := f.keys[key].([]string)
+	return append([]string(nil), l...)
+}
+
+// keysWithPrefix returns the sorted keys starting with prefix.
+func (f *fakeRedis) keysWithPrefix(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for k := range f.keys {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	var queued [][]string
+	inMulti := false
+	for {
+		args, err := readArgs(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+		switch {
+		case name == "MULTI":
+			inMulti, queued = true, nil
+			writeReply(w, fakeStatus("OK"))
+		case name == "EXEC":
+			replies := make([]any, len(queued))
+			for n, q := range queued {
+				replies[n] = f.do(q)
+			}
+			inMulti = false
+			writeReply(w, replies)
+		case inMulti:
+			queued = append(queued, args)
+			writeReply(w, fakeStatus("QUEUED"))
+		default:
+			writeReply(w, f.do(args))
+		}
+		// Replies to a pipeline are flushed once its commands are read
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// fakeStatus and fakeErr are status and error replies; plain strings are
+// bulk strings and nil is the null reply.
+type (
+	fakeStatus string
+	fakeErr    string
+)
+
+// do runs one command and returns its reply.
+func (f *fakeRedis) do(args []string) any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reject != nil {
+		if msg := f.reject(args); msg != "" {
+			return fakeErr(msg)
+		}
+	}
+	name, args := strings.ToUpper(args[0]), args[1:]
+	switch name {
+	case "HELLO":
+		return fakeErr("ERR unknown command 'HELLO'")
+	case "PING":
+		return fakeStatus("PONG")
+	case "CLIENT", "SELECT":
+		return fakeStatus("OK")
+
+	case "HSET":
+		h, ok := f.keys[args[0]].(map[string]string)
+		if !ok {
+			h = map[string]string{}
+			f.keys[args[0]] = h
+		}
+		added := 0
+		for i := 1; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				added++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return added
+	case "HGET":
+		h, _ := f.keys[args[0]].(map[string]string)
+		if v, ok := h[args[1]]; ok {
+			return v
+		}
+		return nil
+	case "HDEL":
+		h, _ := f.keys[args[0]].(map[string]string)
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := h[k]; ok {
+				delete(h, k)
+				n++
+			}
+		}
+		if h != nil && len(h) == 0 {
+			delete(f.keys, args[0])
+		}
+		return n
+	case "HGETALL":
+		h, _ := f.keys[args[0]].(map[string]string)
+		fields := make([]string, 0, len(h))
+		for k := range h {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		out := []any{}
+		for _, k := range fields {
+			out = append(out, k, h[k])
+		}
+		return out
+	case "SADD":
+		s, ok := f.keys[args[0]].(map[string]bool)
+		if !ok {
+			s = map[string]bool{}
+			f.keys[args[0]] = s
+		}
+		added := 0
+		for _, m := range args[1:] {
+			if !s[m] {
+				s[m] = true
+				added++
+			}
+		}
+		return added
+	case "SMEMBERS":
+		s, _ := f.keys[args[0]].(map[string]bool)
+		out := []any{}
+		for m := range s {
+			out = append(out, m)
+		}
+		return out
+	case "RPUSH":
+		l, _ := f.keys[args[0]].([]string)
+		l = append(l, args[1:]...)
+		f.keys[args[0]] = l
+		return len(l)
+	case "LLEN":
+		l, _ := f.keys[args[0]].([]string)
+		return len(l)
+	case "LRANGE", "LTRIM":
+		l, _ := f.keys[args[0]].([]string)
+		start, _ := strconv.Atoi(args[1])
+		stop, _ := strconv.Atoi(args[2])
+		if start < 0 {
+			start = max(len(l)+start, 0)
+		}
+		if stop < 0 {
+			stop += len(l)
+		}
+		stop = min(stop, len(l)-1)
+		var sub []string
+		if start <= stop {
+			sub = l[start : stop+1]
+		}
+		if name == "LTRIM" {
+			if len(sub) == 0 {
+				delete(f.keys, args[0])
+			} else {
+				f.keys[args[0]] = append([]string(nil), sub...)
+			}
+			return fakeStatus("OK")
+		}
+		out := []any{}
+		for _, v := range sub {
+			out = append(out, v)
+		}
+		return out
+
+	case "DEL", "UNLINK", "EXISTS":
+		n := 0
+		for _, k := range args {
+			if _, ok := f.keys[k]; ok {
+				n++
+				if name != "EXISTS" {
+					delete(f.keys, k)
+				}
+			}
+		}
+		return n
+	case "RENAME", "RENAMENX":
+		v, ok := f.keys[args[0]]
+		if !ok {
+			return fakeErr("ERR no such key")
+		}
+		if _, taken := f.keys[args[1]]; taken && name == "RENAMENX" {
+			return 0
+		}
+		delete(f.keys, args[0])
+		f.keys[args[1]] = v
+		if name == "RENAMENX" {
+			return 1
+		}
+		return fakeStatus("OK")
+	case "SCAN":
+		// Every match in one pass; only "<prefix>*" patterns are used
+		var prefix string
+		for i := 1; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				prefix = unescapeGlob(strings.TrimSuffix(args[i+1], "*"))
+			}
+		}
+		keys := []any{}
+		for k := range f.keys {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		return []any{"0", keys}
+
+	case "FT._LIST":
+		out := []any{}
+		for name := range f.indexes {
+			out = append(out, name)
+		}
+		return out
+	case "FT.CREATE":
+		if _, ok := f.indexes[args[0]]; ok {
+			return fakeErr("Index already exists")
+		}
+		ix := &fakeIndex{}
+		for i := 1; i+1 < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "PREFIX":
+				ix.prefix = args[i+2]
+			case "DIM":
+				ix.dim, _ = strconv.Atoi(args[i+1])
+			}
+		}
+		f.indexes[args[0]] = ix
+		return fakeStatus("OK")
+	case "FT.INFO":
+		target := args[0]
+		if to, ok := f.aliases[target]; ok {
+			target = to
+		}
+		ix, ok := f.indexes[target]
+		if !ok {
+			return fakeErr("Unknown index name")
+		}
+		docs := 0
+		for k := range f.keys {
+			if _, hash := f.keys[k].(map[string]string); hash && strings.HasPrefix(k, ix.prefix) {
+				docs++
+			}
+		}
+		return []any{
+			"index_name", target,
+			"index_definition", []any{"key_type", "HASH", "prefixes", []any{ix.prefix}},
+			"attributes", []any{
+				[]any{"identifier", "text", "attribute", "text", "type", "TEXT"},
+				[]any{"identifier", "embedding", "attribute", "embedding", "type", "VECTOR",
+					"algorithm", "HNSW", "dim", strconv.Itoa(ix.dim), "distance_metric", "COSINE"},
+			},
+			"num_docs", strconv.Itoa(docs),
+		}
+	case "FT.ALIASADD", "FT.ALIASUPDATE":
+		if _, ok := f.indexes[args[1]]; !ok {
+			return fakeErr("Unknown index name")
+		}
+		if _, ok := f.aliases[args[0]]; ok && name == "FT.ALIASADD" {
+			return fakeErr("Alias already exists")
+		}
+		f.aliases[args[0]] = args[1]
+		return fakeStatus("OK")
+	case "FT.ALIASDEL":
+		if _, ok := f.aliases[args[0]]; !ok {
+			return fakeErr("Alias does not exist")
+		}
+		delete(f.aliases, args[0])
+		return fakeStatus("OK")
+	case "FT.DROPINDEX":
+		ix, ok := f.indexes[args[0]]
+		if !ok {
+			return fakeErr("Unknown index name")
+		}
+		delete(f.indexes, args[0])
+		for alias, to := range f.aliases {
+			if to == args[0] {
+				delete(f.aliases, alias)
+			}
+		}
+		if len(args) > 1 && strings.EqualFold(args[1], "DD") {
+			for k := range f.keys {
+				if strings.HasPrefix(k, ix.prefix) {
+					delete(f.keys, k)
+				}
+			}
+		}
+		return fakeStatus("OK")
+	}
+	return fakeErr(fmt.Sprintf("ERR unknown command '%s'", name))
+}
+
+// unescapeGlob undoes the backslash escapes of a SCAN MATCH pattern.
+func unescapeGlob(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// readArgs reads one RESP command, whose arguments may hold any bytes.
+func readArgs(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2) // with the trailing \r\n
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// writeReply encodes a reply returned by do.
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case fakeStatus:
+		w.WriteString("+" + string(v) + "\r\n")
+	case fakeErr:
+		w.WriteString("-" + string(v) + "\r\n")
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/file_policy"
+)
+
+func TestPolicyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/tool/main.go", true},
+		{"*_test.go", "pkg/a_test.go", true},
+		{"*_test.go", "pkg/a.go", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"docs/**/*.md", "docs/a.md", true},
+		{"docs/**/*.md", "docs/sub/deep/a.md", true},
+		{"**/testdata/**", "a/testdata/x/y.json", true},
+		{"**/testdata/**", "testdata/y.json", true},
+		{"**/testdata/**", "a/testdata", true},
+		{"internal/", "internal", true},
+		{"./cmd/*.go", "cmd/a.go", true},
+		{"cmd/*.go", "./cmd/a.go", true},
+		{"generated", "pkg/generated", true},
+		{"", "a.go", false},
+		{"pkg/*.go", "other/pkg/a.go", false},
+	}
+	for _, tt := range tests {
+		if got := file_policy.Match(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyWalk(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.go":                 "package main",
+		"README.md":               "# readme",
+		"image.png":               "not text",
+		".env.json":               "{}",
+		"pkg/a.go":                "package pkg",
+		"pkg/a_test.go":           "package pkg",
+		"pkg/gen/z.go":            "package gen",
+		"docs/guide/intro.md":     "intro",
+		".github/ci.yaml":         "on: push",
+		"node_modules/x/index.js": "module.exports = {}",
+		"vendor/dep/dep.go":       "package dep",
+		"build/out.js":            "built",
+		"bin/tool.go":             "package main",
+		"out/report.json":         "{}",
+		"dist/app.js":             "bundled",
+		"target/app.java":         "class App {}",
+		"big.txt":                 strings.Repeat("x", 2048),
+	})
+	tests := []struct {
+		name string
+		cfg  file_policy.Config
+		want []string
+	}{
+		{
+			// Build output, dependencies and dot-directories are skipped by
+			// default: they are generated or third-party, not the project's
+			// own code
+			name: "defaults",
+			want: []string{"README.md", "big.txt", "docs/guide/intro.md", "main.go", "pkg/a.go", "pkg/a_test.go", "pkg/gen/z.go"},
+		},
+		{
+			name: "include",
+			cfg:  file_policy.Config{Include: []string{"pkg/**"}},
+			want: []string{"pkg/a.go", "pkg/a_test.go", "pkg/gen/z.go"},
+		},
+		{
+			name: "exclude files",
+			cfg:  file_policy.Config{Exclude: []string{"*_test.go", "*.md"}},
+			want: []string{"big.txt", "main.go", "pkg/a.go", "pkg/gen/z.go"},
+		},
+		{
+			name: "exclude a directory",
+			cfg:  file_policy.Config{Exclude: []string{"pkg/gen"}},
+			want: []string{"README.md", "big.txt", "docs/guide/intro.md", "main.go", "pkg/a.go", "pkg/a_test.go"},
+		},
+		{
+			name: "include and exclude",
+			cfg:  file_policy.Config{Include: []string{"**/*.go"}, Exclude: []string{"gen"}},
+			want: []string{"main.go", "pkg/a.go", "pkg/a_test.go"},
+		},
+		{
+			name: "more skipped directories",
+			cfg:  file_policy.Config{SkipDirs: []string{"docs", "pkg"}},
+			want: []string{"README.md", "big.txt", "main.go"},
+		},
+		{
+			name: "dotfiles",
+			cfg:  file_policy.Config{IncludeDotfiles: true, Include: []string{".*", ".*/**"}},
+			want: []string{".env.json", ".github/ci.yaml"},
+		},
+		{
+			name: "size limit",
+			cfg:  file_policy.Config{MaxFileSize: 1024, Include: []string{"*.txt"}},
+			want: []string{},
+		},
+		{
+			name: "language disabled",
+			cfg:  file_policy.Config{Languages: map[string][]string{"markdown": {}, "text": {}}},
+			want: []string{"main.go", "pkg/a.go", "pkg/a_test.go", "pkg/gen/z.go"},
+		},
+		{
+			name: "language added",
+			cfg:  file_policy.Config{Languages: map[string][]string{"image": {"PNG"}}, Include: []string{"*.png"}},
+			want: []string{"image.png"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			err := file_policy.New(tt.cfg).Walk(dir, func(path string) error {
+				rel, _ := filepath.Rel(dir, path)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyWalkSymlinks(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"src/a.go": "package src"})
+	if err := os.Symlink(filepath.Join(dir, "src"), filepath.Join(dir, "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	// A link back up would loop forever if directories were revisited
+	if err := os.Symlink(dir, filepath.Join(dir, "src", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		follow bool
+		want   []string
+	}{
+		{name: "skipped", want: []string{"src/a.go"}},
+		{name: "followed once", follow: true, want: []string{"link/a.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			err := file_policy.New(file_policy.Config{FollowSymlinks: tt.follow}).Walk(dir, func(path string) error {
+				rel, _ := filepath.Rel(dir, path)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
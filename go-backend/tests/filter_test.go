@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"testing"
+
+	"smart-cli/go-backend/chunk_retriever"
+)
+
+func TestFilterString(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter chunk_retriever.Filter
+		want   string
+	}{
+		{name: "one value", filter: chunk_retriever.TagFilter("module", "core"), want: "@module:{core}"},
+		{name: "any of", filter: chunk_retriever.TagFilter("module", "core", "api"), want: "@module:{core | api}"},
+		{name: "excluded", filter: chunk_retriever.TagFilter("module", "core").Not(), want: "-@module:{core}"},
+		{name: "not twice", filter: chunk_retriever.TagFilter("module", "core").Not().Not(), want: "@module:{core}"},
+		{
+			name:   "path escaped",
+			filter: chunk_retriever.TagFilter("file", "/src/my app/main.go"),
+			want:   `@file:{\/src\/my\ app\/main\.go}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.String(); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeTag(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"core", "core"},
+		{"", ""},
+		{"a-b", `a\-b`},
+		{"a|b", `a\|b`},
+		{"{x}", `\{x\}`},
+		{`C:\src`, `C\:\\src`},
+		{"user@host:1", `user\@host\:1`},
+		{"naïve_name", "naïve_name"},
+	}
+	for _, tt := range tests {
+		if got := chunk_retriever.EscapeTag(tt.in); got != tt.want {
+			t.Errorf("EscapeTag(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	core := chunk_retriever.TagFilter("module", "core", "api")
+	tests := []struct {
+		name     string
+		filter   chunk_retriever.Filter
+		metadata map[string]string
+		want     bool
+	}{
+		{name: "value listed", filter: core, metadata: map[string]string{"module": "api"}, want: true},
+		{name: "value not listed", filter: core, metadata: map[string]string{"module": "web"}},
+		{name: "field missing", filter: core, metadata: map[string]string{"file": "a.go"}},
+		{name: "excluded value", filter: core.Not(), metadata: map[string]string{"module": "core"}},
+		{name: "excluded other value", filter: core.Not(), metadata: map[string]string{"module": "web"}, want: true},
+		{name: "excluded field missing", filter: core.Not(), metadata: nil, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.metadata); got != tt.want {
+				t.Fatalf("Match(%v) = %v, want %v", tt.metadata, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/git_history"
+)
+
+// gitRepo creates a repository with a history touching added, modified,
+// renamed, deleted and binary files, and a merge commit.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Dev")
+	t.Setenv("GIT_AUTHOR_EMAIL", "dev@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Dev")
+	t.Setenv("GIT_COMMITTER_EMAIL", "dev@example.com")
+	t.Setenv("TZ", "UTC")
+
+	dir := t.TempDir()
+	// Each command runs a day later, so the log order is well defined
+	day := 0
+	git := func(args ...string) {
+		t.Helper()
+		day++
+		date := fmt.Sprintf("2025-01-%02dT03:04:05Z", day)
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name, text string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	write("a.go", "package a\n")
+	write("old.go", "package a\n\nfunc Old() {}\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "Add a and old")
+
+	write("a.go", "package a\n\nfunc A() {}\n")
+	write("logo.png", "\x89PNG\x00\x01")
+	git("add", "-A")
+	git("commit", "-q", "-m", "Add A and a logo", "-m", "The logo is binary.")
+
+	git("mv", "old.go", "renamed.go")
+	git("commit", "-q", "-m", "Rename old")
+
+	git("checkout", "-q", "-b", "side")
+	git("rm", "-q", "renamed.go")
+	git("commit", "-q", "-m", "Remove renamed")
+	git("checkout", "-q", "main")
+	git("merge", "-q", "--no-ff", "-m", "Merge side", "side")
+	return dir
+}
+
+func TestGitLog(t *testing.T) {
+	dir := gitRepo(t)
+	commits, err := git_history.Log(context.Background(), dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type file struct {
+		Path     string
+		HasHunks bool
+	}
+	type commit struct {
+		Subject, Body string
+		Files         []file
+	}
+	var got []commit
+	for _, c := range commits {
+		if len(c.SHA) != 40 || c.Author != "Dev" || c.Email != "dev@example.com" || !strings.HasPrefix(c.Date, "2025-01-") {
+			t.Fatalf("commit header %+v", c)
+		}
+		cc := commit{Subject: c.Subject, Body: c.Body}
+		for _, f := range c.Files {
+			cc.Files = append(cc.Files, file{Path: f.Path, HasHunks: f.Hunks != ""})
+		}
+		got = append(got, cc)
+	}
+	// Newest first, without the merge; binary changes and pure renames have
+	// no hunks
+	want := []commit{
+		{Subject: "Remove renamed", Files: []file{{Path: "renamed.go", HasHunks: true}}},
+		{Subject: "Rename old", Files: []file{{Path: "renamed.go"}}},
+		{Subject: "Add A and a logo", Body: "The logo is binary.", Files: []file{{Path: "a.go", HasHunks: true}, {Path: "logo.png"}}},
+		{Subject: "Add a and old", Files: []file{{Path: "a.go", HasHunks: true}, {Path: "old.go", HasHunks: true}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+	if hunks := commits[2].Files[0].Hunks; !strings.HasPrefix(hunks, "@@ ") || !strings.Contains(hunks, "+func A() {}") {
+		t.Fatalf("hunks of a.go: %q", hunks)
+	}
+
+	limited, err := git_history.Log(context.Background(), dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited) != 2 || limited[1].Subject != "Rename old" {
+		t.Fatalf("limited log %+v", limited)
+	}
+
+	if _, err := git_history.Log(context.Background(), t.TempDir(), 0); err == nil {
+		t.Fatal("log outside a repository succeeded")
+	}
+}
+
+func TestGitDocuments(t *testing.T) {
+	commits := []git_history.Commit{{
+		SHA:     "abc123",
+		Author:  "Dev",
+		Email:   "dev@example.com",
+		Date:    "2025-01-02T03:04:05Z",
+		Subject: "Fix the cache",
+		Body:    "Keys were not hashed.",
+		Files: []git_history.FileDiff{
+			{Path: "cache.go", Hunks: "@@ -1 +1 @@\n-old\n+new"},
+			{Path: "vendor/dep.go", Hunks: "@@ -1 +1 @@\n-a\n+b"},
+			{Path: "logo.png"},
+		},
+	}}
+	tests := []struct {
+		name  string
+		allow func(path string, size int64) bool
+		want  []string
+	}{
+		{name: "all", want: []string{"abc123", "abc123/cache.go", "abc123/vendor/dep.go"}},
+		{
+			name:  "filtered",
+			allow: func(path string, size int64) bool { return !strings.HasPrefix(path, "vendor/") },
+			want:  []string{"abc123", "abc123/cache.go"},
+		},
+		{
+			name:  "too large",
+			allow: func(path string, size int64) bool { return size < 10 },
+			want:  []string{"abc123"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := git_history.Documents(commits, tt.allow)
+			var ids []string
+			for _, d := range docs {
+				ids = append(ids, d.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Fatalf("documents %v, want %v", ids, tt.want)
+			}
+
+			msg := docs[0]
+			wantMsg := "commit abc123\nAuthor: Dev <dev@example.com>\nDate: 2025-01-02T03:04:05Z\n\nFix the cache\n\nKeys were not hashed.\n\nFiles changed: cache.go, vendor/dep.go, logo.png\n"
+			if msg.Text != wantMsg || msg.Fields["file"] != "" || msg.Fields["commit"] != "abc123" {
+				t.Fatalf("message document %q with fields %v", msg.Text, msg.Fields)
+			}
+			if len(docs) > 1 {
+				diff := docs[1]
+				if diff.Fields["file"] != "cache.go" || diff.Fields["subject"] != "Fix the cache" || !strings.HasSuffix(diff.Text, "File: cache.go\n\n@@ -1 +1 @@\n-old\n+new") {
+					t.Fatalf("diff document %q with fields %v", diff.Text, diff.Fields)
+				}
+			}
+		})
+	}
+}
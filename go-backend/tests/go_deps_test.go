@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"smart-cli/go-backend/go_deps"
+)
+
+func TestResolveGoMod(t *testing.T) {
+	cache := t.TempDir()
+	for _, dir := range []string{
+		"github.com/!burnt!sushi/toml@v1.4.0",
+		"github.com/redis/go-redis/v9@v9.12.1",
+		"github.com/someone/forked@v1.0.1",
+		"example.com/pinned@v1.2.1",
+		"golang.org/x/sync@v0.16.0",
+	} {
+		if err := os.MkdirAll(filepath.Join(cache, filepath.FromSlash(dir)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gomod := filepath.Join("testdata", "deps", "app", "go.mod")
+	local := filepath.Join("testdata", "deps", "local")
+	inCache := func(dir string) string { return filepath.Join(cache, filepath.FromSlash(dir)) }
+
+	tests := []struct {
+		name        string
+		indirect    bool
+		wantFound   []go_deps.Module
+		wantMissing []string
+	}{
+		{
+			name: "direct",
+			wantFound: []go_deps.Module{
+				{Path: "github.com/BurntSushi/toml", Version: "v1.4.0", Dir: inCache("github.com/!burnt!sushi/toml@v1.4.0")},
+				{Path: "github.com/redis/go-redis/v9", Version: "v9.12.1", Dir: inCache("github.com/redis/go-redis/v9@v9.12.1")},
+				{Path: "github.com/someone/forked", Version: "v1.0.1", Dir: inCache("github.com/someone/forked@v1.0.1")},
+				{Path: "example.com/local", Version: "v0.0.0-00010101000000-000000000000", Dir: local},
+				{Path: "example.com/pinned", Version: "v1.2.1", Dir: inCache("example.com/pinned@v1.2.1")},
+			},
+			wantMissing: []string{"example.com/missing@v1.0.0"},
+		},
+		{
+			name:     "with indirect",
+			indirect: true,
+			wantFound: []go_deps.Module{
+				{Path: "github.com/BurntSushi/toml", Version: "v1.4.0", Dir: inCache("github.com/!burnt!sushi/toml@v1.4.0")},
+				{Path: "github.com/redis/go-redis/v9", Version: "v9.12.1", Dir: inCache("github.com/redis/go-redis/v9@v9.12.1")},
+				{Path: "github.com/someone/forked", Version: "v1.0.1", Dir: inCache("github.com/someone/forked@v1.0.1")},
+				{Path: "example.com/local", Version: "v0.0.0-00010101000000-000000000000", Dir: local},
+				{Path: "example.com/pinned", Version: "v1.2.1", Dir: inCache("example.com/pinned@v1.2.1")},
+				{Path: "golang.org/x/sync", Version: "v0.16.0", Indirect: true, Dir: inCache("golang.org/x/sync@v0.16.0")},
+			},
+			wantMissing: []string{"example.com/missing@v1.0.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, missing, err := go_deps.Resolve(gomod, cache, tt.indirect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(found, tt.wantFound) {
+				t.Fatalf("found %+v\nwant %+v", found, tt.wantFound)
+			}
+			var ids []string
+			for _, m := range missing {
+				ids = append(ids, m.ID())
+			}
+			if !reflect.DeepEqual(ids, tt.wantMissing) {
+				t.Fatalf("missing %v, want %v", ids, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestResolveGoModErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		gomod string
+	}{
+		{name: "unknown directive", gomod: "module example.com/app\n\nrequire (\n\texample.com/a\n)\n"},
+		{name: "replace without a target", gomod: "module example.com/app\n\nreplace example.com/a =>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"go.mod": tt.gomod})
+			if _, _, err := go_deps.Resolve(filepath.Join(dir, "go.mod"), t.TempDir(), true); err == nil {
+				t.Fatal("malformed go.mod accepted")
+			}
+		})
+	}
+	if _, _, err := go_deps.Resolve(filepath.Join(t.TempDir(), "go.mod"), t.TempDir(), true); !os.IsNotExist(err) {
+		t.Fatalf("error %v for a missing go.mod", err)
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"github.com/redis/go-redis/v9", "github.com/redis/go-redis/v9"},
+		{"github.com/BurntSushi/toml", "github.com/!burnt!sushi/toml"},
+		{"github.com/Azure/azure-sdk-for-go", "github.com/!azure/azure-sdk-for-go"},
+		{"v1.0.0-RC1", "v1.0.0-!r!c1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := go_deps.EscapePath(tt.in); got != tt.want {
+			t.Errorf("EscapePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExportedAPI(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "bodies and unexported names dropped",
+			src: `// Package cache stores values.
+package cache
+
+import "sync"
+
+// Cache is a concurrent map.
+type Cache struct {
+	mu   sync.Mutex
+	Size int // entries
+}
+
+type entry struct{ v string }
+
+// Get returns the value at key.
+func (c *Cache) Get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ""
+}
+
+func (e entry) String() string { return e.v }
+
+func helper() {}
+
+// Limits of a cache.
+const (
+	MaxSize = 10 // most entries
+	minSize = 1
+)
+`,
+			want: `// Package cache stores values.
+package cache
+
+// Cache is a concurrent map.
+type Cache struct {
+	Size int // entries
+	// contains filtered or unexported fields
+}
+
+// Get returns the value at key.
+func (c *Cache) Get(key string) string
+
+// Limits of a cache.
+const (
+	MaxSize = 10
+)
+`,
+		},
+		{
+			name: "generic receiver",
+			src: `package list
+
+type List[T any] struct{ items []T }
+
+func (l *List[T]) Len() int { return len(l.items) }
+`,
+			want: `package list
+
+type List[T any] struct {
+	// contains filtered or unexported fields
+}
+
+func (l *List[T]) Len() int
+`,
+		},
+		{
+			name: "nothing exported",
+			src:  "package internal\n\nfunc run() {}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"api.go": tt.src})
+			got, err := go_deps.ExportedAPI(filepath.Join(dir, "api.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
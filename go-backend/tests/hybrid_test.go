@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"smart-cli/go-backend/chunk_retriever"
+)
+
+func TestTextQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "words", text: "How does the retriever fuse results?", want: "@text:(how | does | the | retriever | fuse | results)"},
+		{name: "identifiers kept whole", text: "storeChunk or chunk_retriever", want: "@text:(storechunk | or | chunk_retriever)"},
+		{name: "duplicates and short words dropped", text: "a Redis redis REDIS x", want: "@text:(redis)"},
+		{name: "field syntax", text: "@file:{main.go} @text:(x)", want: "@text:(file | main | go | text)"},
+		{name: "operators", text: `-foo | "bar" ~baz* %qux% (a|b)`, want: "@text:(foo | bar | baz | qux)"},
+		{name: "braces and escapes", text: `map[string]any{} \n $ref`, want: "@text:(map | string | any | ref)"},
+		{name: "unicode letters", text: "größe über", want: "@text:(größe | über)"},
+		{name: "nothing to search", text: "? * - | !", want: ""},
+		{name: "empty", text: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunk_retriever.TextQuery(tt.text); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// rrf is the unweighted fused score of a chunk at ranks.
+func rrf(ranks ...int) float64 {
+	var s float64
+	for _, r := range ranks {
+		s += 1 / float64(chunk_retriever.RRFK+r)
+	}
+	return s
+}
+
+func TestFuse(t *testing.T) {
+	type fusedHit struct {
+		key                     string
+		vectorRank, textRank    int
+		score, textScore, fused float64
+	}
+	tests := []struct {
+		name         string
+		hits         []chunk_retriever.Chunk
+		vectorWeight float64
+		textWeight   float64
+		want         []fusedHit
+	}{
+		{
+			name:         "vector only",
+			hits:         []chunk_retriever.Chunk{vectorHit("a", 0.1, 1), vectorHit("b", 0.3, 2)},
+			vectorWeight: 1, textWeight: 1,
+			want: []fusedHit{
+				{key: "a", vectorRank: 1, score: 0.1, fused: rrf(1)},
+				{key: "b", vectorRank: 2, score: 0.3, fused: rrf(2)},
+			},
+		},
+		{
+			name: "found by both searches ranks first",
+			hits: []chunk_retriever.Chunk{
+				vectorHit("a", 0.1, 1), vectorHit("b", 0.2, 2),
+				textHit("b", 5, 1), textHit("c", 3, 2),
+			},
+			vectorWeight: 1, textWeight: 1,
+			want: []fusedHit{
+				{key: "b", vectorRank: 2, textRank: 1, score: 0.2, textScore: 5, fused: rrf(2, 1)},
+				{key: "a", vectorRank: 1, score: 0.1, fused: rrf(1)},
+				{key: "c", textRank: 2, textScore: 3, fused: rrf(2)},
+			},
+		},
+		{
+			name: "weights",
+			hits: []chunk_retriever.Chunk{
+				vectorHit("a", 0.1, 1),
+				textHit("c", 9, 1),
+			},
+			vectorWeight: 1, textWeight: 3,
+			want: []fusedHit{
+				{key: "c", textRank: 1, textScore: 9, fused: 3 * rrf(1)},
+				{key: "a", vectorRank: 1, score: 0.1, fused: rrf(1)},
+			},
+		},
+		{
+			// Each index ranks its own hits from 1; Fuse ranks them together
+			name: "hits of several indexes are re-ranked",
+			hits: []chunk_retriever.Chunk{
+				vectorHit("repo", 0.3, 1),
+				vectorHit("dep", 0.1, 1),
+			},
+			vectorWeight: 1, textWeight: 1,
+			want: []fusedHit{
+				{key: "dep", vectorRank: 1, score: 0.1, fused: rrf(1)},
+				{key: "repo", vectorRank: 2, score: 0.3, fused: rrf(2)},
+			},
+		},
+		{
+			name: "duplicates counted once",
+			hits: []chunk_retriever.Chunk{
+				vectorHit("a", 0.2, 1), vectorHit("a", 0.2, 1), vectorHit("b", 0.4, 2),
+				textHit("a", 4, 1), textHit("a", 4, 1),
+			},
+			vectorWeight: 1, textWeight: 1,
+			want: []fusedHit{
+				{key: "a", vectorRank: 1, textRank: 1, score: 0.2, textScore: 4, fused: rrf(1, 1)},
+				{key: "b", vectorRank: 2, score: 0.4, fused: rrf(2)},
+			},
+		},
+		{name: "no hits", vectorWeight: 1, textWeight: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []fusedHit
+			for _, c := range chunk_retriever.Fuse(tt.hits, tt.vectorWeight, tt.textWeight) {
+				got = append(got, fusedHit{
+					key: c.Key, vectorRank: c.VectorRank, textRank: c.TextRank,
+					score: c.Score, textScore: c.TextScore, fused: c.Fused,
+				})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				w, g := tt.want[i], got[i]
+				if math.Abs(g.fused-w.fused) > 1e-12 {
+					t.Fatalf("%s fused %v, want %v", g.key, g.fused, w.fused)
+				}
+				g.fused, w.fused = 0, 0
+				if !reflect.DeepEqual(g, w) {
+					t.Fatalf("got %+v, want %+v", g, w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/index_manager"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/re_indexer"
+)
+
+// seedIndex builds version of alias as the indexer would: one chunk per file
+// under root with a 2-dimensional vector, metadata, the alias and its run
+// state. alias may be empty for an index without one.
+func seedIndex(t *testing.T, rdb redis.UniversalClient, alias, version, root string, files ...string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := chunk_retriever.EnsureIndex(rdb, version, version+":", 2); err != nil {
+		t.Fatal(err)
+	}
+	for n, file := range files {
+		vec := make([]byte, 8)
+		binary.LittleEndian.PutUint32(vec, math.Float32bits(float32(n)))
+		binary.LittleEndian.PutUint32(vec[4:], math.Float32bits(1))
+		err := rdb.HSet(ctx, re_indexer.ChunkKey(version, file, 0), map[string]any{
+			"text":      "text of " + file,
+			"file":      filepath.Join(root, filepath.FromSlash(file)),
+			"chunk":     0,
+			"module":    "core",
+			"embedding": vec,
+		}).Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := index_meta.Save(ctx, rdb, version, &index_meta.Metadata{
+		Model: "fake-model", Dim: 2, Chunker: "chars", ChunkSize: 100, Root: root,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.SAdd(ctx, "smartcli:checkpoint:"+version, "done").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if alias == "" {
+		return
+	}
+	if err := rdb.Do(ctx, "FT.ALIASADD", alias, version).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := index_meta.SetAlias(ctx, rdb, alias, version); err != nil {
+		t.Fatal(err)
+	}
+	err = rdb.HSet(ctx, re_indexer.RunStateKey(alias), map[string]any{
+		"status": re_indexer.RunComplete, "root": root, "target": version,
+	}).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenameAlias(t *testing.T) {
+	fake, rdb := newFakeRedis(t)
+	ctx := context.Background()
+	seedIndex(t, rdb, "proj", "proj_v1", "/src/proj", "a.go")
+	// Left over from an earlier index called app
+	if err := rdb.HSet(ctx, re_indexer.RunStateKey("app"), "status", re_indexer.RunInterrupted).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := index_manager.Rename(ctx, rdb, "proj", "app"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := index_manager.GetInfo(ctx, rdb, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IndexName != "proj_v1" || info.Run == nil || info.Run.Status != re_indexer.RunComplete {
+		t.Fatalf("renamed alias: index %q, run %+v", info.IndexName, info.Run)
+	}
+	if fake.hash(re_indexer.RunStateKey("proj")) != nil {
+		t.Fatal("run state of the old alias left behind")
+	}
+	if _, err := index_manager.GetInfo(ctx, rdb, "proj"); err == nil {
+		t.Fatal("old alias still resolves")
+	}
+
+	// Renaming back finds no run state under app's old name to move
+	if err := rdb.Del(ctx, re_indexer.RunStateKey("app")).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdb.HSet(ctx, re_indexer.RunStateKey("proj"), "status", re_indexer.RunInterrupted).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index_manager.Rename(ctx, rdb, "app", "proj"); err != nil {
+		t.Fatal(err)
+	}
+	if st := fake.hash(re_indexer.RunStateKey("proj")); st != nil {
+		t.Fatalf("stale run state %v kept for the new name", st)
+	}
+}
+
+func TestRenameIndex(t *testing.T) {
+	fake, rdb := newFakeRedis(t)
+	ctx := context.Background()
+	seedIndex(t, rdb, "proj", "proj_v1", "/src/proj", "a.go", "dir/b.go")
+
+	moved, err := index_manager.Rename(ctx, rdb, "proj_v1", "proj_v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Fatalf("moved %d keys, want 2", moved)
+	}
+	if got, want := fake.keysWithPrefix("proj_v2:"), []string{"proj_v2:a.go:0", "proj_v2:dir/b.go:0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys %v, want %v", got, want)
+	}
+	if got := fake.keysWithPrefix("proj_v1:"); len(got) != 0 {
+		t.Fatalf("keys left under the old prefix: %v", got)
+	}
+	if got := fake.members("smartcli:checkpoint:proj_v2"); !reflect.DeepEqual(got, []string{"done"}) {
+		t.Fatalf("checkpoint not moved: %v", got)
+	}
+
+	info, err := index_manager.GetInfo(ctx, rdb, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IndexName != "proj_v2" || info.Meta == nil || info.Meta.Model != "fake-model" {
+		t.Fatalf("alias resolves to %q with metadata %+v", info.IndexName, info.Meta)
+	}
+	if info.Run == nil || info.Run.Target != "proj_v2" {
+		t.Fatalf("run state of the alias still targets %+v", info.Run)
+	}
+	if _, err := index_manager.GetInfo(ctx, rdb, "proj_v1"); err == nil {
+		t.Fatal("old index still exists")
+	}
+}
+
+func TestRenameRejects(t *testing.T) {
+	_, rdb := newFakeRedis(t)
+	ctx := context.Background()
+	seedIndex(t, rdb, "proj", "proj_v1", "/src/proj", "a.go")
+	seedIndex(t, rdb, "other", "other_v1", "/src/other", "a.go")
+
+	tests := []struct{ name, from, to string }{
+		{name: "same name", from: "proj", to: "proj"},
+		{name: "taken by an alias", from: "proj", to: "other"},
+		{name: "taken by an index", from: "proj_v1", to: "other_v1"},
+		{name: "missing", from: "nothing", to: "something"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := index_manager.Rename(ctx, rdb, tt.from, tt.to); err == nil {
+				t.Fatalf("renaming %s to %s succeeded", tt.from, tt.to)
+			}
+		})
+	}
+}
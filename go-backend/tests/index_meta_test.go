@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/index_meta"
+)
+
+// builtMeta is the metadata of an index built with the current schema.
+func builtMeta() *index_meta.Metadata {
+	return &index_meta.Metadata{
+		Model:     "text-embedding-005",
+		Dim:       768,
+		Chunker:   "chars",
+		ChunkSize: 1000,
+		Overlap:   100,
+		Version:   index_meta.SchemaVersion,
+	}
+}
+
+func TestMetadataHash(t *testing.T) {
+	base := builtMeta().Hash()
+	tests := []struct {
+		name   string
+		change func(m *index_meta.Metadata)
+		same   bool
+	}{
+		{name: "unchanged", change: func(m *index_meta.Metadata) {}, same: true},
+		{name: "dimension ignored", change: func(m *index_meta.Metadata) { m.Dim = 256 }, same: true},
+		{name: "root ignored", change: func(m *index_meta.Metadata) { m.Root = "/elsewhere" }, same: true},
+		{name: "unsaved gets the current schema", change: func(m *index_meta.Metadata) { m.Version = 0 }, same: true},
+		{name: "model", change: func(m *index_meta.Metadata) { m.Model = "gemini-embedding-001" }},
+		{name: "chunker", change: func(m *index_meta.Metadata) { m.Chunker = "lines" }},
+		{name: "chunk size", change: func(m *index_meta.Metadata) { m.ChunkSize = 500 }},
+		{name: "overlap", change: func(m *index_meta.Metadata) { m.Overlap = 0 }},
+		{name: "schema", change: func(m *index_meta.Metadata) { m.Version = index_meta.VersionModuleTags }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := builtMeta()
+			tt.change(m)
+			if got := m.Hash(); (got == base) != tt.same {
+				t.Fatalf("hash %s vs %s, want same=%v", got, base, tt.same)
+			}
+		})
+	}
+}
+
+func TestMetadataCheckBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  func(m *index_meta.Metadata)
+		next    func(m *index_meta.Metadata)
+		wantErr string
+	}{
+		{name: "same build", stored: func(m *index_meta.Metadata) {}, next: func(m *index_meta.Metadata) {}},
+		{
+			name:    "model mismatch",
+			stored:  func(m *index_meta.Metadata) {},
+			next:    func(m *index_meta.Metadata) { m.Model = "gemini-embedding-001" },
+			wantErr: `built with embedding model "text-embedding-005", not "gemini-embedding-001"`,
+		},
+		{
+			name:   "legacy metadata differs only in chunking",
+			stored: func(m *index_meta.Metadata) { m.Chunker, m.ChunkSize, m.Version = "", 0, 0 },
+			next:   func(m *index_meta.Metadata) { m.ChunkSize = 400 },
+		},
+		{
+			name:    "legacy metadata with another model",
+			stored:  func(m *index_meta.Metadata) { m.Chunker, m.ChunkSize, m.Version = "", 0, 0 },
+			next:    func(m *index_meta.Metadata) { m.Model = "gemini-embedding-001" },
+			wantErr: "built with embedding model",
+		},
+		{
+			name:    "older schema",
+			stored:  func(m *index_meta.Metadata) { m.Version = index_meta.VersionModuleTags },
+			next:    func(m *index_meta.Metadata) {},
+			wantErr: fmt.Sprintf("schema v%d, not v%d", index_meta.VersionModuleTags, index_meta.SchemaVersion),
+		},
+		{
+			name:    "chunker",
+			stored:  func(m *index_meta.Metadata) {},
+			next:    func(m *index_meta.Metadata) { m.Chunker = "lines" },
+			wantErr: `chunker "chars", not "lines"`,
+		},
+		{
+			name:    "chunk size",
+			stored:  func(m *index_meta.Metadata) {},
+			next:    func(m *index_meta.Metadata) { m.ChunkSize = 500 },
+			wantErr: "chunk size 1000 and overlap 100, not 500 and 100",
+		},
+		{
+			name:    "overlap",
+			stored:  func(m *index_meta.Metadata) {},
+			next:    func(m *index_meta.Metadata) { m.Overlap = 0 },
+			wantErr: "chunk size 1000 and overlap 100, not 1000 and 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, next := builtMeta(), builtMeta()
+			tt.stored(stored)
+			tt.next(next)
+			err := stored.CheckBuild("proj_v1", next)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetadataCheckQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		model   string
+		dim     int
+		wantErr string
+	}{
+		{name: "matching", model: "text-embedding-005", dim: 768},
+		{name: "not embedded yet", model: "text-embedding-005"},
+		{name: "model unknown", dim: 768},
+		{name: "older schema", version: index_meta.VersionModuleTags, model: "text-embedding-005", dim: 768},
+		{name: "newer schema", version: index_meta.SchemaVersion + 1, model: "text-embedding-005", dim: 768, wantErr: "built by a newer smartcli"},
+		{name: "other model", model: "gemini-embedding-001", wantErr: `the query uses "gemini-embedding-001"`},
+		{name: "other dimension", model: "text-embedding-005", dim: 256, wantErr: "stores 768-dimensional vectors but the query embedding has 256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := builtMeta()
+			if tt.version != 0 {
+				m.Version = tt.version
+			}
+			err := m.CheckQuery("proj", tt.model, tt.dim)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
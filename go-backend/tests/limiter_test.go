@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"smart-cli/go-backend/concurrency"
+)
+
+// limiterWindow is one adjustment window of calls that take latency, the
+// first failures of which fail.
+type limiterWindow struct {
+	latency  time.Duration
+	failures int
+}
+
+// runWindow completes one window of calls on l, which is as many calls as
+// the limiter waits for before adjusting.
+func runWindow(t *testing.T, l *concurrency.Limiter, w limiterWindow) {
+	t.Helper()
+	calls := max(8, l.Limit())
+	for i := 0; i < calls; i++ {
+		if err := l.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if i < w.failures {
+			err = errors.New("rate limited")
+		}
+		l.Release(w.latency, err)
+	}
+}
+
+func TestLimiterAdjust(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name               string
+		initial, low, high int
+		windows            []limiterWindow
+		want               []int // limit after each window
+	}{
+		{name: "grows while latency is steady", initial: 4, low: 1, high: 10,
+			windows: []limiterWindow{{latency: 10 * ms}, {latency: 10 * ms}, {latency: 11 * ms}},
+			want:    []int{5, 6, 7}},
+		{name: "halves on errors", initial: 8, low: 1, high: 10,
+			windows: []limiterWindow{{latency: 10 * ms, failures: 2}, {latency: 10 * ms, failures: 2}},
+			want:    []int{4, 2}},
+		{name: "tolerates a few errors", initial: 8, low: 1, high: 10,
+			windows: []limiterWindow{{latency: 10 * ms}, {latency: 10 * ms}, {latency: 10 * ms, failures: 1}},
+			want:    []int{9, 10, 10}},
+		{name: "cuts a quarter when latency doubles", initial: 4, low: 1, high: 10,
+			windows: []limiterWindow{{latency: 10 * ms}, {latency: 25 * ms}},
+			want:    []int{5, 3}},
+		{name: "holds between grow and backoff latency", initial: 4, low: 1, high: 10,
+			windows: []limiterWindow{{latency: 10 * ms}, {latency: 18 * ms}},
+			want:    []int{5, 5}},
+		{name: "recovers after backoff", initial: 4, low: 1, high: 10,
+			windows: []limiterWindow{{latency: 10 * ms}, {latency: 30 * ms}, {latency: 10 * ms}},
+			want:    []int{5, 3, 4}},
+		{name: "kept within bounds", initial: 2, low: 2, high: 3,
+			windows: []limiterWindow{{latency: 10 * ms}, {latency: 10 * ms}, {latency: 10 * ms, failures: 8}},
+			want:    []int{3, 3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := concurrency.NewLimiter(tt.initial, tt.low, tt.high)
+			var got []int
+			for _, w := range tt.windows {
+				runWindow(t, l, w)
+				got = append(got, l.Limit())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("limits %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiterStats(t *testing.T) {
+	l := concurrency.NewLimiter(4, 1, 10)
+	for _, w := range []limiterWindow{{latency: time.Millisecond}, {latency: time.Millisecond, failures: 8}, {latency: time.Millisecond}} {
+		runWindow(t, l, w)
+	}
+	want := concurrency.Stats{Initial: 4, Final: 3, Low: 2, High: 5, Adjustments: 3}
+	if got := l.Stats(); got != want {
+		t.Fatalf("stats %+v, want %+v", got, want)
+	}
+}
+
+func TestNewLimiterClamps(t *testing.T) {
+	tests := []struct {
+		initial, low, high int
+		want               int
+	}{
+		{initial: 50, low: 1, high: 10, want: 10},
+		{initial: 0, low: 3, high: 10, want: 3},
+		{initial: 0, low: 0, high: 0, want: 1},
+		{initial: 5, low: 8, high: 4, want: 8},
+	}
+	for _, tt := range tests {
+		if got := concurrency.NewLimiter(tt.initial, tt.low, tt.high).Limit(); got != tt.want {
+			t.Errorf("NewLimiter(%d, %d, %d) limit %d, want %d", tt.initial, tt.low, tt.high, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterAcquireCancelled(t *testing.T) {
+	l := concurrency.NewLimiter(1, 1, 1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire on a full limiter: %v", err)
+	}
+}
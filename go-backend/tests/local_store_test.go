@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/index_meta"
+	"smart-cli/go-backend/local_store"
+)
+
+// openLocal returns a store in a temporary directory with index "p" holding
+// chunks.
+func openLocal(t *testing.T, chunks ...chunk_retriever.Chunk) (*local_store.Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	s := local_store.Open(dir)
+	ctx := context.Background()
+	if err := s.EnsureIndex(ctx, "p", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(ctx, "p", chunks); err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+var localChunks = []chunk_retriever.Chunk{
+	fileChunk("p", "a.go", 0, "connect to the redis server", 1, 0),
+	fileChunk("p", "b.go", 0, "parse the search reply", 0, 1),
+	fileChunk("p", "c.go", 0, "redis redis connect pool", 0.8, 0.6),
+}
+
+func TestLocalStoreKNN(t *testing.T) {
+	tests := []struct {
+		name    string
+		vec     []float32
+		topK    int
+		filters []chunk_retriever.Filter
+		want    []string
+	}{
+		{name: "nearest first", vec: []float32{1, 0}, topK: 3, want: []string{"p:a.go:0", "p:c.go:0", "p:b.go:0"}},
+		{name: "other direction", vec: []float32{0, 1}, topK: 2, want: []string{"p:b.go:0", "p:c.go:0"}},
+		{name: "tag filter", vec: []float32{1, 0}, topK: 3, filters: []chunk_retriever.Filter{chunk_retriever.TagFilter("file", "b.go")}, want: []string{"p:b.go:0"}},
+		{name: "excluded tag", vec: []float32{1, 0}, topK: 3, filters: []chunk_retriever.Filter{chunk_retriever.TagFilter("file", "a.go").Not()}, want: []string{"p:c.go:0", "p:b.go:0"}},
+	}
+	s, _ := openLocal(t, localChunks...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := s.KNN(context.Background(), chunk_retriever.ChunkQuery{IndexName: "p", TopK: tt.topK, Filters: tt.filters}, tt.vec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chunkKeys(hits); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(hits); i++ {
+				if hits[i].Score < hits[i-1].Score {
+					t.Fatalf("distances not ascending: %v after %v", hits[i].Score, hits[i-1].Score)
+				}
+			}
+		})
+	}
+	if hits, _ := s.KNN(context.Background(), chunk_retriever.ChunkQuery{IndexName: "p", TopK: 1}, []float32{1, 0}); hits[0].Score > 1e-6 {
+		t.Fatalf("identical vector has distance %v, want 0", hits[0].Score)
+	}
+}
+
+func TestLocalStoreSearchText(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		// c.go mentions redis twice in a shorter text
+		{name: "term frequency", query: "redis", want: []string{"p:c.go:0", "p:a.go:0"}},
+		{name: "single match", query: "reply", want: []string{"p:b.go:0"}},
+		{name: "no match", query: "kubernetes", want: []string{}},
+	}
+	s, _ := openLocal(t, localChunks...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := s.SearchText(context.Background(), chunk_retriever.ChunkQuery{IndexName: "p", TopK: 10, Query: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chunkKeys(hits); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, h := range hits {
+				if h.TextScore <= 0 {
+					t.Fatalf("%s has BM25 score %v", h.Key, h.TextScore)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalStorePersist(t *testing.T) {
+	ctx := context.Background()
+	s, dir := openLocal(t, localChunks...)
+	meta := &index_meta.Metadata{Model: "text-embedding-005", Dim: 2, ChunkSize: 800}
+	if err := s.SaveMeta(ctx, "p", meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := local_store.Open(dir)
+	if names, err := reopened.Indexes(ctx); err != nil || !reflect.DeepEqual(names, []string{"p"}) {
+		t.Fatalf("indexes %v, %v", names, err)
+	}
+	got, err := reopened.LoadMeta(ctx, "p")
+	if err != nil || got == nil || got.Model != meta.Model || got.Dim != 2 || got.ChunkSize != 800 {
+		t.Fatalf("meta %+v, %v", got, err)
+	}
+	docs, err := reopened.Get(ctx, []string{"p:a.go:0", "p:missing:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs["p:a.go:0"].Text != localChunks[0].Text || docs["p:a.go:0"].Metadata["file"] != "a.go" {
+		t.Fatalf("got %+v", docs)
+	}
+	// Searches work on the reloaded BM25 statistics too
+	hits, err := reopened.SearchText(ctx, chunk_retriever.ChunkQuery{IndexName: "p", TopK: 1, Query: "reply"})
+	if err != nil || len(hits) != 1 || hits[0].Key != "p:b.go:0" {
+		t.Fatalf("got %v, %v", chunkKeys(hits), err)
+	}
+}
+
+func TestLocalStoreDeleteFile(t *testing.T) {
+	ctx := context.Background()
+	s, _ := openLocal(t, append(localChunks, fileChunk("p", "a.go", 1, "redis client options", 1, 0))...)
+
+	n, err := s.DeleteFile(ctx, "p", "a.go")
+	if err != nil || n != 2 {
+		t.Fatalf("deleted %d, %v; want 2", n, err)
+	}
+	files, _ := s.Files("p")
+	if !reflect.DeepEqual(files, []string{"b.go", "c.go"}) {
+		t.Fatalf("files %v", files)
+	}
+	// The deleted text no longer counts towards BM25
+	hits, _ := s.SearchText(ctx, chunk_retriever.ChunkQuery{IndexName: "p", TopK: 10, Query: "options"})
+	if len(hits) != 0 {
+		t.Fatalf("deleted chunk still found: %v", chunkKeys(hits))
+	}
+	if n, err := s.DeleteFile(ctx, "p", "a.go"); err != nil || n != 0 {
+		t.Fatalf("second delete %d, %v", n, err)
+	}
+}
+
+func TestLocalStorePruneFile(t *testing.T) {
+	ctx := context.Background()
+	old := []chunk_retriever.Chunk{
+		fileChunk("p", "a.go", 0, "one", 1, 0),
+		fileChunk("p", "a.go", 1, "two", 1, 0),
+		fileChunk("p", "a.go", 2, "three", 1, 0),
+	}
+	for i := range old {
+		old[i].Metadata["hash"] = "old"
+	}
+	s, _ := openLocal(t, old...)
+	if hash, n, _ := s.FileState("p", "a.go"); hash != "old" || n != 3 {
+		t.Fatalf("state %q, %d", hash, n)
+	}
+
+	// A shorter new version overwrites chunk 0, then drops the rest
+	next := fileChunk("p", "a.go", 0, "one again", 1, 0)
+	next.Metadata["hash"] = "new"
+	if err := s.Upsert(ctx, "p", []chunk_retriever.Chunk{next}); err != nil {
+		t.Fatal(err)
+	}
+	if hash, n, _ := s.FileState("p", "a.go"); hash != "" || n != 3 {
+		t.Fatalf("mixed state %q, %d; want no hash", hash, n)
+	}
+	if n, err := s.PruneFile("p", "a.go", 1); err != nil || n != 2 {
+		t.Fatalf("pruned %d, %v; want 2", n, err)
+	}
+	if hash, n, _ := s.FileState("p", "a.go"); hash != "new" || n != 1 {
+		t.Fatalf("state %q, %d", hash, n)
+	}
+}
+
+func TestLocalStoreDimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	s, _ := openLocal(t, localChunks...)
+	if err := s.EnsureIndex(ctx, "p", 3); err == nil || !strings.Contains(err.Error(), "2-dimensional") {
+		t.Fatalf("EnsureIndex with another dimension: %v", err)
+	}
+	err := s.Upsert(ctx, "p", []chunk_retriever.Chunk{fileChunk("p", "d.go", 0, "x", 1, 0, 0)})
+	if err == nil {
+		t.Fatal("Upsert of a 3-dimensional chunk into a 2-dimensional index succeeded")
+	}
+	if docs, _ := s.Get(ctx, []string{"p:d.go:0"}); len(docs) != 0 {
+		t.Fatal("rejected chunk was stored")
+	}
+}
+
+func TestLocalStoreFileIndex(t *testing.T) {
+	ctx := context.Background()
+	hashed := func(file string, n int, hash string) chunk_retriever.Chunk {
+		ch := fileChunk("p", file, n, file+" chunk", 1, 0)
+		ch.Metadata["hash"] = hash
+		return ch
+	}
+	s, dir := openLocal(t, hashed("a.go", 0, "h1"), hashed("a.go", 1, "h1"), hashed("b.go", 0, "h1"))
+
+	steps := []struct {
+		name string
+		do   func() error
+		// want is the hash and chunk count of a.go and the files afterwards
+		hash   string
+		chunks int
+		files  []string
+	}{
+		{name: "initial", do: func() error { return nil }, hash: "h1", chunks: 2, files: []string{"a.go", "b.go"}},
+		{name: "delete", do: func() error {
+			_, err := s.DeleteFile(ctx, "p", "a.go")
+			return err
+		}, files: []string{"b.go"}},
+		{name: "put again", do: func() error {
+			return s.Upsert(ctx, "p", []chunk_retriever.Chunk{hashed("a.go", 0, "h2"), hashed("a.go", 1, "h2"), hashed("a.go", 2, "h2")})
+		}, hash: "h2", chunks: 3, files: []string{"a.go", "b.go"}},
+		{name: "prune", do: func() error {
+			_, err := s.PruneFile("p", "a.go", 1)
+			return err
+		}, hash: "h2", chunks: 1, files: []string{"a.go", "b.go"}},
+		{name: "chunk moved to another file", do: func() error {
+			moved := hashed("c.go", 0, "h2")
+			moved.Key = "p:a.go:0"
+			return s.Upsert(ctx, "p", []chunk_retriever.Chunk{moved})
+		}, files: []string{"b.go", "c.go"}},
+		{name: "reloaded", do: func() error {
+			if err := s.Upsert(ctx, "p", []chunk_retriever.Chunk{hashed("a.go", 3, "h3")}); err != nil {
+				return err
+			}
+			if err := s.Close(); err != nil {
+				return err
+			}
+			s = local_store.Open(dir)
+			return nil
+		}, hash: "h3", chunks: 1, files: []string{"a.go", "b.go", "c.go"}},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		hash, n, err := s.FileState("p", "a.go")
+		if err != nil || hash != step.hash || n != step.chunks {
+			t.Fatalf("%s: a.go state %q, %d, %v; want %q, %d", step.name, hash, n, err, step.hash, step.chunks)
+		}
+		if files, _ := s.Files("p"); !reflect.DeepEqual(files, step.files) {
+			t.Fatalf("%s: files %v, want %v", step.name, files, step.files)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"smart-cli/go-backend/chunk_retriever"
+)
+
+func TestSelectMMR(t *testing.T) {
+	// dup is a near-copy of top; other points elsewhere
+	ranked := []chunk_retriever.Chunk{
+		vecChunk("top", 1, 0),
+		vecChunk("dup", 0.99, 0.14),
+		vecChunk("other", 0, 1),
+		vecChunk("between", 0.7, 0.7),
+	}
+	relevance := []float64{0.9, 0.85, 0.7, 0.5}
+	noVectors := []chunk_retriever.Chunk{{Key: "top"}, {Key: "dup"}, {Key: "other"}, {Key: "between"}}
+
+	tests := []struct {
+		name      string
+		chunks    []chunk_retriever.Chunk
+		relevance []float64
+		k         int
+		lambda    float64
+		want      []string
+	}{
+		{name: "skips the near-duplicate", chunks: ranked, relevance: relevance, k: 2, lambda: 0.6, want: []string{"top", "other"}},
+		{name: "duplicate comes after the diverse picks", chunks: ranked, relevance: relevance, k: 3, lambda: 0.6, want: []string{"top", "other", "dup"}},
+		{name: "lambda 1 keeps the ranking", chunks: ranked, relevance: relevance, k: 2, lambda: 1, want: []string{"top", "dup"}},
+		{name: "low lambda favours diversity", chunks: ranked, relevance: relevance, k: 2, lambda: 0.2, want: []string{"top", "other"}},
+		{name: "k covers every chunk", chunks: ranked, relevance: relevance, k: 10, lambda: 0.6, want: []string{"top", "dup", "other", "between"}},
+		{name: "k of 0", chunks: ranked, relevance: relevance, k: 0, lambda: 0.6, want: []string{}},
+		{name: "chunks without vectors keep the ranking", chunks: noVectors, relevance: relevance, k: 3, lambda: 0.6, want: []string{"top", "dup", "other"}},
+		{name: "equal relevance", chunks: ranked, relevance: []float64{1, 1, 1, 1}, k: 2, lambda: 0.6, want: []string{"top", "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkKeys(chunk_retriever.SelectMMR(tt.chunks, tt.relevance, tt.k, tt.lambda)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{name: "identical", a: []float32{1, 2}, b: []float32{1, 2}, want: 1},
+		{name: "scaled", a: []float32{1, 2}, b: []float32{3, 6}, want: 1},
+		{name: "orthogonal", a: []float32{1, 0}, b: []float32{0, 1}, want: 0},
+		{name: "opposite", a: []float32{1, 0}, b: []float32{-1, 0}, want: -1},
+		{name: "diagonal", a: []float32{1, 0}, b: []float32{1, 1}, want: math.Sqrt2 / 2},
+		{name: "zero vector", a: []float32{0, 0}, b: []float32{1, 1}, want: 0},
+		{name: "dimension mismatch", a: []float32{1, 0}, b: []float32{1, 0, 0}, want: 0},
+		{name: "missing", a: nil, b: nil, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunk_retriever.Cosine(tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
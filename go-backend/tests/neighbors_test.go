@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/chunk_retriever"
+)
+
+func TestMergeAdjacent(t *testing.T) {
+	// want lists each window as "<key> <chunk range>: <text>"
+	tests := []struct {
+		name    string
+		chunks  []chunk_retriever.Chunk
+		overlap int
+		want    []string
+	}{
+		{
+			name:    "overlap dropped",
+			chunks:  []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "func a() {}\nxyz"), fileChunk("idx", "a.go", 1, "xyz\nfunc b() {}")},
+			overlap: 3,
+			want:    []string{"idx:a.go:0 0-1: func a() {}\nxyz\nfunc b() {}"},
+		},
+		{
+			name:    "overlap counted in runes",
+			chunks:  []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "// größe wört"), fileChunk("idx", "a.go", 1, "wört über")},
+			overlap: 4,
+			want:    []string{"idx:a.go:0 0-1: // größe wört über"},
+		},
+		{
+			name:    "mismatched overlap kept",
+			chunks:  []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "abc"), fileChunk("idx", "a.go", 1, "xyz")},
+			overlap: 2,
+			want:    []string{"idx:a.go:0 0-1: abcxyz"},
+		},
+		{
+			name:    "overlap longer than the chunk",
+			chunks:  []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "abc"), fileChunk("idx", "a.go", 1, "c")},
+			overlap: 5,
+			want:    []string{"idx:a.go:0 0-1: abcc"},
+		},
+		{
+			name:   "no overlap",
+			chunks: []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "one\n"), fileChunk("idx", "a.go", 1, "two\n"), fileChunk("idx", "a.go", 2, "three\n")},
+			want:   []string{"idx:a.go:0 0-2: one\ntwo\nthree\n"},
+		},
+		{
+			name:   "gap splits windows",
+			chunks: []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "one"), fileChunk("idx", "a.go", 2, "three")},
+			want:   []string{"idx:a.go:0 0: one", "idx:a.go:2 2: three"},
+		},
+		{
+			name:   "files not merged",
+			chunks: []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "a"), fileChunk("idx", "b.go", 1, "b")},
+			want:   []string{"idx:a.go:0 0: a", "idx:b.go:1 1: b"},
+		},
+		{
+			name:   "duplicates joined once",
+			chunks: []chunk_retriever.Chunk{fileChunk("idx", "a.go", 1, "two"), fileChunk("idx", "a.go", 0, "one"), fileChunk("idx", "a.go", 1, "two")},
+			want:   []string{"idx:a.go:1 0-1: onetwo"},
+		},
+		{
+			// The window sits where its best-ranked member was
+			name:   "ranking kept",
+			chunks: []chunk_retriever.Chunk{fileChunk("idx", "a.go", 5, "best"), fileChunk("idx", "b.go", 0, "second"), fileChunk("idx", "a.go", 4, "before ")},
+			want:   []string{"idx:a.go:5 4-5: before best", "idx:b.go:0 0: second"},
+		},
+		{
+			name: "keys without a position",
+			chunks: []chunk_retriever.Chunk{
+				{Key: "external", Text: "x"},
+				fileChunk("idx", "a.go", 0, "a"),
+				{Key: "idx:b.go:3", Text: "y", Metadata: map[string]string{"chunk": "7"}},
+			},
+			want: []string{"external : x", "idx:a.go:0 0: a", "idx:b.go:3 7: y"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, ch := range chunk_retriever.MergeAdjacent(tt.chunks, tt.overlap) {
+				got = append(got, ch.Key+" "+ch.Metadata["chunk"]+": "+ch.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeAdjacentKeepsInput(t *testing.T) {
+	chunks := []chunk_retriever.Chunk{fileChunk("idx", "a.go", 0, "one"), fileChunk("idx", "a.go", 1, "two")}
+	merged := chunk_retriever.MergeAdjacent(chunks, 0)
+	if len(merged) != 1 || merged[0].Metadata["file"] != "a.go" {
+		t.Fatalf("got %+v", merged)
+	}
+	if chunks[0].Metadata["chunk"] != "0" || strings.Contains(chunks[0].Text, "two") {
+		t.Fatalf("input chunk modified: %+v", chunks[0])
+	}
+}
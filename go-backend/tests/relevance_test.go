@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"smart-cli/go-backend/chunk_retriever"
+)
+
+func TestElbowCutoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		distances []float64
+		want      float64
+		ok        bool
+	}{
+		{name: "clear elbow", distances: []float64{0.1, 0.12, 0.14, 0.5, 0.52}, want: 0.14, ok: true},
+		{name: "unsorted", distances: []float64{0.5, 0.1, 0.52, 0.14, 0.12}, want: 0.14, ok: true},
+		{name: "single outlier", distances: []float64{0.2, 0.21, 0.22, 0.23, 0.9}, want: 0.23, ok: true},
+		{name: "even spread", distances: []float64{0.1, 0.2, 0.3, 0.4}},
+		{name: "jump below the minimum gap", distances: []float64{0.1, 0.101, 0.102, 0.115}},
+		{name: "jump not standing out", distances: []float64{0.1, 0.2, 0.35, 0.45}},
+		{name: "too few distances", distances: []float64{0.1, 0.9}},
+		{name: "none", distances: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := chunk_retriever.ElbowCutoff(tt.distances)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("got %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestThresholdApply(t *testing.T) {
+	vec := []float32{1, 0}
+	chunks := []chunk_retriever.Chunk{
+		vectorHit("a", 0.1, 1),
+		vectorHit("b", 0.12, 1),
+		{Key: "text-only", TextRank: 1},
+		vectorHit("c", 0.14, 1),
+		vectorHit("d", 0.5, 1),
+		vectorHit("e", 0.52, 1),
+	}
+	tests := []struct {
+		name      string
+		threshold chunk_retriever.Threshold
+		chunks    []chunk_retriever.Chunk
+		want      []string
+	}{
+		{name: "disabled", chunks: chunks, want: []string{"a", "b", "text-only", "c", "d", "e"}},
+		{name: "max distance", threshold: chunk_retriever.Threshold{MaxDistance: 0.13}, chunks: chunks, want: []string{"a", "b", "text-only"}},
+		{name: "adaptive", threshold: chunk_retriever.Threshold{Adaptive: true}, chunks: chunks, want: []string{"a", "b", "text-only", "c"}},
+		{
+			name:      "adaptive without an elbow",
+			threshold: chunk_retriever.Threshold{Adaptive: true},
+			chunks:    []chunk_retriever.Chunk{vectorHit("a", 0.1, 1), vectorHit("b", 0.2, 1), vectorHit("c", 0.3, 1), vectorHit("d", 0.4, 1)},
+			want:      []string{"a", "b", "c", "d"},
+		},
+		{
+			// The elbow is looked for among the chunks within MaxDistance
+			name:      "adaptive within max distance",
+			threshold: chunk_retriever.Threshold{MaxDistance: 0.6, Adaptive: true},
+			chunks:    append([]chunk_retriever.Chunk{vectorHit("far", 1.5, 1)}, chunks...),
+			want:      []string{"a", "b", "text-only", "c"},
+		},
+		{
+			name:      "stored embedding preferred over the score",
+			threshold: chunk_retriever.Threshold{MaxDistance: 0.3},
+			chunks: []chunk_retriever.Chunk{
+				{Key: "same", Embedding: []float32{2, 0}, Score: 0.9, VectorRank: 1},
+				{Key: "orthogonal", Embedding: []float32{0, 1}, Score: 0.05, VectorRank: 2},
+			},
+			want: []string{"same"},
+		},
+		{
+			name:      "embedding of another dimension",
+			threshold: chunk_retriever.Threshold{MaxDistance: 0.3},
+			chunks:    []chunk_retriever.Chunk{{Key: "x", Embedding: []float32{1, 0, 0}, TextRank: 1}},
+			want:      []string{"x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkKeys(tt.threshold.Apply(tt.chunks, vec)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"smart-cli/go-backend/chunk_retriever"
+	"smart-cli/go-backend/reranker"
+)
+
+func TestLexicalReranker(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		chunks []chunk_retriever.Chunk
+		k      int
+		want   []string
+	}{
+		{
+			name:  "term overlap",
+			query: "how are embeddings cached",
+			chunks: textChunks(
+				"func parseArgs(args []string) {}",
+				"// cache embeddings by content hash\nfunc cachedEmbeddings() {}",
+			),
+			want: []string{"1", "0"},
+		},
+		{
+			name:  "declaration beats use",
+			query: "what does storeChunk do",
+			chunks: textChunks(
+				"if err := storeChunk(ctx, ch); err != nil {\n\treturn err\n}",
+				"func (i *Indexer) storeChunk(ctx context.Context, ch Chunk) error {\n\treturn nil\n}",
+				"func unrelated() {}",
+			),
+			want: []string{"1", "0", "2"},
+		},
+		{
+			name:  "camelCase parts match",
+			query: "chunk store",
+			chunks: textChunks(
+				"func retrieve() {}",
+				"func storeChunk() {}",
+			),
+			want: []string{"1", "0"},
+		},
+		{
+			name:  "boilerplate penalised",
+			query: "redis client",
+			chunks: textChunks(
+				"package store\n\nimport (\n\t\"redis\"\n)\n// client",
+				"func newClient() *redis.Client {\n\treturn redis.NewClient(opts)\n}",
+			),
+			want: []string{"1", "0"},
+		},
+		{
+			name:   "ties keep the retrieval order",
+			query:  "the",
+			chunks: textChunks("alpha", "beta", "gamma"),
+			want:   []string{"0", "1", "2"},
+		},
+		{
+			name:   "best k",
+			query:  "retry failed chunks",
+			chunks: textChunks("func walk() {}", "retry the failed chunks", "func retry() {}"),
+			k:      2,
+			want:   []string{"1", "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked, err := reranker.Rerank(context.Background(), reranker.LexicalReranker{}, tt.query, tt.chunks, tt.k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chunkKeys(ranked); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(ranked); i++ {
+				if ranked[i].Rerank > ranked[i-1].Rerank {
+					t.Fatalf("scores not descending: %v after %v", ranked[i].Rerank, ranked[i-1].Rerank)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScores(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		n       int
+		want    []float64
+		wantErr bool
+	}{
+		{name: "bare array", reply: "[7, 0, 10]", n: 3, want: []float64{7, 0, 10}},
+		{name: "surrounding prose", reply: "Here are the scores:\n[3, 8.5]\nDone.", n: 2, want: []float64{3, 8.5}},
+		{name: "code fence", reply: "```json\n[1,2]\n```", n: 2, want: []float64{1, 2}},
+		{name: "wrong count", reply: "[1, 2]", n: 3, wantErr: true},
+		{name: "no array", reply: "I cannot rate these.", n: 1, wantErr: true},
+		{name: "not numbers", reply: `["high", "low"]`, n: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reranker.ParseScores(tt.reply, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReranker(t *testing.T) {
+	if r, err := reranker.New(reranker.None, nil); r != nil || err != nil {
+		t.Fatalf("none: %v, %v", r, err)
+	}
+	if r, err := reranker.New(reranker.Lexical, nil); err != nil || r == nil {
+		t.Fatalf("lexical: %v, %v", r, err)
+	}
+	if _, err := reranker.New(reranker.LLM, nil); err == nil {
+		t.Fatal("llm reranker without a generation model succeeded")
+	}
+	if _, err := reranker.New("bm42", nil); err == nil {
+		t.Fatal("unknown reranker succeeded")
+	}
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	"smart-cli/go-backend/chunk_retriever"
+)
+
+// serveReply starts a server that answers every FT.SEARCH with the recorded
+// reply bytes, so the test decodes them through go-redis as in production.
+func serveReply(t *testing.T, reply string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					cmd, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(cmd) {
+					case "HELLO":
+						io.WriteString(conn, "-ERR unknown command 'HELLO'\r\n")
+					case "FT.SEARCH":
+						io.WriteString(conn, reply)
+					default:
+						io.WriteString(conn, "+OK\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// readCommand reads one RESP command and returns its name.
+func readCommand(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return "", err
+	}
+	var name string
+	for i := 0; i < n; i++ {
+		if _, err := r.ReadString('\n'); err != nil { // $<len>
+			return "", err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if i == 0 {
+			name = strings.TrimSpace(arg)
+		}
+	}
+	return name, nil
+}
+
+func TestParseSearchReply(t *testing.T) {
+	tests := []struct {
+		name       string
+		protocol   int
+		withScores bool
+		reply      string
+		want       *chunk_retriever.SearchReply
+		wantErr    bool
+	}{
+		{
+			name:     "resp2 knn",
+			protocol: 2,
+			reply: "*5\r\n:7\r\n" +
+				"$8\r\nr:a.go:0\r\n" +
+				"*4\r\n$4\r\ntext\r\n$9\r\nfunc a()\n\r\n$12\r\nvector_score\r\n$4\r\n0.12\r\n" +
+				"$8\r\nr:b.go:3\r\n" +
+				"*4\r\n$4\r\nfile\r\n$4\r\nb.go\r\n$12\r\nvector_score\r\n$4\r\n0.31\r\n",
+			want: &chunk_retriever.SearchReply{Total: 7, Docs: []chunk_retriever.SearchDoc{
+				{Key: "r:a.go:0", Fields: map[string]string{"text": "func a()\n", "vector_score": "0.12"}},
+				{Key: "r:b.go:3", Fields: map[string]string{"file": "b.go", "vector_score": "0.31"}},
+			}},
+		},
+		{
+			name:       "resp2 withscores",
+			protocol:   2,
+			withScores: true,
+			reply: "*4\r\n:1\r\n" +
+				"$8\r\nr:a.go:0\r\n$3\r\n2.5\r\n" +
+				"*2\r\n$6\r\nmodule\r\n$3\r\napi\r\n",
+			want: &chunk_retriever.SearchReply{Total: 1, Docs: []chunk_retriever.SearchDoc{
+				{Key: "r:a.go:0", Score: 2.5, HasScore: true, Fields: map[string]string{"module": "api"}},
+			}},
+		},
+		{
+			name:     "resp2 nocontent",
+			protocol: 2,
+			reply:    "*3\r\n:2\r\n$8\r\nr:a.go:0\r\n$8\r\nr:a.go:1\r\n",
+			want: &chunk_retriever.SearchReply{Total: 2, Docs: []chunk_retriever.SearchDoc{
+				{Key: "r:a.go:0", Fields: map[string]string{}},
+				{Key: "r:a.go:1", Fields: map[string]string{}},
+			}},
+		},
+		{
+			name:       "resp2 nocontent withscores",
+			protocol:   2,
+			withScores: true,
+			reply:      "*5\r\n:2\r\n$8\r\nr:a.go:0\r\n$1\r\n3\r\n$8\r\nr:a.go:1\r\n$3\r\n1.5\r\n",
+			want: &chunk_retriever.SearchReply{Total: 2, Docs: []chunk_retriever.SearchDoc{
+				{Key: "r:a.go:0", Score: 3, HasScore: true, Fields: map[string]string{}},
+				{Key: "r:a.go:1", Score: 1.5, HasScore: true, Fields: map[string]string{}},
+			}},
+		},
+		{
+			name:     "resp2 no results",
+			protocol: 2,
+			reply:    "*1\r\n:0\r\n",
+			want:     &chunk_retriever.SearchReply{Docs: []chunk_retriever.SearchDoc{}},
+		},
+		{
+			name:     "resp2 odd fields",
+			protocol: 2,
+			reply:    "*3\r\n:1\r\n$8\r\nr:a.go:0\r\n*1\r\n$4\r\ntext\r\n",
+			wantErr:  true,
+		},
+		{
+			name:       "resp2 missing score",
+			protocol:   2,
+			withScores: true,
+			reply:      "*2\r\n:1\r\n$8\r\nr:a.go:0\r\n",
+			wantErr:    true,
+		},
+		{
+			name:     "resp3 knn",
+			protocol: 3,
+			reply: "%5\r\n" +
+				"+attributes\r\n*0\r\n" +
+				"+format\r\n+STRING\r\n" +
+				"+results\r\n*2\r\n" +
+				"%3\r\n+id\r\n$8\r\nr:a.go:0\r\n+extra_attributes\r\n%2\r\n$4\r\ntext\r\n$6\r\nfunc a\r\n$12\r\nvector_score\r\n$4\r\n0.12\r\n+values\r\n*0\r\n" +
+				"%3\r\n+id\r\n$8\r\nr:b.go:3\r\n+extra_attributes\r\n%1\r\n$4\r\nfile\r\n$4\r\nb.go\r\n+values\r\n*0\r\n" +
+				"+total_results\r\n:9\r\n" +
+				"+warning\r\n*0\r\n",
+			want: &chunk_retriever.SearchReply{Total: 9, Docs: []chunk_retriever.SearchDoc{
+				{Key: "r:a.go:0", Fields: map[string]string{"text": "func a", "vector_score": "0.12"}},
+				{Key: "r:b.go:3", Fields: map[string]string{"file": "b.go"}},
+			}},
+		},
+		{
+			name:       "resp3 withscores and warning",
+			protocol:   3,
+			withScores: true,
+			reply: "%3\r\n" +
+				"+results\r\n*1\r\n" +
+				"%3\r\n+id\r\n$8\r\nr:a.go:0\r\n+score\r\n,1.75\r\n+extra_attributes\r\n%1\r\n$6\r\nmodule\r\n$3\r\napi\r\n" +
+				"+total_results\r\n:4\r\n" +
+				"+warning\r\n*1\r\n+Timeout limit was reached\r\n",
+			want: &chunk_retriever.SearchReply{
+				Total:    4,
+				Docs:     []chunk_retriever.SearchDoc{{Key: "r:a.go:0", Score: 1.75, HasScore: true, Fields: map[string]string{"module": "api"}}},
+				Warnings: []string{"Timeout limit was reached"},
+			},
+		},
+		{
+			name:     "resp3 nocontent",
+			protocol: 3,
+			reply: "%2\r\n" +
+				"+results\r\n*1\r\n%1\r\n+id\r\n$8\r\nr:a.go:0\r\n" +
+				"+total_results\r\n:1\r\n",
+			want: &chunk_retriever.SearchReply{Total: 1, Docs: []chunk_retriever.SearchDoc{
+				{Key: "r:a.go:0", Fields: map[string]string{}},
+			}},
+		},
+		{
+			name:     "resp3 result without id",
+			protocol: 3,
+			reply:    "%2\r\n+results\r\n*1\r\n%1\r\n+score\r\n,1\r\n+total_results\r\n:1\r\n",
+			wantErr:  true,
+		},
+		{
+			name:     "not a search reply",
+			protocol: 2,
+			reply:    "+OK\r\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := redis.NewClient(&redis.Options{
+				Addr:            serveReply(t, tt.reply),
+				Protocol:        tt.protocol,
+				DisableIdentity: true,
+			})
+			defer rdb.Close()
+			res, err := rdb.Do(context.Background(), "FT.SEARCH", "idx", "*").Result()
+			if err != nil {
+				t.Fatalf("decoding reply: %v", err)
+			}
+
+			got, err := chunk_retriever.ParseSearchReply(res, tt.withScores)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
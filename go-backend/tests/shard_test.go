@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"smart-cli/go-backend/re_indexer"
+)
+
+func TestShardOf(t *testing.T) {
+	const count = 8
+	tests := []struct {
+		name      string
+		by        string
+		a, b      string
+		sameShard bool
+	}{
+		{name: "by dir keeps a directory together", by: re_indexer.ShardByDir, a: "pkg/a.go", b: "pkg/sub/deep/b.go", sameShard: true},
+		{name: "by dir keeps root files together", by: re_indexer.ShardByDir, a: "main.go", b: "README.md", sameShard: true},
+		{name: "by hash is per file", by: re_indexer.ShardByHash, a: "pkg/a.go", b: "pkg/b.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := re_indexer.ShardOf(tt.by, count, tt.a)
+			b := re_indexer.ShardOf(tt.by, count, tt.b)
+			if a < 0 || a >= count || b < 0 || b >= count {
+				t.Fatalf("shards %d and %d out of range", a, b)
+			}
+			if (a == b) != tt.sameShard {
+				t.Fatalf("%s in shard %d and %s in shard %d, want same=%v", tt.a, a, tt.b, b, tt.sameShard)
+			}
+			// The assignment depends only on the path
+			if again := re_indexer.ShardOf(tt.by, count, tt.a); again != a {
+				t.Fatalf("%s moved from shard %d to %d", tt.a, a, again)
+			}
+		})
+	}
+}
+
+func TestShardOfSpread(t *testing.T) {
+	tests := []struct {
+		by    string
+		count int
+		want  int // shards used by 64 files in one directory
+	}{
+		{by: re_indexer.ShardByDir, count: 4, want: 1},
+		{by: re_indexer.ShardByHash, count: 4, want: 4},
+		{by: re_indexer.ShardByHash, count: 1, want: 1},
+		{by: re_indexer.ShardByHash, count: 0, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.by, tt.count), func(t *testing.T) {
+			used := map[int]bool{}
+			for n := range 64 {
+				used[re_indexer.ShardOf(tt.by, tt.count, fmt.Sprintf("pkg/file%d.go", n))] = true
+			}
+			if len(used) != tt.want {
+				t.Fatalf("files spread over shards %v, want %d shards", used, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidShardBy(t *testing.T) {
+	for _, by := range []string{re_indexer.ShardByDir, re_indexer.ShardByHash} {
+		if err := re_indexer.ValidShardBy(by); err != nil {
+			t.Errorf("ValidShardBy(%q): %v", by, err)
+		}
+	}
+	for _, by := range []string{"", "module", "DIR"} {
+		if err := re_indexer.ValidShardBy(by); err == nil {
+			t.Errorf("ValidShardBy(%q) accepted", by)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/index_manager"
+	"smart-cli/go-backend/re_indexer"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	_, src := newFakeRedis(t)
+	seedIndex(t, src, "proj", "proj_v1", "/src/proj", "a.go", "dir/b.go")
+
+	var archive bytes.Buffer
+	m, err := index_manager.Export(ctx, src, "proj", "", &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Chunks != 2 || m.Dim != 2 || m.Model != "fake-model" || m.Root != "/src/proj" {
+		t.Fatalf("manifest %+v", m)
+	}
+
+	// Imported into another Redis, paths resolve against the local checkout
+	dst, rdb := newFakeRedis(t)
+	root := filepath.FromSlash("/home/dev/proj")
+	m, target, err := index_manager.Import(ctx, rdb, bytes.NewReader(archive.Bytes()), index_manager.ImportOptions{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Index != "proj" || !strings.HasPrefix(target, "proj_v") {
+		t.Fatalf("imported %q into %q", m.Index, target)
+	}
+	want := map[string]string{
+		target + ":a.go:0":     filepath.Join(root, "a.go"),
+		target + ":dir/b.go:0": filepath.Join(root, "dir", "b.go"),
+	}
+	for key, file := range want {
+		h := dst.hash(key)
+		if h["file"] != file || h["module"] != "core" || len(h["embedding"]) != 8 {
+			t.Fatalf("%s imported as %v, want file %s", key, h, file)
+		}
+	}
+	info, err := index_manager.GetInfo(ctx, rdb, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NumDocs != 2 || info.VectorDim != 2 || info.Meta == nil || info.Meta.Root != root || info.Meta.Model != "fake-model" {
+		t.Fatalf("imported index %+v with metadata %+v", info, info.Meta)
+	}
+}
+
+func TestSnapshotImportForce(t *testing.T) {
+	ctx := context.Background()
+	_, src := newFakeRedis(t)
+	seedIndex(t, src, "proj", "proj_v1", "/src/proj", "a.go")
+	var archive bytes.Buffer
+	if _, err := index_manager.Export(ctx, src, "proj", "", &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, rdb := newFakeRedis(t)
+	seedIndex(t, rdb, "proj", "proj_v0", "/home/dev/proj", "old.go")
+	opts := index_manager.ImportOptions{Root: "/home/dev/proj"}
+	if _, _, err := index_manager.Import(ctx, rdb, bytes.NewReader(archive.Bytes()), opts); err == nil {
+		t.Fatal("import over an existing index succeeded without Force")
+	}
+
+	opts.Force = true
+	_, target, err := index_manager.Import(ctx, rdb, bytes.NewReader(archive.Bytes()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The existing index serves queries until the import is activated
+	if info, err := index_manager.GetInfo(ctx, rdb, "proj"); err != nil || info.IndexName != "proj_v0" {
+		t.Fatalf("before activation proj resolves to %+v, %v", info, err)
+	}
+	ix := re_indexer.NewIndexer(rdb, nil, "/home/dev/proj", "proj")
+	ix.Target = target
+	previous, err := ix.Activate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != "proj_v0" {
+		t.Fatalf("previous version %q, want proj_v0", previous)
+	}
+	if _, err := index_manager.Drop(ctx, rdb, previous); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.keysWithPrefix("proj_v0:"); len(got) != 0 {
+		t.Fatalf("keys of the replaced index left: %v", got)
+	}
+	if got, want := dst.keysWithPrefix(target+":"), []string{target + ":a.go:0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys %v, want %v", got, want)
+	}
+	if info, err := index_manager.GetInfo(ctx, rdb, "proj"); err != nil || info.IndexName != target {
+		t.Fatalf("after activation proj resolves to %+v, %v", info, err)
+	}
+}
+
+// gzipLines compresses lines as a snapshot archive.
+func gzipLines(t *testing.T, lines ...string) string {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	for _, line := range lines {
+		io.WriteString(zw, line+"\n")
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestSnapshotImportRejects(t *testing.T) {
+	ctx := context.Background()
+	manifest := func(extra string) string {
+		return `{"format":"smartcli-index-snapshot","version":1,"index":"proj","dim":2` + extra + `}`
+	}
+	tests := []struct {
+		name    string
+		archive string
+		wantErr string
+	}{
+		{name: "not gzip", archive: "plain text", wantErr: "not a snapshot archive"},
+		{name: "other format", archive: gzipLines(t, `{"format":"tarball","version":1,"dim":2}`), wantErr: "not a smartcli index snapshot"},
+		{name: "newer format", archive: gzipLines(t, `{"format":"smartcli-index-snapshot","version":99,"dim":2}`), wantErr: "snapshot format v99"},
+		{name: "newer schema", archive: gzipLines(t, manifest(`,"schema_version":99`)), wantErr: "newer smartcli"},
+		{name: "no dimension", archive: gzipLines(t, `{"format":"smartcli-index-snapshot","version":1,"index":"proj"}`), wantErr: "no vector dimension"},
+		{
+			name:    "vector of another dimension",
+			archive: gzipLines(t, manifest(""), `{"file":"a.go","chunk":0,"text":"x","embedding":"AAAAAA=="}`),
+			wantErr: "has a 4-byte vector, want 8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, rdb := newFakeRedis(t)
+			_, _, err := index_manager.Import(ctx, rdb, strings.NewReader(tt.archive), index_manager.ImportOptions{Root: "/src"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+			}
+			// A failed import leaves nothing behind
+			if got := dst.keysWithPrefix("proj_v"); len(got) != 0 {
+				t.Fatalf("keys left: %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+module example.com/app
+
+go 1.24
+
+toolchain go1.24.5
+
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/redis/go-redis/v9 v9.12.1
+	example.com/forked v1.0.0
+	example.com/local v0.0.0-00010101000000-000000000000
+	example.com/pinned v1.2.0
+	example.com/missing v1.0.0
+)
+
+require golang.org/x/sync v0.16.0 // indirect
+
+replace example.com/forked => github.com/someone/forked v1.0.1
+
+replace example.com/local => ../local
+
+replace (
+	example.com/pinned v1.2.0 => example.com/pinned v1.2.1
+	example.com/pinned v1.1.0 => example.com/pinned v1.1.9
+)
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"smart-cli/go-backend/workspace"
+)
+
+// moduleRels returns the root-relative directories and names of ws's
+// modules as "rel=name".
+func moduleRels(ws *workspace.Workspace) []string {
+	out := make([]string, len(ws.Modules))
+	for i, m := range ws.Modules {
+		out[i] = m.Rel + "=" + m.Name
+	}
+	return out
+}
+
+func TestWorkspaceFind(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		start      string
+		wantSource string
+		want       []string
+		wantErr    string
+	}{
+		{
+			name: "go.work block",
+			files: map[string]string{
+				"go.work":        "go 1.24\n\nuse (\n\t./api // the HTTP API\n\t\"./web\"\n\t./api\n)\n",
+				"api/go.mod":     "module example.com/api\n\ngo 1.24\n",
+				"web/index.js":   "",
+				"tools/go.mod":   "module example.com/tools\n",
+				"api/handler.go": "package api",
+			},
+			start:      "api",
+			wantSource: "go.work",
+			want:       []string{"api=example.com/api", "web=web"},
+		},
+		{
+			name: "go.work single-line use",
+			files: map[string]string{
+				"go.work":       "go 1.24\nuse ./svc\nuse `./lib`\n",
+				"svc/go.mod":    "module \"example.com/svc\"\n",
+				"lib/go.mod":    "module example.com/lib\n",
+				"svc/a/b/c.go":  "package b",
+				"unused/go.mod": "module example.com/unused\n",
+			},
+			start:      "svc/a/b",
+			wantSource: "go.work",
+			want:       []string{"lib=example.com/lib", "svc=example.com/svc"},
+		},
+		{
+			name: "config takes precedence",
+			files: map[string]string{
+				"go.work":               "use ./api\n",
+				".smartcli/config.json": `{"workspace": {"modules": ["api", "web/"]}}`,
+				"api/go.mod":            "module example.com/api\n",
+				"web/package.json":      "{}",
+			},
+			start:      ".",
+			wantSource: filepath.Join(".smartcli", "config.json"),
+			want:       []string{"api=example.com/api", "web=web"},
+		},
+		{
+			name:  "not a workspace",
+			files: map[string]string{"go.mod": "module example.com/single\n"},
+			start: ".",
+		},
+		{
+			name:    "missing module directory",
+			files:   map[string]string{"go.work": "use ./gone\n"},
+			start:   ".",
+			wantErr: "module directory ./gone not found",
+		},
+		{
+			name:    "no modules",
+			files:   map[string]string{"go.work": "go 1.24\n"},
+			start:   ".",
+			wantErr: "lists no modules",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			ws, err := workspace.Find(filepath.Join(dir, tt.start))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if ws != nil {
+					t.Fatalf("found workspace %+v", ws)
+				}
+				return
+			}
+			if ws == nil {
+				t.Fatal("no workspace found")
+			}
+			if ws.Root != dir || ws.Source != filepath.Join(dir, tt.wantSource) {
+				t.Fatalf("workspace at %s from %s", ws.Root, ws.Source)
+			}
+			if got := moduleRels(ws); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("modules %v, want %v", got, tt.want)
+			}
+			if ws.IndexName() != filepath.Base(dir)+"_index" {
+				t.Fatalf("index name %s", ws.IndexName())
+			}
+		})
+	}
+}
+
+func TestWorkspaceModuleFor(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"svc/go.mod":        "module example.com/svc\n",
+		"svc/plugin/go.mod": "module example.com/svc/plugin\n",
+		"svc-extra/x.go":    "package x",
+		"other/README.md":   "",
+	})
+	ws, err := workspace.New(dir, []string{"svc", "svc/plugin", "svc-extra"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "svc/main.go", want: "example.com/svc"},
+		{path: "svc", want: "example.com/svc"},
+		{path: "svc/plugin/p.go", want: "example.com/svc/plugin"},
+		{path: "svc/pluginx/p.go", want: "example.com/svc"},
+		{path: "svc-extra/x.go", want: "svc-extra"},
+		{path: "other/README.md"},
+	}
+	for _, tt := range tests {
+		got := ""
+		if m := ws.ModuleFor(filepath.Join(dir, filepath.FromSlash(tt.path))); m != nil {
+			got = m.Name
+		}
+		if got != tt.want {
+			t.Errorf("ModuleFor(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWorkspaceLookup(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"services/api/go.mod": "module example.com/api\n",
+		"libs/api/go.mod":     "module example.com/libs/api\n",
+		"web/go.mod":          "module example.com/web\n",
+	})
+	ws, err := workspace.New(dir, []string{"services/api", "libs/api", "web"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "example.com/web", want: "web"},
+		{ref: "services/api", want: "services/api"},
+		{ref: "./libs/api/", want: "libs/api"},
+		{ref: "web", want: "web"},
+		{ref: "api", wantErr: "ambiguous"},
+		{ref: "mobile", wantErr: "not in the workspace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			m, err := ws.Lookup(tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Rel != tt.want {
+				t.Fatalf("resolved to %s, want %s", m.Rel, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGoWorkErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"go.work": "use (\n\t\"./unterminated\n)\n"})
+	if _, err := workspace.ParseGoWork(filepath.Join(dir, "go.work")); err == nil || !strings.Contains(err.Error(), "go.work:2") {
+		t.Fatalf("error %v, want one naming go.work:2", err)
+	}
+	if _, err := workspace.ParseGoWork(filepath.Join(dir, "missing.work")); !os.IsNotExist(err) {
+		t.Fatalf("error %v for a missing file", err)
+	}
+}
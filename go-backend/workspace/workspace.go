@@ -0,0 +1,224 @@
+package workspace
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"smart-cli/go-backend/config"
+)
+
+// WorkFile is the Go workspace file that lists a monorepo's modules.
+const WorkFile = "go.work"
+
+// Module is one module of a workspace.
+type Module struct {
+	// Name is the module path from its go.mod, or the root-relative directory
+	// when there is no go.mod. It is the value stored in the "module" TAG.
+	Name string
+	// Dir is the module's absolute directory.
+	Dir string
+	// Rel is Dir relative to the workspace root, slash-separated.
+	Rel string
+}
+
+// Workspace is a set of modules indexed together into one index.
+type Workspace struct {
+	// Root is the directory holding go.work or the project config.
+	Root string
+	// Source is the file the module list was read from.
+	Source  string
+	Modules []Module
+}
+
+// Find looks for a workspace enclosing start. A "workspace.modules" list in
+// .smartcli/config.json takes precedence over go.work. It returns nil if
+// start is not inside a workspace.
+func Find(start string) (*Workspace, error) {
+	abs, err := filepath.Abs(start)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(abs)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Workspace.Modules) > 0 {
+		return New(cfg.Root(), cfg.Workspace.Modules, cfg.Path())
+	}
+	for curr := abs; ; {
+		p := filepath.Join(curr, WorkFile)
+		if _, err := os.Stat(p); err == nil {
+			dirs, err := ParseGoWork(p)
+			if err != nil {
+				return nil, err
+			}
+			return New(curr, dirs, p)
+		}
+		parent := filepath.Dir(curr)
+		if parent == curr {
+			return nil, nil
+		}
+		curr = parent
+	}
+}
+
+// New builds a workspace rooted at root from module directories, which are
+// relative to root unless absolute.
+func New(root string, dirs []string, source string) (*Workspace, error) {
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("%s lists no modules", source)
+	}
+	ws := &Workspace{Root: root, Source: source}
+	seen := map[string]struct{}{}
+	for _, d := range dirs {
+		dir := d
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, filepath.FromSlash(d))
+		}
+		dir = filepath.Clean(dir)
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("%s: module directory %s not found", source, d)
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		name := modulePath(filepath.Join(dir, "go.mod"))
+		if name == "" {
+			name = rel
+		}
+		ws.Modules = append(ws.Modules, Module{Name: name, Dir: dir, Rel: rel})
+	}
+	sort.Slice(ws.Modules, func(a, b int) bool { return ws.Modules[a].Rel < ws.Modules[b].Rel })
+	return ws, nil
+}
+
+// IndexName is the default index name for the workspace.
+func (w *Workspace) IndexName() string {
+	return filepath.Base(w.Root) + "_index"
+}
+
+// ModuleFor returns the module containing path, choosing the deepest module
+// directory when modules are nested, or nil if path is in none of them.
+func (w *Workspace) ModuleFor(path string) *Module {
+	var best *Module
+	for i := range w.Modules {
+		m := &w.Modules[i]
+		if path != m.Dir && !strings.HasPrefix(path, m.Dir+string(filepath.Separator)) {
+			continue
+		}
+		if best == nil || len(m.Dir) > len(best.Dir) {
+			best = m
+		}
+	}
+	return best
+}
+
+// Lookup resolves a user-supplied module reference, which may be the module
+// path, its root-relative directory or the directory's base name.
+func (w *Workspace) Lookup(ref string) (*Module, error) {
+	ref = strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(ref), "./"), "/")
+	var matches []*Module
+	for i := range w.Modules {
+		m := &w.Modules[i]
+		if ref == m.Name || ref == m.Rel {
+			return m, nil
+		}
+		if ref == filepath.Base(m.Dir) {
+			matches = append(matches, m)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	names := make([]string, len(w.Modules))
+	for i, m := range w.Modules {
+		names[i] = m.Rel
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("module %q is ambiguous; use its path: %s", ref, strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("module %q is not in the workspace; modules: %s", ref, strings.Join(names, ", "))
+}
+
+// ParseGoWork returns the directories named by the use directives of a
+// go.work file, in both the single-line and the block form.
+func ParseGoWork(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var dirs []string
+	inUse := false
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inUse && fields[0] == ")":
+			inUse = false
+			continue
+		case inUse:
+		case fields[0] == "use" && len(fields) > 1 && fields[1] == "(":
+			inUse = true
+			continue
+		case fields[0] == "use" && len(fields) > 1:
+			fields = fields[1:]
+		default:
+			continue
+		}
+		dir, err := unquote(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		dirs = append(dirs, dir)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// modulePath returns the module path declared in a go.mod file, or "".
+func modulePath(gomod string) string {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			if p, err := unquote(fields[1]); err == nil {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+func unquote(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "`") {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
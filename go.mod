@@ -7,8 +7,10 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/redis/go-redis/v9 v9.12.1
 	github.com/spf13/cobra v1.10.1
+	golang.org/x/mod v0.27.0
 	google.golang.org/api v0.248.0
 	google.golang.org/genai v1.26.0
+	google.golang.org/grpc v1.74.2
 	google.golang.org/protobuf v1.36.7
 )
 
@@ -47,5 +49,4 @@ require (
 	google.golang.org/genproto v0.0.0-20250603155806-513f23925822 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250603155806-513f23925822 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250818200422-3122310a409c // indirect
-	google.golang.org/grpc v1.74.2 // indirect
 )